@@ -22,18 +22,20 @@ const (
 // Archive contains all metadata belonging to a file/directory
 // MUST BE encrypted
 type Archive struct {
-	Path        string      `json:"path"`               // Where in filesystem does this belong to
-	PointsTo    string      `json:"pointsto,omitempty"` // If this is a SymLink, where does it point to
-	Mode        os.FileMode `json:"mode"`               // file mode bits
-	ModTime     int64       `json:"modtime"`            // modification time
-	Size        uint64      `json:"size"`               // size
-	StorageSize uint64      `json:"storagesize"`        // size in storage
-	UID         uint32      `json:"uid"`                // owner
-	GID         uint32      `json:"gid"`                // group
-	Chunks      []Chunk     `json:"chunks,omitempty"`   // data chunks
-	Encrypted   uint16      `json:"encrypted"`          // encryption type
-	Compressed  uint16      `json:"compressed"`         // compression type
-	Type        uint8       `json:"type"`               // Is this a File, Directory or SymLink
+	Path        string            `json:"path"`                 // Where in filesystem does this belong to
+	PointsTo    string            `json:"pointsto,omitempty"`   // If this is a SymLink, where does it point to
+	LinkTarget  string            `json:"linktarget,omitempty"` // If this is a hardlink, the path of the archive containing its data
+	Mode        os.FileMode       `json:"mode"`                 // file mode bits
+	ModTime     int64             `json:"modtime"`              // modification time
+	Size        uint64            `json:"size"`                 // size
+	StorageSize uint64            `json:"storagesize"`          // size in storage
+	UID         uint32            `json:"uid"`                  // owner
+	GID         uint32            `json:"gid"`                  // group
+	XAttrs      map[string][]byte `json:"xattrs,omitempty"`     // extended attributes & ACLs
+	Chunks      []Chunk           `json:"chunks,omitempty"`     // data chunks
+	Encrypted   uint16            `json:"encrypted"`            // encryption type
+	Compressed  uint16            `json:"compressed"`           // compression type
+	Type        uint8             `json:"type"`                 // Is this a File, Directory or SymLink
 }
 
 // ArchiveResult wraps Archive and an error
@@ -57,20 +59,23 @@ func (arc *Archive) IndexOfChunk(chunkNum uint) (int, error) {
 // ChunkForOffset returns the chunk containing data beginning at offset
 // Returns chunk-number, offset inside this chunk, error
 func (arc *Archive) ChunkForOffset(offset int) (uint, int, error) {
-	size := 0
-	for i := 0; i < len(arc.Chunks); i++ {
-		idx, err := arc.IndexOfChunk(uint(i))
-		if err != nil {
+	// chunks aren't necessarily stored in order, so sort their sizes by
+	// chunk-number first instead of looking up every single chunk
+	sizes := make([]int, len(arc.Chunks))
+	for _, chunk := range arc.Chunks {
+		if chunk.Num >= uint(len(sizes)) {
 			return 0, 0, &SeekError{offset}
 		}
+		sizes[chunk.Num] = chunk.OriginalSize
+	}
 
-		chunk := arc.Chunks[idx]
-		if size+chunk.OriginalSize > offset {
-			internalOffset := offset - size
-			return chunk.Num, internalOffset, nil
+	size := 0
+	for i, s := range sizes {
+		if size+s > offset {
+			return uint(i), offset - size, nil
 		}
 
-		size += chunk.OriginalSize
+		size += s
 	}
 
 	return 0, 0, io.EOF
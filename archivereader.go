@@ -0,0 +1,172 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"io"
+)
+
+// Error declarations
+var (
+	ErrNotAFile = errors.New("Archive is not a file")
+)
+
+// ArchiveReader provides access to the content of an archive via the standard
+// io interfaces. Chunks only get loaded once they're being read, so memory
+// usage is independent of the archive's size
+type ArchiveReader struct {
+	repository Repository
+	arc        Archive
+
+	offset int64  // current read position
+	buf    []byte // unread data of the chunk at offset
+	stats  Stats  // chunks loaded from the backends or served from the cache
+
+	counted map[uint]bool   // chunk numbers already accounted for in stats
+	hashes  map[string]bool // hashes of the chunks accounted for in stats
+}
+
+// NewArchiveReader returns an ArchiveReader for the content of a single archive
+func NewArchiveReader(repository Repository, arc Archive) (*ArchiveReader, error) {
+	if arc.Type != File {
+		return nil, ErrNotAFile
+	}
+
+	return &ArchiveReader{
+		repository: repository,
+		arc:        arc,
+		counted:    make(map[uint]bool),
+		hashes:     make(map[string]bool),
+	}, nil
+}
+
+// ReadSeekCloser groups the basic Read, Seek and Close methods
+type ReadSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// OpenArchive returns a reader for the content of a single archive, which
+// can seek to arbitrary offsets
+func OpenArchive(repository Repository, arc Archive) (ReadSeekCloser, error) {
+	r, err := NewArchiveReader(repository, arc)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Read reads the archive's content, loading chunks on demand
+func (r *ArchiveReader) Read(p []byte) (int, error) {
+	if r.offset >= int64(r.arc.Size) {
+		return 0, io.EOF
+	}
+
+	if len(r.buf) == 0 {
+		chunkNum, internalOffset, err := r.arc.ChunkForOffset(int(r.offset))
+		if err != nil {
+			return 0, err
+		}
+		idx, err := r.arc.IndexOfChunk(chunkNum)
+		if err != nil {
+			return 0, err
+		}
+
+		chunk := r.arc.Chunks[idx]
+		cd, cached, err := loadCachedChunk(r.repository, r.arc, chunk)
+		if err != nil {
+			return 0, err
+		}
+		if cached {
+			logger.Debugf("Using cached chunk %s", chunk.Hash)
+			r.stats.CachedChunks++
+			r.stats.CachedSize += uint64(chunk.Size)
+		} else {
+			r.stats.Chunks++
+		}
+		if internalOffset >= len(cd) {
+			return 0, &SeekError{int(r.offset)}
+		}
+		r.countDedup(chunk)
+
+		r.buf = cd[internalOffset:]
+		prefetchChunks(r.repository, r.arc, chunkNum+1)
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.offset += int64(n)
+	return n, nil
+}
+
+// ReadAt reads len(p) bytes starting at offset off. It does not affect the
+// position used by Read and Seek
+func (r *ArchiveReader) ReadAt(p []byte, off int64) (int, error) {
+	b, err := ReadArchive(r.repository, r.arc, int(off), len(p))
+	n := copy(p, *b)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// Seek sets the position for the next Read
+func (r *ArchiveReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += int64(r.arc.Size)
+	default:
+		return r.offset, &SeekError{int(offset)}
+	}
+
+	if offset < 0 || offset > int64(r.arc.Size) {
+		return r.offset, &SeekError{int(offset)}
+	}
+
+	if offset != r.offset {
+		r.offset = offset
+		r.buf = nil
+	}
+	return r.offset, nil
+}
+
+// Stats returns how many chunks have been loaded from the backends and how
+// many have been served from the chunk cache so far
+func (r *ArchiveReader) Stats() Stats {
+	return r.stats
+}
+
+// countDedup records a dedup hit if the same data has already been read from
+// another chunk of the archive
+func (r *ArchiveReader) countDedup(chunk Chunk) {
+	if r.counted[chunk.Num] {
+		// the same chunk being read again, e.g. after seeking back
+		return
+	}
+	r.counted[chunk.Num] = true
+
+	if r.hashes[chunk.Hash] {
+		r.stats.DedupChunks++
+		r.stats.DedupSize += uint64(chunk.OriginalSize)
+	}
+	r.hashes[chunk.Hash] = true
+}
+
+// Close releases the currently loaded chunk
+func (r *ArchiveReader) Close() error {
+	r.buf = nil
+	r.offset = int64(r.arc.Size)
+	return nil
+}
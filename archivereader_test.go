@@ -0,0 +1,138 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 3*preferredChunkSize+123)
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	ar, err := NewArchiveReader(r, *snapshot.Archives[src])
+	if err != nil {
+		t.Fatalf("Failed opening archive: %s", err)
+	}
+	defer ar.Close()
+
+	b, err := ioutil.ReadAll(ar)
+	if err != nil {
+		t.Fatalf("Failed reading archive: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after reading archive")
+	}
+
+	tests := []struct {
+		offset int64
+		whence int
+		size   int
+	}{
+		{0, io.SeekStart, 16},
+		{int64(preferredChunkSize) - 8, io.SeekStart, 16}, // crossing a chunk boundary
+		{-16, io.SeekEnd, 16},
+		{-2*int64(preferredChunkSize) - 50, io.SeekCurrent, preferredChunkSize + 100},
+	}
+	for _, tt := range tests {
+		pos, err := ar.Seek(tt.offset, tt.whence)
+		if err != nil {
+			t.Errorf("Failed seeking to %d (whence %d): %s", tt.offset, tt.whence, err)
+			continue
+		}
+
+		b := make([]byte, tt.size)
+		n, err := io.ReadFull(ar, b)
+		if err != nil {
+			t.Errorf("Failed reading at %d: %s", pos, err)
+			continue
+		}
+		if !bytes.Equal(b[:n], data[pos:pos+int64(n)]) {
+			t.Errorf("Data mismatch reading at %d", pos)
+		}
+
+		n, err = ar.ReadAt(b, pos)
+		if err != nil || !bytes.Equal(b[:n], data[pos:pos+int64(n)]) {
+			t.Errorf("Data mismatch reading at %d via ReadAt: %v", pos, err)
+		}
+	}
+
+	if _, err := ar.Seek(1, io.SeekEnd); err == nil {
+		t.Error("Expected an error seeking past the end of file")
+	}
+	if _, err := ar.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Expected an error seeking before the start of file")
+	}
+}
+
+func TestArchiveReaderRandomSeeks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	writeRandomFile(t, src, 4*preferredChunkSize+321)
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+	data, _, err := DecodeArchiveData(r, arc)
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+
+	rs, err := OpenArchive(r, arc)
+	if err != nil {
+		t.Fatalf("Failed opening archive: %s", err)
+	}
+	defer rs.Close()
+
+	rnd := rand.New(rand.NewSource(42))
+	var pos int64
+	for i := 0; i < 200; i++ {
+		var offset int64
+		whence := rnd.Intn(3)
+		switch whence {
+		case io.SeekStart:
+			offset = rnd.Int63n(int64(len(data)))
+		case io.SeekCurrent:
+			offset = rnd.Int63n(int64(len(data))) - pos
+		case io.SeekEnd:
+			offset = -rnd.Int63n(int64(len(data)))
+		}
+
+		pos, err = rs.Seek(offset, whence)
+		if err != nil {
+			t.Fatalf("Failed seeking to %d (whence %d): %s", offset, whence, err)
+		}
+
+		b := make([]byte, rnd.Intn(2*preferredChunkSize))
+		n, err := io.ReadFull(rs, b)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatalf("Failed reading at %d: %s", pos, err)
+		}
+		if !bytes.Equal(b[:n], data[pos:pos+int64(n)]) {
+			t.Fatalf("Data mismatch reading %d bytes at %d", len(b), pos)
+		}
+		pos += int64(n)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // BackendFactory is used to initialize a new backend
@@ -20,7 +21,10 @@ type BackendFactory interface {
 	Protocols() []string
 }
 
-// Backend is used to store and access data
+// Backend is used to store and access data. Chunks get loaded and stored by
+// several goroutines in parallel, so implementations must be safe for
+// concurrent use. Backends which aren't can be wrapped with
+// NewSerializedBackend
 type Backend interface {
 	// Location returns the type and location of the repository
 	Location() string
@@ -62,8 +66,37 @@ type Backend interface {
 	SaveRepository(data []byte) error
 }
 
+// ChunkLister is implemented by backends which can enumerate the chunks they
+// store. It's required to collect garbage, i.e. chunks which aren't part of
+// any snapshot
+type ChunkLister interface {
+	// ListChunks returns all chunk parts stored on this backend
+	ListChunks() ([]StoredChunk, error)
+}
+
+// Locker is implemented by backends which can store the locks of a
+// repository
+type Locker interface {
+	// StoreLock stores a single lock, replacing an earlier version of it
+	StoreLock(id string, data []byte) error
+	// ListLocks returns all locks stored in the repository
+	ListLocks() ([][]byte, error)
+	// DeleteLock removes a lock from the repository
+	DeleteLock(id string) error
+}
+
+// StoredChunk describes a single chunk part stored on a backend
+type StoredChunk struct {
+	Hash       string
+	Part       uint
+	TotalParts uint
+	Size       uint64
+	ModTime    time.Time
+}
+
 // Error declarations
 var (
+	ErrListChunksUnsupported = errors.New("Backend can't list its chunks")
 	ErrRepositoryExists      = errors.New("Repository seems to already exist")
 	ErrInvalidRepositoryURL  = errors.New("Invalid repository url specified")
 	ErrAvailableSpaceUnknown = errors.New("Available space is unknown or undefined")
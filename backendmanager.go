@@ -11,7 +11,8 @@ import "errors"
 
 // BackendManager stores data on multiple backends
 type BackendManager struct {
-	Backends []*Backend
+	Backends    []*Backend
+	RetryPolicy RetryPolicy
 
 	lastUsedBackend int
 }
@@ -44,10 +45,16 @@ func (backend *BackendManager) Locations() []string {
 	return paths
 }
 
-// LoadChunk loads a Chunk from backends
+// LoadChunk loads a Chunk from backends. Transient failures get retried
+// according to the RetryPolicy
 func (backend *BackendManager) LoadChunk(chunk Chunk, part uint) ([]byte, error) {
 	for _, be := range backend.Backends {
-		b, err := (*be).LoadChunk(chunk.Hash, part, chunk.DataParts)
+		var b []byte
+		err := backend.RetryPolicy.Retry(func() error {
+			var err error
+			b, err = (*be).LoadChunk(chunk.Hash, part, chunk.DataParts)
+			return err
+		})
 		if err == nil {
 			return b, err
 		}
@@ -80,6 +87,19 @@ func (backend *BackendManager) StoreChunk(chunk Chunk) (size uint64, err error)
 	return size, nil
 }
 
+// StoreChunkPart stores a single part of a Chunk on the first backend that
+// accepts it
+func (backend *BackendManager) StoreChunkPart(chunk Chunk, part uint, data []byte) (uint64, error) {
+	for _, be := range backend.Backends {
+		n, err := (*be).StoreChunk(chunk.Hash, part, chunk.DataParts, data)
+		if err == nil {
+			return n, nil
+		}
+	}
+
+	return 0, ErrStoreChunkFailed
+}
+
 // DeleteChunk deletes a single Chunk
 func (backend *BackendManager) DeleteChunk(shasum string, part, totalParts uint) error {
 	for _, be := range backend.Backends {
@@ -0,0 +1,222 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// DefaultChunkCacheSize is the default byte budget of the chunk cache
+	DefaultChunkCacheSize = 64 * (1 << 20) // 64 MiB
+	// DefaultReadAhead is the default amount of chunks prefetched while
+	// reading an archive
+	DefaultReadAhead = 2
+)
+
+// chunkCache keeps decoded chunks in memory and evicts the least recently
+// used ones once the cached data exceeds maxSize bytes. Concurrent loads of
+// the same chunk are coalesced into a single one
+type chunkCache struct {
+	mut      sync.Mutex
+	maxSize  uint64
+	size     uint64
+	entries  map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*chunkLoad
+
+	readAhead   int // maximum amount of outstanding prefetches
+	prefetching int // amount of outstanding prefetches
+}
+
+// chunkLoad is a chunk currently being loaded. done gets closed once data
+// and err are set
+type chunkLoad struct {
+	done     chan struct{}
+	data     []byte
+	err      error
+	prefetch bool // loaded by Prefetch
+	claimed  bool // a reader is waiting for the prefetch
+}
+
+type chunkCacheEntry struct {
+	hash       string
+	data       []byte
+	prefetched bool // prefetched, but not read yet
+}
+
+func newChunkCache(maxSize uint64) *chunkCache {
+	return &chunkCache{
+		maxSize:   maxSize,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+		inflight:  make(map[string]*chunkLoad),
+		readAhead: DefaultReadAhead,
+	}
+}
+
+// Get returns the cached data for a chunk and marks it as recently used
+func (c *chunkCache) Get(hash string) ([]byte, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	e, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(e)
+	return e.Value.(*chunkCacheEntry).data, true
+}
+
+// Add caches the data for a chunk, unless it's already cached or exceeds the
+// cache's entire budget
+func (c *chunkCache) Add(hash string, data []byte) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.add(hash, data, false)
+}
+
+// add caches the data for a chunk. Must be called with the mutex held
+func (c *chunkCache) add(hash string, data []byte, prefetched bool) {
+	if e, ok := c.entries[hash]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	if uint64(len(data)) > c.maxSize {
+		return
+	}
+
+	c.entries[hash] = c.lru.PushFront(&chunkCacheEntry{hash, data, prefetched})
+	c.size += uint64(len(data))
+	c.evict()
+}
+
+// Load returns the cached data for a chunk. Otherwise the chunk gets loaded
+// with load and added to the cache. If the chunk is already being loaded, Load
+// waits for that instead. cached is false if the data had to be loaded for
+// this call, which includes the first read of a prefetched chunk
+func (c *chunkCache) Load(hash string, load func() ([]byte, error)) (data []byte, cached bool, err error) {
+	c.mut.Lock()
+	if e, ok := c.entries[hash]; ok {
+		c.lru.MoveToFront(e)
+		entry := e.Value.(*chunkCacheEntry)
+		cached = !entry.prefetched
+		entry.prefetched = false
+		c.mut.Unlock()
+		return entry.data, cached, nil
+	}
+	if l, ok := c.inflight[hash]; ok {
+		cached = !l.prefetch || l.claimed
+		l.claimed = true
+		c.mut.Unlock()
+		<-l.done
+		return l.data, cached, l.err
+	}
+	l := c.start(hash)
+	c.mut.Unlock()
+
+	c.finish(hash, l, load)
+	return l.data, false, l.err
+}
+
+// Prefetch loads a chunk in the background, unless it's already cached or
+// being loaded, or the maximum amount of prefetches is outstanding
+func (c *chunkCache) Prefetch(hash string, load func() ([]byte, error)) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if _, ok := c.entries[hash]; ok {
+		return
+	}
+	if _, ok := c.inflight[hash]; ok {
+		return
+	}
+	if c.prefetching >= c.readAhead {
+		return
+	}
+
+	c.prefetching++
+	l := c.start(hash)
+	l.prefetch = true
+	go c.finish(hash, l, load)
+}
+
+// start registers a chunk as being loaded. Must be called with the mutex held
+func (c *chunkCache) start(hash string) *chunkLoad {
+	l := &chunkLoad{done: make(chan struct{})}
+	c.inflight[hash] = l
+	return l
+}
+
+// finish loads a chunk registered with start, caches it and wakes up everyone
+// waiting for it
+func (c *chunkCache) finish(hash string, l *chunkLoad, load func() ([]byte, error)) {
+	l.data, l.err = load()
+
+	c.mut.Lock()
+	if l.err == nil {
+		c.add(hash, l.data, l.prefetch && !l.claimed)
+	}
+	if l.prefetch {
+		c.prefetching--
+	}
+	delete(c.inflight, hash)
+	c.mut.Unlock()
+	close(l.done)
+}
+
+// SetReadAhead changes the maximum amount of outstanding prefetches
+func (c *chunkCache) SetReadAhead(n int) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.readAhead = n
+}
+
+// ReadAhead returns the maximum amount of outstanding prefetches
+func (c *chunkCache) ReadAhead() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.readAhead
+}
+
+// SetMaxSize changes the byte budget of the cache, evicting chunks if needed
+func (c *chunkCache) SetMaxSize(maxSize uint64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.maxSize = maxSize
+	c.evict()
+}
+
+// Size returns the amount of bytes currently cached
+func (c *chunkCache) Size() uint64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.size
+}
+
+// evict removes the least recently used chunks until the cache fits into its
+// budget. Must be called with the mutex held
+func (c *chunkCache) evict() {
+	for c.size > c.maxSize {
+		e := c.lru.Back()
+		if e == nil {
+			return
+		}
+
+		entry := c.lru.Remove(e).(*chunkCacheEntry)
+		delete(c.entries, entry.hash)
+		c.size -= uint64(len(entry.data))
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestChunkCacheEviction(t *testing.T) {
+	c := newChunkCache(10)
+
+	c.Add("a", []byte("1234"))
+	c.Add("b", []byte("1234"))
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected chunk a to be cached")
+	}
+
+	// b is now the least recently used chunk and should get evicted
+	c.Add("c", []byte("1234"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected chunk b to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected chunk a to be cached")
+	}
+	if c.Size() != 8 {
+		t.Errorf("Expected cache size %d, got %d", 8, c.Size())
+	}
+
+	// adding the same chunk twice must not grow the cache
+	c.Add("c", []byte("1234"))
+	if c.Size() != 8 {
+		t.Errorf("Expected cache size %d, got %d", 8, c.Size())
+	}
+
+	// chunks exceeding the whole budget don't get cached at all
+	c.Add("d", []byte("12345678901"))
+	if _, ok := c.Get("d"); ok {
+		t.Error("Expected chunk d not to be cached")
+	}
+
+	c.SetMaxSize(4)
+	if c.Size() > 4 {
+		t.Errorf("Expected cache size <= %d, got %d", 4, c.Size())
+	}
+}
+
+func TestChunkCacheLoadCoalesced(t *testing.T) {
+	c := newChunkCache(1 << 20)
+
+	var loads int32
+	release := make(chan struct{})
+	load := func() ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return []byte("1234"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, _, err := c.Load("a", load)
+			if err != nil || string(b) != "1234" {
+				t.Errorf("Unexpected result loading chunk: %q, %v", b, err)
+			}
+		}()
+	}
+	c.Prefetch("a", load)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("Expected chunk to be loaded once, got %d loads", loads)
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected chunk a to be cached")
+	}
+}
+
+func TestChunkCachePrefetchWindow(t *testing.T) {
+	c := newChunkCache(1 << 20)
+	c.SetReadAhead(2)
+
+	var loads int32
+	release := make(chan struct{})
+	load := func() ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return []byte("1234"), nil
+	}
+
+	for _, hash := range []string{"a", "b", "c", "d"} {
+		c.Prefetch(hash, load)
+	}
+	close(release)
+
+	// waits for the outstanding prefetches. The first read of a prefetched
+	// chunk doesn't count as a cache hit
+	for _, hash := range []string{"a", "b"} {
+		if _, cached, _ := c.Load(hash, load); cached {
+			t.Errorf("Expected chunk %s not to be reported as cached", hash)
+		}
+		if _, cached, _ := c.Load(hash, load); !cached {
+			t.Errorf("Expected chunk %s to be cached", hash)
+		}
+	}
+	if loads != 2 {
+		t.Errorf("Expected %d prefetches, got %d", 2, loads)
+	}
+}
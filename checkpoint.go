@@ -0,0 +1,143 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// CheckpointPrefix is the name prefix of the checkpoint files restores
+	// keep in their destination, followed by the snapshot's ID
+	CheckpointPrefix = ".knoxite-restore-"
+
+	// checkpointSyncInterval is how often the checkpoint gets flushed to disk
+	checkpointSyncInterval = 5 * time.Second
+)
+
+// checkpointEntry records a fully restored archive and where it got restored
+// to, relative to the restore's destination. Restoring with a different
+// StripPrefix therefore doesn't skip archives restored elsewhere
+type checkpointEntry struct {
+	Path    string `json:"path"`
+	ModTime int64  `json:"mtime"`
+	Target  string `json:"target"`
+}
+
+// restoreCheckpoint keeps track of the archives of a snapshot that have been
+// restored completely, so an interrupted restore can skip them. It's kept in
+// the destination directory as long as the restore didn't finish without
+// errors, so it can be resumed. Entries are
+// appended line by line, so a crash can at most leave an incomplete last line
+// behind, which gets discarded when opening the checkpoint again
+type restoreCheckpoint struct {
+	dst      string
+	path     string
+	mut      sync.Mutex
+	f        *os.File
+	done     map[checkpointEntry]bool
+	lastSync time.Time
+}
+
+// openCheckpoint opens or creates the checkpoint of restoring snapshot to dst
+func openCheckpoint(dst string, snapshot *Snapshot) (*restoreCheckpoint, error) {
+	err := os.MkdirAll(dst, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &restoreCheckpoint{
+		dst:      dst,
+		path:     filepath.Join(dst, CheckpointPrefix+snapshot.ID),
+		done:     make(map[checkpointEntry]bool),
+		lastSync: time.Now(),
+	}
+
+	b, err := ioutil.ReadFile(cp.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// ignore an incomplete last line
+	complete := bytes.LastIndexByte(b, '\n') + 1
+	for _, line := range bytes.Split(b[:complete], []byte{'\n'}) {
+		var e checkpointEntry
+		if json.Unmarshal(line, &e) == nil {
+			cp.done[e] = true
+		}
+	}
+
+	cp.f, err = os.OpenFile(cp.path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = cp.f.Truncate(int64(complete)); err == nil {
+		_, err = cp.f.Seek(int64(complete), io.SeekStart)
+	}
+	if err != nil {
+		cp.f.Close()
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+// entry returns the checkpoint entry of arc being restored to path
+func (cp *restoreCheckpoint) entry(arc Archive, path string) checkpointEntry {
+	target, err := filepath.Rel(cp.dst, path)
+	if err != nil {
+		target = path
+	}
+	return checkpointEntry{arc.Path, arc.ModTime, filepath.ToSlash(target)}
+}
+
+// restored returns true if arc has already been restored completely to path
+func (cp *restoreCheckpoint) restored(arc Archive, path string) bool {
+	return cp.done[cp.entry(arc, path)]
+}
+
+// add records arc as restored completely to path
+func (cp *restoreCheckpoint) add(arc Archive, path string) error {
+	b, err := json.Marshal(cp.entry(arc, path))
+	if err != nil {
+		return err
+	}
+	cp.mut.Lock()
+	defer cp.mut.Unlock()
+
+	if _, err = cp.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	if time.Since(cp.lastSync) >= checkpointSyncInterval {
+		cp.lastSync = time.Now()
+		return cp.f.Sync()
+	}
+	return nil
+}
+
+// close flushes and closes the checkpoint, keeping it for the next restore
+func (cp *restoreCheckpoint) close() error {
+	if err := cp.f.Sync(); err != nil {
+		cp.f.Close()
+		return err
+	}
+	return cp.f.Close()
+}
+
+// remove deletes the checkpoint once the restore has finished
+func (cp *restoreCheckpoint) remove() error {
+	cp.f.Close()
+	return os.Remove(cp.path)
+}
@@ -0,0 +1,116 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeSnapshotCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a")
+	c := filepath.Join(dir, "c")
+	writeRandomFile(t, a, 1024)
+	writeRandomFile(t, filepath.Join(dir, "b"), 1024)
+	data := writeRandomFile(t, c, 1024)
+
+	r, snapshot := setupDecodeTest(t, "memory://TestDecodeSnapshotCheckpoint", []string{dir}, CompressionNone, 0)
+	be := (*r.BackendManager().Backends[0]).(*MemoryBackend)
+	r.SetChunkCacheSize(0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+	checkpoint := filepath.Join(targetdir, CheckpointPrefix+snapshot.ID)
+
+	restore := func(stripPrefix string, checkpoint bool) int {
+		opts := DefaultRestoreOptions()
+		opts.ContinueOnError = true
+		opts.Checkpoint = checkpoint
+		opts.StripPrefix = stripPrefix
+		progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, opts)
+		if err != nil {
+			t.Fatalf("Failed restoring snapshot: %s", err)
+		}
+
+		errs := 0
+		for p := range progress {
+			if p.Error != nil {
+				errs++
+			}
+		}
+		return errs
+	}
+
+	// interrupt the restore of c
+	chunk := snapshot.Archives[c].Chunks[0]
+	be.FailPart(chunk.Hash, 0, errors.New("simulated failure"))
+	if errs := restore("", false); errs != 2 {
+		t.Fatalf("Expected restore of c to fail, got %d errors", errs)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Fatalf("Expected no checkpoint without enabling it")
+	}
+	if errs := restore("", true); errs != 2 {
+		t.Fatalf("Expected restore of c to fail, got %d errors", errs)
+	}
+	if _, err := os.Stat(checkpoint); err != nil {
+		t.Fatalf("Expected checkpoint to be kept: %s", err)
+	}
+
+	// archives restored to another path must not be skipped
+	if errs := restore(dir, true); errs != 2 {
+		t.Fatalf("Expected restore of c to fail, got %d errors", errs)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(targetdir, "a"))
+	if err != nil || len(b) != 1024 {
+		t.Errorf("Expected a to be restored with a different prefix: %v", err)
+	}
+
+	// mark a, so we notice if it gets restored again, and simulate a crash
+	// while writing the checkpoint
+	err = ioutil.WriteFile(filepath.Join(targetdir, a), []byte("marker"), 0644)
+	if err != nil {
+		t.Fatalf("Failed writing file: %s", err)
+	}
+	f, err := os.OpenFile(checkpoint, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("Failed opening checkpoint: %s", err)
+	}
+	_, _ = f.Write([]byte(`{"path":`))
+	f.Close()
+
+	be.FailPart(chunk.Hash, 0, nil)
+	if errs := restore("", true); errs != 0 {
+		t.Fatalf("Expected resumed restore to succeed, got %d errors", errs)
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(targetdir, a))
+	if err != nil || string(b) != "marker" {
+		t.Errorf("Expected completed archive to be skipped, got %q (%v)", b, err)
+	}
+	b, err = ioutil.ReadFile(filepath.Join(targetdir, c))
+	if err != nil || !bytes.Equal(b, data) {
+		t.Errorf("Expected interrupted archive to be restored: %v", err)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("Expected checkpoint to be removed after the restore finished")
+	}
+}
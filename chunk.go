@@ -8,7 +8,9 @@
 package knoxite
 
 import (
+	"errors"
 	"io"
+	"math/bits"
 	"os"
 	"sync"
 
@@ -17,8 +19,58 @@ import (
 
 const (
 	preferredChunkSize = 1 * (1 << 20) // 1 MiB
+
+	// MinChunkSize is the smallest chunk size a ChunkerConfig may use
+	MinChunkSize = 16 * (1 << 10) // 16 KiB
+	// MaxChunkSize is the biggest chunk size a ChunkerConfig may use
+	MaxChunkSize = 64 * (1 << 20) // 64 MiB
+)
+
+// Error declarations
+var (
+	ErrChunkSizeOutOfRange   = errors.New("Chunk sizes must be between 16 KiB and 64 MiB")
+	ErrChunkSizeOrder        = errors.New("Chunk sizes must satisfy min <= avg <= max")
+	ErrChunkAvgSizeNotPowOf2 = errors.New("Average chunk size must be a power of two")
 )
 
+// ChunkerConfig controls how files get split into chunks. Chunk boundaries
+// depend on the content, so data gets deduplicated even if it moved within
+// a file.
+//
+// Smaller chunks find more duplicates, e.g. among many similar source files,
+// but every chunk adds metadata to the snapshots and the chunk-index. Bigger
+// chunks suit large media files, which rarely share any data. Every chunk
+// records its own size, so changing the config doesn't affect existing
+// snapshots. Data stored with different configs won't be deduplicated
+// against each other though
+type ChunkerConfig struct {
+	MinSize uint `json:"min_size"`
+	AvgSize uint `json:"avg_size"` // must be a power of two
+	MaxSize uint `json:"max_size"`
+}
+
+// DefaultChunkerConfig is used for repositories without a ChunkerConfig
+var DefaultChunkerConfig = ChunkerConfig{
+	MinSize: chunker.MinSize,
+	AvgSize: preferredChunkSize,
+	MaxSize: preferredChunkSize,
+}
+
+// Validate returns an error if the config can't be used for chunking
+func (cfg ChunkerConfig) Validate() error {
+	if cfg.MinSize < MinChunkSize || cfg.MaxSize > MaxChunkSize {
+		return ErrChunkSizeOutOfRange
+	}
+	if cfg.MinSize > cfg.AvgSize || cfg.AvgSize > cfg.MaxSize {
+		return ErrChunkSizeOrder
+	}
+	if cfg.AvgSize&(cfg.AvgSize-1) != 0 {
+		return ErrChunkAvgSizeNotPowOf2
+	}
+
+	return nil
+}
+
 // Chunk stores an encrypted chunk alongside with its metadata
 // MUST BE encrypted
 type Chunk struct {
@@ -47,7 +99,7 @@ func processChunk(id int, compress, encrypt uint16, password string, dataParts,
 	pipe, _ := NewEncodingPipeline(compress, encrypt, password)
 
 	for j := range jobs {
-		// fmt.Println("\tWorker", id, "processing job", j.Num, len(j.Data))
+		logger.Debugf("Worker %d processing job %d (%d bytes)", id, j.Num, len(j.Data))
 
 		b, err := pipe.Process(j.Data)
 		if err != nil {
@@ -87,9 +139,12 @@ func processChunk(id int, compress, encrypt uint16, password string, dataParts,
 	}
 }
 
-// chunkFile divides filename into chunks of 1MiB each
-func chunkFile(filename string, compress, encrypt uint16, password string, dataParts, parityParts int) (chan ChunkResult, error) {
+// chunkFile divides filename into chunks as configured by cfg
+func chunkFile(filename string, cfg ChunkerConfig, compress, encrypt uint16, password string, dataParts, parityParts int) (chan ChunkResult, error) {
 	c := make(chan ChunkResult)
+	if err := cfg.Validate(); err != nil {
+		return c, err
+	}
 
 	file, err := os.Open(filename)
 	if err != nil {
@@ -104,11 +159,12 @@ func chunkFile(filename string, compress, encrypt uint16, password string, dataP
 
 	wg.Add(1)
 	go func() {
-		chunker := chunker.NewWithBoundaries(file, chunker.Pol(0x3DA3358B4DC173), chunker.MinSize, preferredChunkSize)
+		chunker := chunker.NewWithBoundaries(file, chunker.Pol(0x3DA3358B4DC173), cfg.MinSize, cfg.MaxSize)
+		chunker.SetAverageBits(bits.TrailingZeros(cfg.AvgSize))
 
 		i := uint(0)
 		for {
-			buf := make([]byte, preferredChunkSize)
+			buf := make([]byte, cfg.MaxSize)
 			chunk, err := chunker.Next(buf)
 			if err == io.EOF {
 				wg.Done()
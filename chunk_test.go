@@ -0,0 +1,99 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkerConfigValidate(t *testing.T) {
+	tests := []struct {
+		cfg ChunkerConfig
+		err error
+	}{
+		{DefaultChunkerConfig, nil},
+		{ChunkerConfig{MinSize: 16 << 10, AvgSize: 64 << 10, MaxSize: 256 << 10}, nil},
+		{ChunkerConfig{MinSize: 1 << 10, AvgSize: 64 << 10, MaxSize: 256 << 10}, ErrChunkSizeOutOfRange},
+		{ChunkerConfig{MinSize: 1 << 20, AvgSize: 8 << 20, MaxSize: 128 << 20}, ErrChunkSizeOutOfRange},
+		{ChunkerConfig{MinSize: 128 << 10, AvgSize: 64 << 10, MaxSize: 256 << 10}, ErrChunkSizeOrder},
+		{ChunkerConfig{MinSize: 16 << 10, AvgSize: 512 << 10, MaxSize: 256 << 10}, ErrChunkSizeOrder},
+		{ChunkerConfig{MinSize: 16 << 10, AvgSize: 100 << 10, MaxSize: 256 << 10}, ErrChunkAvgSizeNotPowOf2},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); err != tt.err {
+			t.Errorf("Expected %v validating %+v, got %v", tt.err, tt.cfg, err)
+		}
+	}
+}
+
+func TestChunkerConfig(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repodir := filepath.Join(dir, "repo")
+	r, err := NewRepository(repodir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+	if err = r.SetChunkerConfig(ChunkerConfig{MinSize: 100}); err == nil {
+		t.Error("Expected an invalid chunker config to be rejected")
+	}
+	cfg := ChunkerConfig{MinSize: 16 << 10, AvgSize: 32 << 10, MaxSize: 64 << 10}
+	if err = r.SetChunkerConfig(cfg); err != nil {
+		t.Fatalf("Failed setting chunker config: %s", err)
+	}
+	if err = r.Save(); err != nil {
+		t.Fatalf("Failed saving repository: %s", err)
+	}
+
+	r, err = OpenRepository(repodir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed opening repository: %s", err)
+	}
+	if r.Chunker != cfg {
+		t.Errorf("Expected chunker config %+v, got %+v", cfg, r.Chunker)
+	}
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 1<<20)
+	c, err := chunkFile(src, r.chunkerConfig(), CompressionNone, EncryptionNone, "", 1, 0)
+	if err != nil {
+		t.Fatalf("Failed chunking file: %s", err)
+	}
+
+	chunks := make([][]byte, 64)
+	var n int
+	for cr := range c {
+		if cr.Error != nil {
+			t.Fatalf("Failed chunking file: %s", cr.Error)
+		}
+		if cr.Chunk.OriginalSize > int(cfg.MaxSize) {
+			t.Errorf("Expected chunks of at most %d bytes, got %d", cfg.MaxSize, cr.Chunk.OriginalSize)
+		}
+		chunks[cr.Chunk.Num] = (*cr.Chunk.Data)[0]
+		n++
+	}
+
+	// the default config would have produced a single chunk
+	if n < 16 {
+		t.Errorf("Expected at least 16 chunks, got %d", n)
+	}
+	if !bytes.Equal(bytes.Join(chunks[:n], nil), data) {
+		t.Error("Data mismatch after chunking")
+	}
+}
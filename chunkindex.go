@@ -7,10 +7,6 @@
 
 package knoxite
 
-import (
-	"fmt"
-)
-
 // A ChunkIndexItem links a chunk with one or many snapshots
 type ChunkIndexItem struct {
 	Hash        string   `json:"hash"`
@@ -43,11 +39,11 @@ func OpenChunkIndex(repository *Repository) (ChunkIndex, error) {
 		}
 	} else {
 		if !repository.IsEmpty() {
-			fmt.Println("Chunk-Index is empty, re-indexing all snapshots...")
+			logger.Infof("Chunk-Index is empty, re-indexing all snapshots...")
 			err = index.reindex(repository)
 			if err == nil {
 				if len(index.Chunks) > 0 {
-					fmt.Println("Successfully re-indexed snapshots.")
+					logger.Infof("Successfully re-indexed snapshots.")
 				}
 			}
 		}
@@ -72,12 +68,19 @@ func (index *ChunkIndex) Save(repository *Repository) error {
 
 // Pack deletes unreferenced chunks and removes them from the index
 func (index *ChunkIndex) Pack(repository *Repository) (freedSize uint64, err error) {
+	_, freedSize, err = index.pack(repository)
+	return
+}
+
+// pack deletes unreferenced chunks and returns how many chunks have been
+// deleted and how much space this freed
+func (index *ChunkIndex) pack(repository *Repository) (deleted int, freedSize uint64, err error) {
 	chunks := make(map[string]*ChunkIndexItem)
 
 	for _, chunk := range index.Chunks {
-		// fmt.Printf("Chunk %s referenced in Snapshots %+v\n", chunk.Hash, chunk.Snapshots)
+		logger.Debugf("Chunk %s referenced in Snapshots %+v", chunk.Hash, chunk.Snapshots)
 		if len(chunk.Snapshots) == 0 {
-			fmt.Printf("Chunk %s is no longer referenced by any snapshot. Deleting!\n", chunk.Hash)
+			logger.Infof("Chunk %s is no longer referenced by any snapshot. Deleting!", chunk.Hash)
 
 			for i := uint(0); i < chunk.DataParts+chunk.ParityParts; i++ {
 				err = repository.backend.DeleteChunk(chunk.Hash, i, chunk.DataParts)
@@ -86,6 +89,7 @@ func (index *ChunkIndex) Pack(repository *Repository) (freedSize uint64, err err
 				}
 				freedSize += uint64(chunk.Size)
 			}
+			deleted++
 		} else {
 			chunks[chunk.Hash] = chunk
 		}
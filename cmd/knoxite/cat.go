@@ -39,18 +39,34 @@ func executeCat(snapshotID string, file string) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	_, snapshot, ferr := repository.FindSnapshot(snapshotID)
 	if ferr != nil {
 		return ferr
 	}
 
 	if archive, ok := snapshot.Archives[file]; ok {
-		b, _, erra := knoxite.DecodeArchiveData(repository, *archive)
-		if erra != nil {
-			return erra
+		if archive.LinkTarget != "" {
+			// hardlinks share the data of the archive they're pointing to
+			target, ok := snapshot.Archives[archive.LinkTarget]
+			if !ok {
+				return fmt.Errorf("%s: No such file or directory", archive.LinkTarget)
+			}
+			archive = target
 		}
 
-		_, err = os.Stdout.Write(b)
+		// stream the file without keeping it in memory entirely
+		progress := make(chan knoxite.Progress)
+		go func() {
+			for range progress {
+			}
+		}()
+		err = knoxite.DecodeArchiveToWriter(progress, repository, *archive, os.Stdout)
+		close(progress)
 		return err
 	}
 
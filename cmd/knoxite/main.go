@@ -17,6 +17,8 @@ import (
 	shutdown "github.com/klauspost/shutdown2"
 	"github.com/spf13/cobra"
 
+	"github.com/knoxite/knoxite"
+
 	_ "github.com/knoxite/knoxite/storage/azure"
 	_ "github.com/knoxite/knoxite/storage/backblaze"
 	_ "github.com/knoxite/knoxite/storage/dropbox"
@@ -33,6 +35,9 @@ import (
 type GlobalOptions struct {
 	Repo     string
 	Password string
+	KeyFile  string
+
+	KeyFilePassword bool
 }
 
 var (
@@ -56,13 +61,17 @@ func main() {
 	shutdown.OnSignal(0, os.Interrupt, syscall.SIGTERM)
 	// quiet shutdown logger
 	shutdown.Logger = shutdown.LogPrinter(log.New(ioutil.Discard, "", log.LstdFlags))
+	knoxite.SetLogger(cliLogger{})
 	// shutdown.SetTimeout(0)
 
 	RootCmd.PersistentFlags().StringVarP(&globalOpts.Repo, "repo", "r", "", "Repository directory to backup to/restore from (default: current working dir)")
 	RootCmd.PersistentFlags().StringVarP(&globalOpts.Password, "password", "p", "", "Password to use for data encryption")
+	RootCmd.PersistentFlags().StringVarP(&globalOpts.KeyFile, "keyfile", "k", "", "Key file to use instead of a password")
+	RootCmd.PersistentFlags().BoolVar(&globalOpts.KeyFilePassword, "keyfile-password", false, "Require a password in addition to the key file")
 
 	globalOpts.Repo = os.Getenv("KNOXITE_REPOSITORY")
 	globalOpts.Password = os.Getenv("KNOXITE_PASSWORD")
+	globalOpts.KeyFile = os.Getenv("KNOXITE_KEYFILE")
 
 	if err := RootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -70,6 +79,19 @@ func main() {
 	}
 }
 
+// cliLogger prints informational messages and warnings of the knoxite package
+type cliLogger struct{}
+
+func (cliLogger) Debugf(format string, args ...interface{}) {}
+
+func (cliLogger) Infof(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (cliLogger) Warnf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
 func init() {
 	if CommitSHA != "" {
 		vt := RootCmd.VersionTemplate()
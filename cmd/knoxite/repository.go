@@ -15,6 +15,7 @@ import (
 	"os"
 	"strings"
 	"syscall"
+	"time"
 
 	shutdown "github.com/klauspost/shutdown2"
 	"github.com/muesli/crunchy"
@@ -86,19 +87,56 @@ var (
 			return executeRepoPack()
 		},
 	}
+	repoPruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "remove snapshots according to a retention policy",
+		Long:  `The prune command removes all snapshots not kept by the retention policy and deletes their unused data chunks from storage`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return executeRepoPrune(pruneOpts)
+		},
+	}
+	repoGCCmd = &cobra.Command{
+		Use:   "gc",
+		Short: "delete data chunks not referenced by any snapshot",
+		Long:  `The gc command scans the storage backends and deletes all data chunks which aren't referenced by any snapshot, e.g. leftovers of aborted backups`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return executeRepoGC(gcGracePeriod)
+		},
+	}
+
+	pruneOpts     = knoxite.RetentionPolicy{}
+	gcGracePeriod time.Duration
+	chunkerOpts   = knoxite.DefaultChunkerConfig
 )
 
 func init() {
 	repoCmd.AddCommand(repoInitCmd)
+	repoInitCmd.Flags().UintVar(&chunkerOpts.MinSize, "chunk-min-size", knoxite.DefaultChunkerConfig.MinSize, "minimum size of data chunks in bytes")
+	repoInitCmd.Flags().UintVar(&chunkerOpts.AvgSize, "chunk-avg-size", knoxite.DefaultChunkerConfig.AvgSize, "average size of data chunks in bytes, must be a power of two")
+	repoInitCmd.Flags().UintVar(&chunkerOpts.MaxSize, "chunk-max-size", knoxite.DefaultChunkerConfig.MaxSize, "maximum size of data chunks in bytes")
 	repoCmd.AddCommand(repoChangePasswordCmd)
 	repoCmd.AddCommand(repoCatCmd)
 	repoCmd.AddCommand(repoInfoCmd)
 	repoCmd.AddCommand(repoAddCmd)
 	repoCmd.AddCommand(repoPackCmd)
+	repoCmd.AddCommand(repoPruneCmd)
+	repoCmd.AddCommand(repoGCCmd)
+	repoPruneCmd.Flags().IntVar(&pruneOpts.KeepLast, "keep-last", 0, "keep the n most recent snapshots of every volume")
+	repoPruneCmd.Flags().IntVar(&pruneOpts.KeepDaily, "keep-daily", 0, "keep the most recent snapshot of the last n days")
+	repoPruneCmd.Flags().IntVar(&pruneOpts.KeepWeekly, "keep-weekly", 0, "keep the most recent snapshot of the last n weeks")
+	repoPruneCmd.Flags().IntVar(&pruneOpts.KeepMonthly, "keep-monthly", 0, "keep the most recent snapshot of the last n months")
+	repoPruneCmd.Flags().IntVar(&pruneOpts.KeepYearly, "keep-yearly", 0, "keep the most recent snapshot of the last n years")
+	repoPruneCmd.Flags().StringArrayVar(&pruneOpts.KeepTags, "keep-tag", []string{}, "keep all snapshots with this tag")
+	repoPruneCmd.Flags().DurationVar(&pruneOpts.KeepWithin, "keep-within", 0, "keep all snapshots taken within this duration before the most recent one")
+	repoGCCmd.Flags().DurationVar(&gcGracePeriod, "grace-period", knoxite.DefaultGCGracePeriod, "don't delete chunks stored within this duration, as they may belong to a running backup")
 	RootCmd.AddCommand(repoCmd)
 }
 
 func executeRepoInit() error {
+	if err := chunkerOpts.Validate(); err != nil {
+		return err
+	}
+
 	// acquire a shutdown lock. we don't want these next calls to be interrupted
 	lock := shutdown.Lock()
 	if lock == nil {
@@ -110,6 +148,14 @@ func executeRepoInit() error {
 	if err != nil {
 		return fmt.Errorf("Creating repository at %s failed: %v", globalOpts.Repo, err)
 	}
+	if chunkerOpts != knoxite.DefaultChunkerConfig {
+		if err = r.SetChunkerConfig(chunkerOpts); err != nil {
+			return err
+		}
+		if err = r.Save(); err != nil {
+			return err
+		}
+	}
 
 	fmt.Printf("Created new repository at %s\n", (*r.BackendManager().Backends[0]).Location())
 	return nil
@@ -187,6 +233,11 @@ func executeRepoPack() error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	index, err := knoxite.OpenChunkIndex(&r)
 	if err != nil {
 		return err
@@ -206,6 +257,51 @@ func executeRepoPack() error {
 	return nil
 }
 
+func executeRepoPrune(policy knoxite.RetentionPolicy) error {
+	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stats, err := knoxite.PruneSnapshots(&r, policy)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d snapshots and %d chunks, freed storage space: %s\n",
+		stats.Snapshots, stats.Chunks, knoxite.SizeToString(stats.FreedSize))
+	return nil
+}
+
+func executeRepoGC(grace time.Duration) error {
+	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockRepository(&r, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stats, err := knoxite.GarbageCollect(&r, grace)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %d chunks (%d parts), freed storage space: %s\n",
+		stats.Chunks, stats.Parts, knoxite.SizeToString(stats.FreedSize))
+	if stats.Skipped > 0 {
+		fmt.Printf("Skipped %d recently stored chunk parts\n", stats.Skipped)
+	}
+	return nil
+}
+
 func executeRepoInfo() error {
 	r, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err != nil {
@@ -228,6 +324,13 @@ func executeRepoInfo() error {
 }
 
 func openRepository(path, password string) (knoxite.Repository, error) {
+	if globalOpts.KeyFile != "" {
+		var err error
+		password, err = keyFilePassword(password, false)
+		if err != nil {
+			return knoxite.Repository{}, err
+		}
+	}
 	if password == "" {
 		var err error
 		password, err = readPassword("Enter password:")
@@ -239,7 +342,54 @@ func openRepository(path, password string) (knoxite.Repository, error) {
 	return knoxite.OpenRepository(path, password)
 }
 
+// lockRepository acquires a lock on the repository and returns a func
+// releasing it. Backends without locking support only cause a warning
+func lockRepository(r *knoxite.Repository, exclusive bool) (func(), error) {
+	lock, err := knoxite.LockRepository(r, exclusive)
+	if err == knoxite.ErrLockingUnsupported {
+		fmt.Fprintln(os.Stderr, "Warning: the storage backend doesn't support locking the repository")
+		return func() {}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// abort when another process removed our lock, as we can't tell what
+	// it's doing to the repository now
+	released := make(chan struct{})
+	go func() {
+		select {
+		case <-lock.Lost():
+			fmt.Println(knoxite.ErrLockLost)
+			shutdown.Exit(-1)
+		case <-released:
+		}
+	}()
+
+	return func() {
+		close(released)
+		if err := lock.Release(); err != nil {
+			fmt.Fprintf(os.Stderr, "Releasing repository lock failed: %s\n", err)
+		}
+	}, nil
+}
+
 func newRepository(path, password string) (knoxite.Repository, error) {
+	if globalOpts.KeyFile != "" {
+		// create the key file when it doesn't exist yet
+		if _, err := os.Stat(globalOpts.KeyFile); os.IsNotExist(err) {
+			err = knoxite.GenerateKeyFile(globalOpts.KeyFile)
+			if err != nil {
+				return knoxite.Repository{}, err
+			}
+		}
+
+		var err error
+		password, err = keyFilePassword(password, true)
+		if err != nil {
+			return knoxite.Repository{}, err
+		}
+	}
 	if password == "" {
 		var err error
 		password, err = readPasswordTwice("Enter a password to encrypt this repository with:", "Confirm password:")
@@ -251,6 +401,31 @@ func newRepository(path, password string) (knoxite.Repository, error) {
 	return knoxite.NewRepository(path, password)
 }
 
+// keyFilePassword derives the repository password from the key file. Unless
+// a password is required in addition to the key file, an explicitly given
+// password takes precedence over the key file
+func keyFilePassword(password string, confirm bool) (string, error) {
+	if !globalOpts.KeyFilePassword {
+		if password != "" {
+			return password, nil
+		}
+		return knoxite.PasswordFromKeyFile(globalOpts.KeyFile)
+	}
+
+	if password == "" {
+		var err error
+		if confirm {
+			password, err = readPasswordTwice("Enter a password to use with the key file:", "Confirm password:")
+		} else {
+			password, err = readPassword("Enter password:")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return knoxite.PasswordFromKeyFileAndPassword(globalOpts.KeyFile, password)
+}
+
 func readPassword(prompt string) (string, error) {
 	var tty io.WriteCloser
 	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
@@ -10,6 +10,9 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/muesli/goprogressbar"
 	"github.com/spf13/cobra"
@@ -20,11 +23,29 @@ import (
 
 // Error declarations
 var (
-	ErrTargetMissing = errors.New("please specify a directory to restore to")
+	ErrTargetMissing          = errors.New("please specify a directory to restore to")
+	ErrOverwritePolicyUnknown = errors.New("unknown overwrite policy")
+	ErrInvalidModeMask        = errors.New("mode masks must be octal numbers like 022 or 07077")
 )
 
 type RestoreOptions struct {
-	Excludes []string
+	Excludes              []string
+	Include               []string
+	Exclude               []string
+	BestEffort            bool
+	StripPrefix           string
+	AllowExternalSymlinks bool
+	Overwrite             string
+	Sparse                bool
+	ContinueOnError       bool
+	DryRun                bool
+	Resume                bool
+	PreserveOwnership     bool
+	Checkpoint            bool
+	Parallel              int
+	FileModeMask          string
+	DirModeMask           string
+	Force                 bool
 }
 
 var (
@@ -48,6 +69,22 @@ var (
 
 func initRestoreFlags(f func() *pflag.FlagSet) {
 	f().StringArrayVarP(&restoreOpts.Excludes, "excludes", "x", []string{}, "list of excludes")
+	f().StringArrayVar(&restoreOpts.Include, "include", []string{}, "only restore paths matching these glob patterns, e.g. '**/*.pdf'")
+	f().StringArrayVar(&restoreOpts.Exclude, "exclude", []string{}, "skip paths matching these glob patterns, e.g. 'node_modules/'")
+	f().BoolVar(&restoreOpts.BestEffort, "best-effort", false, "zero-fill data that can't be restored instead of aborting")
+	f().BoolVar(&restoreOpts.AllowExternalSymlinks, "allow-external-symlinks", false, "restore symlinks pointing outside of the destination")
+	f().StringVar(&restoreOpts.Overwrite, "overwrite", "replace", "how to handle existing files: replace, skip, fail, rename or if-newer")
+	f().BoolVar(&restoreOpts.Resume, "resume", false, "continue an interrupted restore, skipping data that has already been restored")
+	f().BoolVar(&restoreOpts.PreserveOwnership, "preserve-ownership", true, "restore the owner and group of files")
+	f().IntVar(&restoreOpts.Parallel, "parallel", 4, "amount of files being restored in parallel")
+	f().BoolVar(&restoreOpts.Checkpoint, "checkpoint", false, "keep track of restored files in a "+knoxite.CheckpointPrefix+"<snapshot> file in the destination, so an interrupted restore can skip them when run again")
+	f().BoolVar(&restoreOpts.DryRun, "dry-run", false, "only show what would be restored")
+	f().BoolVar(&restoreOpts.ContinueOnError, "continue-on-error", false, "keep restoring other files when a file fails to restore")
+	f().BoolVar(&restoreOpts.Sparse, "sparse", false, "don't write blocks of zeros, restoring files as sparse files")
+	f().StringVar(&restoreOpts.FileModeMask, "file-mode-mask", "", "octal mode bits to clear on restored files, e.g. 06022 to drop setuid, setgid and group/other write permissions")
+	f().StringVar(&restoreOpts.DirModeMask, "dir-mode-mask", "", "octal mode bits to clear on restored directories")
+	f().BoolVar(&restoreOpts.Force, "force", false, "restore even if the destination doesn't seem to have enough free space")
+	f().StringVar(&restoreOpts.StripPrefix, "strip-prefix", "", "only restore paths below this prefix, without the prefix itself")
 }
 
 func init() {
@@ -58,12 +95,55 @@ func init() {
 func executeRestore(snapshotID, target string, opts RestoreOptions) error {
 	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err == nil {
+		unlock, lerr := lockRepository(&repository, false)
+		if lerr != nil {
+			return lerr
+		}
+		defer unlock()
+
 		_, snapshot, ferr := repository.FindSnapshot(snapshotID)
 		if ferr != nil {
 			return ferr
 		}
 
-		progress, derr := knoxite.DecodeSnapshot(repository, snapshot, target, opts.Excludes)
+		overwrite, perr := OverwritePolicyFromString(opts.Overwrite)
+		if perr != nil {
+			return perr
+		}
+
+		fileMask, perr := parseModeMask(opts.FileModeMask)
+		if perr != nil {
+			return perr
+		}
+		dirMask, perr := parseModeMask(opts.DirModeMask)
+		if perr != nil {
+			return perr
+		}
+
+		ropts := knoxite.DefaultRestoreOptions()
+		ropts.Overwrite = overwrite
+		ropts.FileModeMask = fileMask
+		ropts.DirModeMask = dirMask
+		ropts.Sparse = opts.Sparse
+		ropts.ContinueOnError = opts.ContinueOnError
+		ropts.DryRun = opts.DryRun
+		ropts.Resume = opts.Resume
+		ropts.PreserveOwnership = opts.PreserveOwnership
+		ropts.Checkpoint = opts.Checkpoint
+		ropts.ArchiveConcurrency = opts.Parallel
+		// the progress bar doesn't need every single update
+		ropts.CoalesceProgress = true
+		ropts.BestEffort = opts.BestEffort
+		ropts.StripPrefix = opts.StripPrefix
+		ropts.Include = opts.Include
+		ropts.Exclude = opts.Exclude
+		ropts.AllowExternalSymlinks = opts.AllowExternalSymlinks
+		ropts.Force = opts.Force
+
+		progress, derr := knoxite.DecodeSnapshot(repository, snapshot, target, opts.Excludes, ropts)
+		if _, ok := derr.(*knoxite.InsufficientSpaceError); ok {
+			return fmt.Errorf("%s. Use --force to restore anyway", derr)
+		}
 		if derr != nil {
 			return derr
 		}
@@ -75,8 +155,21 @@ func executeRestore(snapshotID, target string, opts RestoreOptions) error {
 		for p := range progress {
 			if p.Error != nil {
 				fmt.Println()
+				if _, incomplete := p.Error.(*knoxite.IncompleteRestoreError); opts.ContinueOnError && !incomplete {
+					fmt.Println("Error:", p.Path, p.Error)
+					continue
+				}
 				return p.Error
 			}
+			if p.Warning != nil {
+				fmt.Println()
+				fmt.Println("Warning:", p.Warning)
+				continue
+			}
+			if p.Phase == knoxite.PhaseSkipped {
+				stats.Add(p.TotalStatistics)
+				continue
+			}
 
 			pb.Total = int64(p.CurrentItemStats.Size)
 			pb.Current = int64(p.CurrentItemStats.Transferred)
@@ -93,17 +186,73 @@ func executeRestore(snapshotID, target string, opts RestoreOptions) error {
 				lastPath = p.Path
 				pb.Text = p.Path
 			}
-			if p.CurrentItemStats.Size == p.CurrentItemStats.Transferred {
-				// We have just finished restoring an item
+			if p.Phase == knoxite.PhaseCompleted {
 				stats.Add(p.TotalStatistics)
 			}
 
 			pb.LazyPrint()
 		}
 		fmt.Println()
+		if opts.DryRun {
+			fmt.Println("Dry run done, would restore:", stats.String())
+			return nil
+		}
 		fmt.Println("Restore done:", stats.String())
+		if stats.Skipped > 0 {
+			fmt.Printf("%d items didn't match the filters and were skipped\n", stats.Skipped)
+		}
+		if stats.Reconstructed > 0 {
+			fmt.Printf("Repository is degraded, %d chunks needed reconstruction\n", stats.Reconstructed)
+		}
+		if stats.DedupChunks > 0 {
+			fmt.Printf("Deduplication: %d chunks occurred repeatedly, saving %s\n", stats.DedupChunks, knoxite.SizeToString(stats.DedupSize))
+		}
 		return nil
 	}
 
 	return err
 }
+
+// OverwritePolicyFromString returns the overwrite policy from a user-specified string
+func OverwritePolicyFromString(s string) (knoxite.OverwritePolicy, error) {
+	switch strings.ToLower(s) {
+	case "":
+		// default is replacing existing files
+		fallthrough
+	case "replace":
+		return knoxite.OverwriteReplace, nil
+	case "skip":
+		return knoxite.OverwriteSkip, nil
+	case "fail":
+		return knoxite.OverwriteFail, nil
+	case "rename":
+		return knoxite.OverwriteRename, nil
+	case "if-newer":
+		return knoxite.OverwriteIfNewer, nil
+	}
+
+	return 0, ErrOverwritePolicyUnknown
+}
+
+// parseModeMask converts an octal, umask-style mode mask to an os.FileMode
+func parseModeMask(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 07777 {
+		return 0, ErrInvalidModeMask
+	}
+
+	mode := os.FileMode(m).Perm()
+	if m&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
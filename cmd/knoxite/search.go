@@ -0,0 +1,151 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/muesli/gotable"
+	"github.com/spf13/cobra"
+
+	"github.com/knoxite/knoxite"
+)
+
+// Error declarations
+var (
+	ErrSearchTypeUnknown = errors.New("unknown type, must be file, dir or symlink")
+	ErrSearchTimeInvalid = errors.New("times must be formatted like 2006-01-02 or 2006-01-02 15:04:05")
+)
+
+type SearchOptions struct {
+	Name    string
+	MinSize uint64
+	MaxSize uint64
+	After   string
+	Before  string
+	Types   []string
+}
+
+var (
+	searchOpts = SearchOptions{}
+
+	searchCmd = &cobra.Command{
+		Use:   "search [snapshot]",
+		Short: "search for files",
+		Long:  `The search command finds files in a snapshot or, without a snapshot, in all snapshots of the repository`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("search takes at most one snapshot ID")
+			}
+			snapshotID := ""
+			if len(args) == 1 {
+				snapshotID = args[0]
+			}
+			return executeSearch(snapshotID, searchOpts)
+		},
+	}
+)
+
+func init() {
+	searchCmd.Flags().StringVar(&searchOpts.Name, "name", "", "glob the paths have to match, e.g. '*.pdf'")
+	searchCmd.Flags().Uint64Var(&searchOpts.MinSize, "min-size", 0, "minimum size in bytes")
+	searchCmd.Flags().Uint64Var(&searchOpts.MaxSize, "max-size", 0, "maximum size in bytes")
+	searchCmd.Flags().StringVar(&searchOpts.After, "after", "", "only files modified after this time")
+	searchCmd.Flags().StringVar(&searchOpts.Before, "before", "", "only files modified before this time")
+	searchCmd.Flags().StringArrayVar(&searchOpts.Types, "type", []string{}, "only items of this type: file, dir or symlink")
+	RootCmd.AddCommand(searchCmd)
+}
+
+// parseSearchTime parses a date with an optional time of day
+func parseSearchTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{timeFormat, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrSearchTimeInvalid
+}
+
+func searchQuery(opts SearchOptions) (knoxite.SearchQuery, error) {
+	query := knoxite.SearchQuery{
+		Name:    opts.Name,
+		MinSize: opts.MinSize,
+		MaxSize: opts.MaxSize,
+	}
+
+	var err error
+	if query.ModifiedAfter, err = parseSearchTime(opts.After); err != nil {
+		return query, err
+	}
+	if query.ModifiedBefore, err = parseSearchTime(opts.Before); err != nil {
+		return query, err
+	}
+
+	for _, t := range opts.Types {
+		switch t {
+		case "file":
+			query.Types = append(query.Types, knoxite.File)
+		case "dir":
+			query.Types = append(query.Types, knoxite.Directory)
+		case "symlink":
+			query.Types = append(query.Types, knoxite.SymLink)
+		default:
+			return query, ErrSearchTypeUnknown
+		}
+	}
+
+	return query, nil
+}
+
+func executeSearch(snapshotID string, opts SearchOptions) error {
+	query, err := searchQuery(opts)
+	if err != nil {
+		return err
+	}
+
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+
+	var results []knoxite.SearchResult
+	if snapshotID != "" {
+		volume, snapshot, ferr := repository.FindSnapshot(snapshotID)
+		if ferr != nil {
+			return ferr
+		}
+		results, err = knoxite.SearchSnapshot(snapshot, query)
+		for i := range results {
+			results[i].VolumeID = volume.ID
+		}
+	} else {
+		results, err = knoxite.SearchRepository(&repository, query)
+	}
+	if err != nil {
+		return err
+	}
+
+	tab := gotable.NewTable([]string{"Volume", "Snapshot", "Size", "ModTime", "Name"},
+		[]int64{-8, -8, 12, -19, -48},
+		"No files found.")
+	for _, res := range results {
+		tab.AppendRow([]interface{}{
+			res.VolumeID,
+			res.SnapshotID,
+			knoxite.SizeToString(res.Archive.Size),
+			time.Unix(res.Archive.ModTime, 0).Format(timeFormat),
+			res.Archive.Path})
+	}
+
+	return tab.Print()
+}
@@ -0,0 +1,58 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/knoxite/knoxite"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveCmd = &cobra.Command{
+		Use:   "serve <snapshot>",
+		Short: "serve a snapshot via HTTP",
+		Long:  `The serve command makes the files of a snapshot browsable via HTTP, without restoring them`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("serve needs a snapshot ID to work on")
+			}
+			return executeServe(args[0], serveAddr)
+		},
+	}
+
+	serveAddr string
+)
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "listen", "localhost:8080", "address to listen on")
+	RootCmd.AddCommand(serveCmd)
+}
+
+func executeServe(snapshotID, addr string) error {
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockRepository(&repository, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, snapshot, err := repository.FindSnapshot(snapshotID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Serving snapshot %s on http://%s\n", snapshot.ID, addr)
+	return http.ListenAndServe(addr, http.FileServer(knoxite.SnapshotFS(repository, snapshot)))
+}
@@ -9,6 +9,9 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/muesli/gotable"
 	"github.com/spf13/cobra"
@@ -45,11 +48,74 @@ var (
 			return executeSnapshotRemove(args[0])
 		},
 	}
+	snapshotDiffCmd = &cobra.Command{
+		Use:   "diff <snapshot> <snapshot>",
+		Short: "show the changes between two snapshots",
+		Long:  `The diff command lists the items added, removed or modified between two snapshots`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("diff needs two snapshot IDs to work on")
+			}
+			return executeSnapshotDiff(args[0], args[1])
+		},
+	}
+	snapshotTagCmd = &cobra.Command{
+		Use:   "tag <snapshot> <tag> [...]",
+		Short: "tag a snapshot",
+		Long:  `The tag command adds tags to a snapshot`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("tag needs a snapshot ID and at least one tag")
+			}
+			return executeSnapshotTag(args[0], args[1:], false)
+		},
+	}
+	snapshotUntagCmd = &cobra.Command{
+		Use:   "untag <snapshot> <tag> [...]",
+		Short: "remove tags from a snapshot",
+		Long:  `The untag command removes tags from a snapshot`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("untag needs a snapshot ID and at least one tag")
+			}
+			return executeSnapshotTag(args[0], args[1:], true)
+		},
+	}
+	snapshotExportCmd = &cobra.Command{
+		Use:   "export <snapshot> [file]",
+		Short: "export a snapshot's metadata as JSON or its content as tar or zip archive",
+		Long: `The export command writes the metadata of a snapshot, like its files, sizes and chunks, as JSON to a file or stdout.
+With --tar or --zip the snapshot's entire content gets written as tar or zip archive instead`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				return fmt.Errorf("export needs a snapshot ID to work on")
+			}
+			var file string
+			if len(args) == 2 {
+				file = args[1]
+			}
+			if exportTar && exportZip {
+				return fmt.Errorf("only one of --tar and --zip can be used")
+			}
+			return executeSnapshotExport(args[0], file)
+		},
+	}
+
+	exportTar bool
+	exportZip bool
+	listTags  []string
 )
 
 func init() {
+	snapshotListCmd.Flags().StringArrayVar(&listTags, "tag", []string{}, "only list snapshots with this tag")
 	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotTagCmd)
+	snapshotCmd.AddCommand(snapshotUntagCmd)
+	snapshotExportCmd.Flags().BoolVar(&exportTar, "tar", false, "export the snapshot's content as tar archive")
+	snapshotExportCmd.Flags().BoolVar(&exportZip, "zip", false, "export the snapshot's content as zip archive")
+	snapshotCmd.AddCommand(snapshotExportCmd)
 	snapshotCmd.AddCommand(snapshotRemoveCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
 	RootCmd.AddCommand(snapshotCmd)
 }
 
@@ -58,6 +124,11 @@ func executeSnapshotRemove(snapshotID string) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	chunkIndex, err := knoxite.OpenChunkIndex(&repository)
 	if err != nil {
 		return err
@@ -89,6 +160,41 @@ func executeSnapshotRemove(snapshotID string) error {
 	return nil
 }
 
+func executeSnapshotTag(snapshotID string, tags []string, remove bool) error {
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockRepository(&repository, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	volume, snapshot, err := repository.FindSnapshot(snapshotID)
+	if err != nil {
+		return err
+	}
+
+	if remove {
+		err = volume.RemoveTags(snapshot.ID, tags...)
+	} else {
+		err = volume.AddTags(snapshot.ID, tags...)
+	}
+	if err != nil {
+		return err
+	}
+
+	// only the repository's metadata changes, the snapshot stays untouched
+	err = repository.Save()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot %s tags: %s\n", snapshot.ID, strings.Join(volume.SnapshotTags(snapshot.ID), ", "))
+	return nil
+}
+
 func executeSnapshotList(volID string) error {
 	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err != nil {
@@ -100,12 +206,12 @@ func executeSnapshotList(volID string) error {
 		return err
 	}
 
-	tab := gotable.NewTable([]string{"ID", "Date", "Original Size", "Storage Size", "Description"},
-		[]int64{-8, -19, 13, 12, -48}, "No snapshots found. This volume is empty.")
+	tab := gotable.NewTable([]string{"ID", "Date", "Original Size", "Storage Size", "Tags", "Description"},
+		[]int64{-8, -19, 13, 12, -24, -48}, "No snapshots found. This volume is empty.")
 	totalSize := uint64(0)
 	totalStorageSize := uint64(0)
 
-	for _, snapshotID := range volume.Snapshots {
+	for _, snapshotID := range volume.SnapshotsWithTags(listTags...) {
 		snapshot, err := volume.LoadSnapshot(snapshotID, &repository)
 		if err != nil {
 			return err
@@ -115,12 +221,81 @@ func executeSnapshotList(volID string) error {
 			snapshot.Date.Format(timeFormat),
 			knoxite.SizeToString(snapshot.Stats.Size),
 			knoxite.SizeToString(snapshot.Stats.StorageSize),
+			strings.Join(snapshot.Tags, ","),
 			snapshot.Description})
 		totalSize += snapshot.Stats.Size
 		totalStorageSize += snapshot.Stats.StorageSize
 	}
 
-	tab.SetSummary([]interface{}{"", "", knoxite.SizeToString(totalSize), knoxite.SizeToString(totalStorageSize), ""})
+	tab.SetSummary([]interface{}{"", "", knoxite.SizeToString(totalSize), knoxite.SizeToString(totalStorageSize), "", ""})
 	_ = tab.Print()
 	return nil
 }
+
+func executeSnapshotDiff(snapshotA, snapshotB string) error {
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+
+	diff, err := knoxite.DiffSnapshots(repository, snapshotA, snapshotB)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range diff {
+		switch e.Change {
+		case knoxite.Added:
+			fmt.Println("+", e.Path)
+		case knoxite.Removed:
+			fmt.Println("-", e.Path)
+		case knoxite.Modified:
+			fmt.Println("M", e.Path)
+		case knoxite.TypeChanged:
+			fmt.Println("T", e.Path)
+		}
+	}
+	return nil
+}
+
+func executeSnapshotExport(snapshotID, file string) error {
+	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
+	if err != nil {
+		return err
+	}
+	if exportTar || exportZip {
+		unlock, err := lockRepository(&repository, false)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	_, snapshot, err := repository.FindSnapshot(snapshotID)
+	if err != nil {
+		return err
+	}
+
+	export := func(w io.Writer) error {
+		switch {
+		case exportTar:
+			return knoxite.ExportTar(repository, snapshot, w)
+		case exportZip:
+			return knoxite.ExportZip(repository, snapshot, w)
+		}
+		return knoxite.ExportSnapshot(w, snapshot)
+	}
+	if file == "" {
+		return export(os.Stdout)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = export(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
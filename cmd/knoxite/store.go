@@ -38,6 +38,7 @@ type StoreOptions struct {
 	Encryption       string
 	FailureTolerance uint
 	Excludes         []string
+	Tags             []string
 }
 
 var (
@@ -61,10 +62,11 @@ var (
 
 func initStoreFlags(f func() *pflag.FlagSet) {
 	f().StringVarP(&storeOpts.Description, "desc", "d", "", "a description or comment for this volume")
-	f().StringVarP(&storeOpts.Compression, "compression", "c", "", "compression algo to use: none (default), flate, gzip, lzma, zlib, zstd")
-	f().StringVarP(&storeOpts.Encryption, "encryption", "e", "", "encryption algo to use: aes (default), none")
+	f().StringVarP(&storeOpts.Compression, "compression", "c", "", "compression algo to use: none (default), flate, gzip, lzma, zlib, zstd, brotli")
+	f().StringVarP(&storeOpts.Encryption, "encryption", "e", "", "encryption algo to use: aes (default), aes-gcm, chacha20, none")
 	f().UintVarP(&storeOpts.FailureTolerance, "tolerance", "t", 0, "failure tolerance against n backend failures")
 	f().StringArrayVarP(&storeOpts.Excludes, "excludes", "x", []string{}, "list of excludes")
+	f().StringArrayVar(&storeOpts.Tags, "tag", []string{}, "tag the snapshot, e.g. 'pre-upgrade'")
 }
 
 func init() {
@@ -143,6 +145,9 @@ func store(repository *knoxite.Repository, chunkIndex *knoxite.ChunkIndex, snaps
 				knoxite.SizeToString(uint64(overallProgressBar.Total)),
 				humanize.Comma(items),
 				humanize.Comma(int64(p.TotalStatistics.Files+p.TotalStatistics.Dirs+p.TotalStatistics.SymLinks)))
+			if p.ETA > 0 {
+				overallProgressBar.Text += fmt.Sprintf(", %s left", p.ETA.Round(time.Second))
+			}
 
 			if p.Path != lastPath {
 				lastPath = p.Path
@@ -175,6 +180,11 @@ func executeStore(volumeID string, args []string, opts StoreOptions) error {
 	if err != nil {
 		return err
 	}
+	unlock, err := lockRepository(&repository, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	volume, err := repository.FindVolume(volumeID)
 	if err != nil {
 		return err
@@ -210,6 +220,10 @@ func executeStore(volumeID string, args []string, opts StoreOptions) error {
 	if err != nil {
 		return err
 	}
+	err = volume.AddTags(snapshot.ID, opts.Tags...)
+	if err != nil {
+		return err
+	}
 	err = chunkIndex.Save(&repository)
 	if err != nil {
 		return err
@@ -235,6 +249,8 @@ func CompressionTypeFromString(s string) (uint16, error) {
 		return knoxite.CompressionZlib, nil
 	case "zstd":
 		return knoxite.CompressionZstd, nil
+	case "brotli":
+		return knoxite.CompressionBrotli, nil
 	}
 
 	return 0, ErrCompressionUnknown
@@ -255,6 +271,8 @@ func CompressionText(enum int) string {
 		return "zlib"
 	case knoxite.CompressionZstd:
 		return "zstd"
+	case knoxite.CompressionBrotli:
+		return "Brotli"
 	}
 
 	return "unknown"
@@ -268,6 +286,10 @@ func EncryptionTypeFromString(s string) (uint16, error) {
 		fallthrough
 	case "aes":
 		return knoxite.EncryptionAES, nil
+	case "aes-gcm":
+		return knoxite.EncryptionAESGCM, nil
+	case "chacha20":
+		return knoxite.EncryptionChaCha20, nil
 	case "none":
 		return knoxite.EncryptionNone, nil
 	}
@@ -282,6 +304,10 @@ func EncryptionText(enum int) string {
 		return "none"
 	case knoxite.EncryptionAES:
 		return "AES"
+	case knoxite.EncryptionChaCha20:
+		return "ChaCha20-Poly1305"
+	case knoxite.EncryptionAESGCM:
+		return "AES-256-GCM"
 	}
 
 	return "unknown"
@@ -52,6 +52,12 @@ func executeVerifyRepo(opts VerifyOptions) error {
 	errors := make([]error, 0)
 	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err == nil {
+		unlock, lerr := lockRepository(&repository, false)
+		if lerr != nil {
+			return lerr
+		}
+		defer unlock()
+
 		progress, err := knoxite.VerifyRepo(repository, opts.Percentage)
 		if err != nil {
 			errors = append(errors, err)
@@ -60,12 +66,19 @@ func executeVerifyRepo(opts VerifyOptions) error {
 
 		pb := &goprogressbar.ProgressBar{Total: 1000, Width: 40}
 		lastPath := ""
+		var stats knoxite.Stats
 
 		for p := range progress {
 			if p.Error != nil {
 				fmt.Println()
 				errors = append(errors, p.Error)
 			}
+			stats = p.TotalStatistics
+			if p.Warning != nil {
+				fmt.Println()
+				fmt.Println("Warning:", p.Warning)
+				continue
+			}
 
 			pb.Total = int64(p.CurrentItemStats.Size)
 			pb.Current = int64(p.CurrentItemStats.Transferred)
@@ -86,7 +99,13 @@ func executeVerifyRepo(opts VerifyOptions) error {
 
 		}
 		fmt.Println()
-		fmt.Printf("Verify done: %d errors\n", len(errors))
+		fmt.Printf("Verify done: %d errors, %d chunks ok, %d chunks corrupted\n", len(errors), stats.Chunks, stats.Errors)
+		if stats.Reconstructed > 0 {
+			fmt.Printf("Repository is degraded, %d chunks needed reconstruction\n", stats.Reconstructed)
+		}
+		if stats.DedupChunks > 0 {
+			fmt.Printf("Deduplication: %d chunks occurred repeatedly, saving %s\n", stats.DedupChunks, knoxite.SizeToString(stats.DedupSize))
+		}
 		return nil
 	}
 	return err
@@ -96,6 +115,12 @@ func executeVerifyVolume(volumeId string, opts VerifyOptions) error {
 	errors := make([]error, 0)
 	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err == nil {
+		unlock, lerr := lockRepository(&repository, false)
+		if lerr != nil {
+			return lerr
+		}
+		defer unlock()
+
 		progress, err := knoxite.VerifyVolume(repository, volumeId, opts.Percentage)
 		if err != nil {
 			errors = append(errors, err)
@@ -104,12 +129,19 @@ func executeVerifyVolume(volumeId string, opts VerifyOptions) error {
 
 		pb := &goprogressbar.ProgressBar{Total: 1000, Width: 40}
 		lastPath := ""
+		var stats knoxite.Stats
 
 		for p := range progress {
 			if p.Error != nil {
 				fmt.Println()
 				errors = append(errors, p.Error)
 			}
+			stats = p.TotalStatistics
+			if p.Warning != nil {
+				fmt.Println()
+				fmt.Println("Warning:", p.Warning)
+				continue
+			}
 
 			pb.Total = int64(p.CurrentItemStats.Size)
 			pb.Current = int64(p.CurrentItemStats.Transferred)
@@ -130,7 +162,13 @@ func executeVerifyVolume(volumeId string, opts VerifyOptions) error {
 
 		}
 		fmt.Println()
-		fmt.Printf("Verify done: %d errors\n", len(errors))
+		fmt.Printf("Verify done: %d errors, %d chunks ok, %d chunks corrupted\n", len(errors), stats.Chunks, stats.Errors)
+		if stats.Reconstructed > 0 {
+			fmt.Printf("Repository is degraded, %d chunks needed reconstruction\n", stats.Reconstructed)
+		}
+		if stats.DedupChunks > 0 {
+			fmt.Printf("Deduplication: %d chunks occurred repeatedly, saving %s\n", stats.DedupChunks, knoxite.SizeToString(stats.DedupSize))
+		}
 		return nil
 	}
 	return err
@@ -140,6 +178,12 @@ func executeVerifySnapshot(volumeId string, snapshotId string, opts VerifyOption
 	errors := make([]error, 0)
 	repository, err := openRepository(globalOpts.Repo, globalOpts.Password)
 	if err == nil {
+		unlock, lerr := lockRepository(&repository, false)
+		if lerr != nil {
+			return lerr
+		}
+		defer unlock()
+
 		progress, err := knoxite.VerifySnapshot(repository, snapshotId, opts.Percentage)
 		if err != nil {
 			errors = append(errors, err)
@@ -148,12 +192,19 @@ func executeVerifySnapshot(volumeId string, snapshotId string, opts VerifyOption
 
 		pb := &goprogressbar.ProgressBar{Total: 1000, Width: 40}
 		lastPath := ""
+		var stats knoxite.Stats
 
 		for p := range progress {
 			if p.Error != nil {
 				fmt.Println()
 				errors = append(errors, p.Error)
 			}
+			stats = p.TotalStatistics
+			if p.Warning != nil {
+				fmt.Println()
+				fmt.Println("Warning:", p.Warning)
+				continue
+			}
 
 			pb.Total = int64(p.CurrentItemStats.Size)
 			pb.Current = int64(p.CurrentItemStats.Transferred)
@@ -174,7 +225,13 @@ func executeVerifySnapshot(volumeId string, snapshotId string, opts VerifyOption
 
 		}
 		fmt.Println()
-		fmt.Printf("Verify done: %d errors\n", len(errors))
+		fmt.Printf("Verify done: %d errors, %d chunks ok, %d chunks corrupted\n", len(errors), stats.Chunks, stats.Errors)
+		if stats.Reconstructed > 0 {
+			fmt.Printf("Repository is degraded, %d chunks needed reconstruction\n", stats.Reconstructed)
+		}
+		if stats.DedupChunks > 0 {
+			fmt.Printf("Deduplication: %d chunks occurred repeatedly, saving %s\n", stats.DedupChunks, knoxite.SizeToString(stats.DedupSize))
+		}
 		return nil
 	}
 	return err
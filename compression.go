@@ -16,6 +16,7 @@ import (
 	"io"
 	"io/ioutil"
 
+	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
 	"github.com/ulikunitz/xz"
 )
@@ -28,6 +29,7 @@ const (
 	CompressionFlate
 	CompressionZlib
 	CompressionZstd
+	CompressionBrotli
 )
 
 // Compressor is a pipeline processor that compresses data
@@ -54,6 +56,8 @@ func (c Compressor) Process(data []byte) ([]byte, error) {
 		w = zlib.NewWriter(&buf)
 	case CompressionZstd:
 		w, err = zstd.NewWriter(&buf)
+	case CompressionBrotli:
+		w = brotli.NewWriter(&buf)
 	}
 	if err != nil {
 		return []byte{}, err
@@ -81,31 +85,37 @@ type Decompressor struct {
 
 // Process decompresses the data
 func (c Decompressor) Process(data []byte) ([]byte, error) {
-	var zr io.ReadCloser
-	var err error
+	if c.Method == CompressionNone {
+		return data, nil
+	}
+
+	zr, err := c.Reader(bytes.NewReader(data))
+	if err != nil {
+		return []byte{}, err
+	}
+	defer zr.Close()
+
+	return ioutil.ReadAll(zr)
+}
 
+// Reader returns a reader decompressing the data read from r
+func (c Decompressor) Reader(r io.Reader) (io.ReadCloser, error) {
 	switch c.Method {
-	case CompressionNone:
-		return data, nil
 	case CompressionFlate:
-		zr = flate.NewReader(bytes.NewReader(data))
+		return flate.NewReader(r), nil
 	case CompressionGZip:
-		zr, err = gzip.NewReader(bytes.NewReader(data))
+		return gzip.NewReader(r)
 	case CompressionLZMA:
-		zri, erri := xz.NewReader(bytes.NewReader(data))
-		zr = ioutil.NopCloser(zri)
-		err = erri
+		zr, err := xz.NewReader(r)
+		return ioutil.NopCloser(zr), err
 	case CompressionZlib:
-		zr, err = zlib.NewReader(bytes.NewReader(data))
+		return zlib.NewReader(r)
 	case CompressionZstd:
-		zri, erri := zstd.NewReader(bytes.NewReader(data))
-		zr = ioutil.NopCloser(zri)
-		err = erri
+		zr, err := zstd.NewReader(r)
+		return ioutil.NopCloser(zr), err
+	case CompressionBrotli:
+		return ioutil.NopCloser(brotli.NewReader(r)), nil
 	}
-	if err != nil {
-		return []byte{}, err
-	}
-	defer zr.Close()
 
-	return ioutil.ReadAll(zr)
+	return ioutil.NopCloser(r), nil
 }
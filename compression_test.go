@@ -0,0 +1,57 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	b := bytes.Repeat([]byte("knoxite compresses data "), 1024)
+
+	for _, method := range []uint16{CompressionNone, CompressionGZip, CompressionLZMA, CompressionFlate, CompressionZlib, CompressionZstd, CompressionBrotli} {
+		bc, err := Compressor{Method: method}.Process(b)
+		if err != nil {
+			t.Errorf("Failed compressing data with method %d: %s", method, err)
+			continue
+		}
+		if method != CompressionNone && len(bc) >= len(b) {
+			t.Errorf("Expected method %d to compress data, got %d out of %d bytes", method, len(bc), len(b))
+		}
+
+		bd, err := Decompressor{Method: method}.Process(bc)
+		if err != nil {
+			t.Errorf("Failed decompressing data with method %d: %s", method, err)
+			continue
+		}
+		if !bytes.Equal(b, bd) {
+			t.Errorf("Data mismatch after compression & decompression cycle with method %d", method)
+		}
+	}
+}
+
+func TestCompressionBrotliRatio(t *testing.T) {
+	var b []byte
+	for i := 0; i < 1000; i++ {
+		b = append(b, []byte(`{"id":`+strconv.Itoa(i)+`,"name":"knoxite","tags":["backup","storage"],"html":"<p class=\"entry\">`+strconv.Itoa(i*i)+`</p>"}`)...)
+	}
+
+	gz, err := Compressor{Method: CompressionGZip}.Process(b)
+	if err != nil {
+		t.Fatalf("Failed compressing data with gzip: %s", err)
+	}
+	br, err := Compressor{Method: CompressionBrotli}.Process(b)
+	if err != nil {
+		t.Fatalf("Failed compressing data with brotli: %s", err)
+	}
+	if len(br) >= len(gz) {
+		t.Errorf("Expected brotli to beat gzip, got %d and %d bytes", len(br), len(gz))
+	}
+}
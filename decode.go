@@ -10,9 +10,14 @@ package knoxite
 import (
 	"bufio"
 	"bytes"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -58,46 +63,760 @@ type DataReconstructionError struct {
 	Chunk          Chunk
 	BlocksFound    uint
 	FailedBackends uint
+	MissingParts   []uint // indices of the parts that couldn't be loaded
+	Offset         int    // offset of the chunk's data within its archive, if known
 }
 
 func (e *DataReconstructionError) Error() string {
-	return fmt.Sprintf("Could not reconstruct data, got %d out of %d chunks (%d backends missing data)", e.BlocksFound, e.Chunk.DataParts, e.FailedBackends)
+	return fmt.Sprintf("Could not reconstruct data, got %d out of %d chunks (%d backends missing data, missing parts: %v)", e.BlocksFound, e.Chunk.DataParts, e.FailedBackends, e.MissingParts)
+}
+
+// DataGapError records a range of an archive that could not be restored and
+// was filled with zeros instead
+type DataGapError struct {
+	Path   string
+	Offset int
+	Size   int
+	Err    error
+}
+
+func (e *DataGapError) Error() string {
+	return fmt.Sprintf("%s: bytes %d-%d could not be restored and were zero-filled: %s", e.Path, e.Offset, e.Offset+e.Size, e.Err)
+}
+
+// ReconstructionWarning records a chunk that was restored successfully, but
+// had to be reconstructed because some of its parts were missing
+type ReconstructionWarning struct {
+	Path         string
+	Offset       int
+	Chunk        Chunk
+	MissingParts []uint // indices of the parts that couldn't be loaded
+}
+
+func (e *ReconstructionWarning) Error() string {
+	return fmt.Sprintf("%s: reconstructed chunk %s at offset %d, %d out of %d parts missing: %v", e.Path, e.Chunk.Hash, e.Offset, len(e.MissingParts), e.Chunk.DataParts+e.Chunk.ParityParts, e.MissingParts)
+}
+
+// ModeError records an archive that was stored without any permission bits
+// and the mode it got restored with instead
+type ModeError struct {
+	Path string
+	Mode os.FileMode
+}
+
+func (e *ModeError) Error() string {
+	return fmt.Sprintf("%s has no valid permission bits, restoring it with mode %s", e.Path, e.Mode)
+}
+
+// OwnershipError records an archive whose ownership could not be restored,
+// because of missing privileges
+type OwnershipError struct {
+	Path string
+	UID  uint32
+	GID  uint32
+	Err  error
+}
+
+func (e *OwnershipError) Error() string {
+	return fmt.Sprintf("%s: can't restore ownership %d:%d: %v", e.Path, e.UID, e.GID, e.Err)
+}
+
+// RestorePathError records an archive whose path would be restored outside of
+// the destination directory
+type RestorePathError struct {
+	Path string
+	Dst  string
+}
+
+func (e *RestorePathError) Error() string {
+	return fmt.Sprintf("%s would be restored outside of %s", e.Path, e.Dst)
+}
+
+// IncompleteRestoreError records how many archives of a snapshot could not be
+// restored
+type IncompleteRestoreError struct {
+	Failed int
+	Total  int
+}
+
+func (e *IncompleteRestoreError) Error() string {
+	return fmt.Sprintf("%d of %d archives could not be restored", e.Failed, e.Total)
+}
+
+// InsufficientSpaceError records a restore that wouldn't fit into the free
+// space at its destination
+type InsufficientSpaceError struct {
+	Path      string
+	Required  uint64
+	Available uint64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("Not enough free space to restore to %s: %s required, only %s available",
+		e.Path, SizeToString(e.Required), SizeToString(e.Available))
+}
+
+// ExistError records an archive whose path already exists at the destination
+type ExistError struct {
+	Path string
+}
+
+func (e *ExistError) Error() string {
+	return fmt.Sprintf("%s already exists", e.Path)
+}
+
+// OverwritePolicy decides what happens to existing files when restoring
+type OverwritePolicy int
+
+// Available overwrite policies
+const (
+	OverwriteReplace OverwritePolicy = iota // Replace existing files, truncating them
+	OverwriteSkip                           // Leave existing files untouched
+	OverwriteFail                           // Abort with an ExistError
+	OverwriteRename                         // Move existing files aside
+	OverwriteIfNewer                        // Replace existing files older than the archive
+)
+
+// RestoreOptions configures how archives get restored
+type RestoreOptions struct {
+	// DefaultFileMode is used for files stored without any permission bits
+	DefaultFileMode os.FileMode
+	// DefaultDirMode is used for directories stored without any permission bits
+	DefaultDirMode os.FileMode
+	// FileModeMask gets cleared from the modes of restored files, like a
+	// umask. It may include os.ModeSetuid, os.ModeSetgid and os.ModeSticky.
+	// Defaults to preserving the stored modes
+	FileModeMask os.FileMode
+	// DirModeMask gets cleared from the modes of restored directories
+	DirModeMask os.FileMode
+	// Concurrency is the amount of chunks being loaded in parallel
+	Concurrency int
+	// ArchiveConcurrency is the amount of files and symlinks of a snapshot
+	// being restored in parallel. Directories get restored beforehand
+	ArchiveConcurrency int
+	// BestEffort zero-fills chunks which could not be loaded, instead of
+	// aborting the restore of the entire file. Every gap gets reported as a
+	// DataGapError warning
+	BestEffort bool
+	// ContinueOnError reports archives failing to restore as progress errors
+	// and carries on with the next archive. Once done, an
+	// IncompleteRestoreError gets reported if any archive failed
+	ContinueOnError bool
+	// AllowExternalSymlinks permits restoring symlinks pointing outside of the
+	// destination directory. Only enable this for trusted repositories
+	AllowExternalSymlinks bool
+	// StripPrefix gets removed from the archive paths before joining them
+	// with the destination. Archives outside of this prefix are skipped
+	StripPrefix string
+	// Include restricts restoring a snapshot to the archives whose paths match
+	// any of these glob patterns. "**" matches any number of path elements,
+	// patterns without a slash match at any depth and patterns matching a
+	// directory include its content, too. Empty means all archives
+	Include []string
+	// Exclude skips archives whose paths match any of these glob patterns,
+	// even if they're included
+	Exclude []string
+	// Resume continues restoring existing files after their last chunk that
+	// has already been restored correctly, instead of overwriting them
+	Resume bool
+	// Checkpoint keeps track of the archives restored completely in a file in
+	// the destination directory, named CheckpointPrefix followed by the
+	// snapshot's ID. Restoring the same snapshot again after an interruption
+	// skips them. The file gets removed once the restore finished without
+	// errors, otherwise it's left behind in the destination. Disabled by
+	// default
+	Checkpoint bool
+	// ProgressBuffer is the capacity of the progress channel DecodeSnapshot
+	// returns
+	ProgressBuffer int
+	// CoalesceProgress replaces progress updates the consumer hasn't received
+	// yet with newer ones for the same item, so a slow consumer never
+	// throttles the restore. See CoalesceProgress
+	CoalesceProgress bool
+	// DryRun reports the progress of a restore without loading any chunks or
+	// writing to the filesystem
+	DryRun bool
+	// Sparse skips writing blocks of zeros, leaving holes in the restored
+	// files. On filesystems not supporting sparse files all data gets written
+	Sparse bool
+	// PreserveOwnership restores the owner and group of archives. Failing to
+	// do so for a lack of privileges gets reported as an OwnershipError
+	// warning instead of failing the restore
+	PreserveOwnership bool
+	// Overwrite decides how existing files, symlinks and hardlinks get
+	// handled. Defaults to OverwriteReplace
+	Overwrite OverwritePolicy
+
+	// Force skips checking whether the destination has enough free space for
+	// the restore, e.g. when restoring sparse files or to a compressing
+	// filesystem
+	Force bool
+
+	// deferDirModes keeps restored directories writable for their owner.
+	// DecodeSnapshot applies their modes once their content is in place
+	deferDirModes bool
+	// seen is shared by all archives DecodeSnapshot restores, so chunks
+	// occurring in several files count as deduplicated, too. Without it
+	// duplicates only get counted within a single archive
+	seen *seenChunks
+}
+
+// DefaultRestoreOptions returns the RestoreOptions used for a regular restore
+func DefaultRestoreOptions() RestoreOptions {
+	return RestoreOptions{
+		DefaultFileMode:    0644,
+		DefaultDirMode:     0755,
+		Concurrency:        runtime.GOMAXPROCS(0),
+		ArchiveConcurrency: 4,
+		PreserveOwnership:  true,
+	}
+}
+
+// prepareRestorePath applies the overwrite policy to an item existing at
+// path. It returns false if the archive should not be restored. In dry-run
+// mode existing items only get reported
+func prepareRestorePath(progress chan Progress, arc *Archive, path string, opts RestoreOptions) (bool, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch opts.Overwrite {
+	case OverwriteSkip:
+		progress <- newProgressWarning(arc, &ExistError{path})
+		return false, nil
+	case OverwriteIfNewer:
+		if fi.ModTime().Unix() >= arc.ModTime {
+			progress <- newProgressWarning(arc, &ExistError{path})
+			return false, nil
+		}
+	case OverwriteFail:
+		return false, &ExistError{path}
+	}
+	if opts.DryRun {
+		// only report what would get replaced or moved aside
+		progress <- newProgressWarning(arc, &ExistError{path})
+		return true, nil
+	}
+
+	if opts.Overwrite == OverwriteRename {
+		aside := path + ".orig"
+		for i := 1; ; i++ {
+			if _, err := os.Lstat(aside); os.IsNotExist(err) {
+				break
+			}
+			aside = fmt.Sprintf("%s.orig%d", path, i)
+		}
+		return true, os.Rename(path, aside)
+	}
+
+	// existing regular files get truncated when being opened, everything else
+	// has to be removed first, so we never write through a symlink
+	if arc.Type != File || arc.LinkTarget != "" || !fi.Mode().IsRegular() {
+		return true, os.Remove(path)
+	}
+	return true, nil
+}
+
+// restoreMode returns the mode an archive should be restored with, with the
+// mode masks configured in opts applied. Archives stored with a zero or
+// otherwise invalid mode fall back to the defaults configured in opts, in
+// which case the second return value is true
+func restoreMode(arc Archive, opts RestoreOptions) (os.FileMode, bool) {
+	mode := arc.Mode
+	substituted := false
+	if mode.Perm() == 0 {
+		switch arc.Type {
+		case File:
+			mode |= opts.DefaultFileMode.Perm()
+			substituted = true
+		case Directory:
+			mode |= opts.DefaultDirMode.Perm()
+			substituted = true
+		}
+	}
+
+	switch arc.Type {
+	case File:
+		mode &^= opts.FileModeMask
+	case Directory:
+		mode &^= opts.DirModeMask
+	}
+
+	return mode, substituted
 }
 
 // DecodeSnapshot restores an entire snapshot to dst
-func DecodeSnapshot(repository Repository, snapshot *Snapshot, dst string, excludes []string) (prog chan Progress, err error) {
-	prog = make(chan Progress)
+func DecodeSnapshot(repository Repository, snapshot *Snapshot, dst string, excludes []string, opts RestoreOptions) (prog chan Progress, err error) {
+	for _, exclude := range excludes {
+		if _, err := filepath.Match(exclude, ""); err != nil {
+			return nil, fmt.Errorf("Invalid exclude filter: %s", exclude)
+		}
+	}
+	for _, include := range opts.Include {
+		if !validGlob(include) {
+			return nil, fmt.Errorf("Invalid include filter: %s", include)
+		}
+	}
+	for _, exclude := range opts.Exclude {
+		if !validGlob(exclude) {
+			return nil, fmt.Errorf("Invalid exclude filter: %s", exclude)
+		}
+	}
+
+	var cp *restoreCheckpoint
+	if opts.Checkpoint && !opts.DryRun {
+		cp, err = openCheckpoint(dst, snapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !opts.Force && !opts.DryRun {
+		err = checkFreeSpace(dst, restoreSize(dst, snapshot, excludes, cp, opts))
+		if err != nil {
+			if cp != nil && len(cp.done) == 0 {
+				_ = cp.remove()
+			} else if cp != nil {
+				_ = cp.close()
+			}
+			return nil, err
+		}
+	}
+
+	// directories without write permission for their owner would prevent
+	// restoring their content
+	opts.deferDirModes = true
+	opts.seen = newSeenChunks()
+
+	progress := make(chan Progress, opts.ProgressBuffer)
 	go func() {
+		defer close(progress)
+
+		// directories get restored first, parents before their children,
+		// followed by files and symlinks being restored concurrently.
+		// Hardlinks come last, once their targets are in place. The
+		// modification times and modes of directories get applied at the
+		// very end
+		var dirs, items, links []*Archive
 		for _, arc := range snapshot.Archives {
-			path := filepath.Join(dst, arc.Path)
+			switch {
+			case arc.LinkTarget != "":
+				links = append(links, arc)
+			case arc.Type == Directory:
+				dirs = append(dirs, arc)
+			default:
+				items = append(items, arc)
+			}
+		}
+		sort.Slice(dirs, func(i, j int) bool { return dirs[i].Path < dirs[j].Path })
 
-			match := false
-			for _, exclude := range excludes {
-				match, err = filepath.Match(strings.ToLower(exclude), strings.ToLower(arc.Path))
-				if err != nil {
-					fmt.Println("Invalid exclude filter:", exclude)
-					return
-				}
-				if match {
-					break
-				}
+		restored := &restoredPaths{paths: make(map[string]string)}
+		var mut sync.Mutex // guards failed and aborted
+		failed := 0
+		aborted := false
+
+		restore := func(arc *Archive) {
+			err := decodeSnapshotArchive(progress, repository, snapshot, *arc, dst, excludes, restored, cp, opts)
+			if err == nil {
+				return
 			}
+			p := newProgressError(err)
+			p.Path = arc.Path
+			progress <- p
 
-			if match {
-				continue
+			mut.Lock()
+			failed++
+			aborted = aborted || !opts.ContinueOnError
+			mut.Unlock()
+		}
+		stopped := func() bool {
+			mut.Lock()
+			defer mut.Unlock()
+			return aborted
+		}
+
+		for _, arc := range dirs {
+			if stopped() {
+				break
 			}
+			restore(arc)
+		}
 
-			err := DecodeArchive(prog, repository, *arc, path)
-			if err != nil {
-				p := newProgressError(err)
-				prog <- p
+		workers := opts.ArchiveConcurrency
+		if workers < 1 {
+			workers = 1
+		}
+		sem := make(chan struct{}, workers)
+		var wg sync.WaitGroup
+		for _, arc := range items {
+			if stopped() {
+				break
+			}
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(arc *Archive) {
+				defer wg.Done()
+				restore(arc)
+				<-sem
+			}(arc)
+		}
+		wg.Wait()
+
+		for _, arc := range links {
+			if stopped() {
 				break
 			}
+			restore(arc)
+		}
+
+		if aborted {
+			if cp != nil {
+				_ = cp.close()
+			}
+			return
+		}
+
+		if !opts.DryRun {
+			// directories stay writable after a failed restore, so it can be
+			// resumed
+			restoreDirAttributes(progress, dirs, restored, opts, failed == 0)
+		}
+		if failed > 0 {
+			progress <- newProgressError(&IncompleteRestoreError{failed, len(snapshot.Archives)})
+		}
+
+		if cp != nil {
+			var err error
+			if failed > 0 {
+				err = cp.close()
+			} else {
+				err = cp.remove()
+			}
+			if err != nil {
+				progress <- newProgressError(err)
+			}
 		}
-		close(prog)
 	}()
 
-	return prog, nil
+	if opts.CoalesceProgress {
+		return CoalesceProgress(progress), nil
+	}
+	return progress, nil
+}
+
+// restoreSize returns the amount of data restoring snapshot to dst writes.
+// Archives the checkpoint cp knows as restored are left out
+func restoreSize(dst string, snapshot *Snapshot, excludes []string, cp *restoreCheckpoint, opts RestoreOptions) uint64 {
+	var size uint64
+	for _, arc := range snapshot.Archives {
+		if arc.Type != File || arc.LinkTarget != "" {
+			continue
+		}
+		path, ok, err := snapshotRestorePath(dst, *arc, excludes, opts)
+		if err != nil || !ok {
+			continue
+		}
+		if cp != nil && cp.restored(*arc, path) {
+			continue
+		}
+		size += arc.Size
+	}
+
+	return size
+}
+
+// checkFreeSpace returns an InsufficientSpaceError if the filesystem dst is
+// on has less than required bytes available
+func checkFreeSpace(dst string, required uint64) error {
+	// dst may not exist yet
+	p := dst
+	for {
+		if _, err := os.Stat(p); err == nil || filepath.Dir(p) == p {
+			break
+		}
+		p = filepath.Dir(p)
+	}
+
+	available, err := freeSpace(p)
+	if err != nil {
+		return err
+	}
+	if required > available {
+		return &InsufficientSpaceError{dst, required, available}
+	}
+	return nil
+}
+
+// restoreDirAttributes applies the modification times of the restored
+// directories, which restoring their content changed, and optionally the
+// modes DecodeArchive kept writable. Children go before their parents
+func restoreDirAttributes(progress chan Progress, dirs []*Archive, restored *restoredPaths, opts RestoreOptions, modes bool) {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path, ok := restored.get(dirs[i].Path)
+		if !ok {
+			continue
+		}
+
+		mtime := time.Unix(dirs[i].ModTime, 0)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			progress <- newProgressWarning(dirs[i], err)
+		}
+
+		mode, _ := restoreMode(*dirs[i], opts)
+		if !modes || mode.Perm()&0700 == 0700 {
+			continue
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			progress <- newProgressWarning(dirs[i], err)
+		}
+	}
+}
+
+// restoredPaths maps the paths of archives to the paths they got restored to,
+// so hardlinks can refer to them
+type restoredPaths struct {
+	mut   sync.Mutex
+	paths map[string]string
+}
+
+func (r *restoredPaths) get(p string) (string, bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	path, ok := r.paths[p]
+	return path, ok
+}
+
+func (r *restoredPaths) set(p, path string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.paths[p] = path
+}
+
+// seenChunks keeps track of the chunks restored so far, so the ones occurring
+// again can be counted as deduplicated
+type seenChunks struct {
+	mut    sync.Mutex
+	hashes map[string]bool
+}
+
+func newSeenChunks() *seenChunks {
+	return &seenChunks{hashes: make(map[string]bool)}
+}
+
+// add marks a chunk as seen. It returns true if it has been seen before
+func (s *seenChunks) add(hash string) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.hashes[hash] {
+		return true
+	}
+	s.hashes[hash] = true
+	return false
+}
+
+// DecodeSnapshotFiltered restores the archives of a snapshot whose paths match
+// any of the include patterns and none of the exclude patterns to dst. See
+// RestoreOptions.Include for the pattern syntax. Archives get filtered before
+// any of their chunks are loaded
+func DecodeSnapshotFiltered(repository Repository, snapshot *Snapshot, dst string, include, exclude []string) (chan Progress, error) {
+	opts := DefaultRestoreOptions()
+	opts.Include = include
+	opts.Exclude = exclude
+
+	return DecodeSnapshot(repository, snapshot, dst, []string{}, opts)
+}
+
+// RestoreFiles restores the archives of a snapshot matching any of the
+// patterns to dst. Patterns can be exact paths, paths of directories to
+// restore with all their content, or globs as described for
+// RestoreOptions.Include. Parent directories get created as needed. Every
+// archive left out gets reported with PhaseSkipped
+func RestoreFiles(repository Repository, snapshot *Snapshot, dst string, patterns []string) (chan Progress, error) {
+	return DecodeSnapshotFiltered(repository, snapshot, dst, patterns, nil)
+}
+
+// decodeSnapshotArchive restores a single archive of a snapshot below dst.
+// Archives the checkpoint cp knows as restored get skipped, completed ones
+// get added to it
+func decodeSnapshotArchive(progress chan Progress, repository Repository, snapshot *Snapshot, arc Archive, dst string, excludes []string, restored *restoredPaths, cp *restoreCheckpoint, opts RestoreOptions) error {
+	path, ok, err := snapshotRestorePath(dst, arc, excludes, opts)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		progress <- newProgressSkipped(&arc)
+		return nil
+	}
+
+	if cp != nil && cp.restored(arc, path) {
+		logger.Debugf("Skipping %s, already restored", arc.Path)
+		if arc.LinkTarget == "" {
+			restored.set(arc.Path, path)
+		}
+		return nil
+	}
+
+	if arc.LinkTarget != "" {
+		err = decodeHardLink(progress, repository, snapshot, arc, path, restored, opts)
+	} else {
+		err = DecodeArchive(progress, repository, arc, path, opts)
+		if err == nil {
+			restored.set(arc.Path, path)
+		}
+	}
+	if err != nil || cp == nil {
+		return err
+	}
+
+	return cp.add(arc, path)
+}
+
+// snapshotRestorePath returns the path an archive of a snapshot gets restored
+// to. The second return value is false if the archive should be skipped
+func snapshotRestorePath(dst string, arc Archive, excludes []string, opts RestoreOptions) (string, bool, error) {
+	if ok, err := archiveSelected(arc, opts); err != nil || !ok {
+		return "", false, err
+	}
+
+	path, ok, err := restorePath(dst, arc.Path, opts)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	if arc.Type == SymLink && !opts.AllowExternalSymlinks {
+		err = checkSymlinkTarget(dst, path, arc.PointsTo)
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	for _, exclude := range excludes {
+		match, err := filepath.Match(strings.ToLower(exclude), strings.ToLower(arc.Path))
+		if err != nil {
+			return "", false, fmt.Errorf("Invalid exclude filter: %s", exclude)
+		}
+		if match {
+			return "", false, nil
+		}
+	}
+
+	return path, true, nil
+}
+
+// archiveSelected returns true if an archive passes the include and exclude
+// patterns of opts
+func archiveSelected(arc Archive, opts RestoreOptions) (bool, error) {
+	for _, exclude := range opts.Exclude {
+		match, err := matchGlob(exclude, arc.Path)
+		if err != nil || match {
+			return false, err
+		}
+	}
+	if len(opts.Include) == 0 {
+		return true, nil
+	}
+	for _, include := range opts.Include {
+		match, err := matchGlob(include, arc.Path)
+		if err != nil || match {
+			return match, err
+		}
+	}
+
+	return false, nil
+}
+
+// decodeHardLink restores a hardlink by linking path to the already restored
+// target archive. If the target hasn't been restored, its data gets restored
+// to path instead and further links will point there
+func decodeHardLink(progress chan Progress, repository Repository, snapshot *Snapshot, arc Archive, path string, restored *restoredPaths, opts RestoreOptions) error {
+	if target, ok := restored.get(arc.LinkTarget); ok {
+		p := newProgress(&arc)
+		p.CurrentItemStats.Size = 0
+		p.TotalStatistics.Size = 0
+		p.TotalStatistics.Files++
+		p.Phase = PhaseStarted
+		progress <- p
+
+		ok, err := prepareRestorePath(progress, &arc, path, opts)
+		if err != nil || !ok {
+			return err
+		}
+		if !opts.DryRun {
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+			if err == nil {
+				err = os.Link(target, path)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		p.Phase = PhaseCompleted
+		progress <- p
+		return nil
+	}
+
+	tarc, ok := snapshot.Archives[arc.LinkTarget]
+	if !ok {
+		return &os.LinkError{Op: "link", Old: arc.LinkTarget, New: arc.Path, Err: os.ErrNotExist}
+	}
+
+	data := *tarc
+	data.Path = arc.Path
+	err := DecodeArchive(progress, repository, data, path, opts)
+	if err != nil {
+		return err
+	}
+	restored.set(arc.LinkTarget, path)
+
+	return nil
+}
+
+// restorePath returns the path an archive gets restored to. The second return
+// value is false if the archive is outside of opts.StripPrefix
+func restorePath(dst, arcPath string, opts RestoreOptions) (string, bool, error) {
+	p := filepath.Clean(arcPath)
+	if opts.StripPrefix != "" {
+		prefix := filepath.Clean(opts.StripPrefix)
+		if p == prefix {
+			p = ""
+		} else if strings.HasPrefix(p, strings.TrimSuffix(prefix, string(filepath.Separator))+string(filepath.Separator)) {
+			p = p[len(prefix):]
+		} else {
+			return "", false, nil
+		}
+	}
+
+	path := filepath.Join(dst, p)
+	if !isWithinDir(dst, path) {
+		return "", false, &RestorePathError{arcPath, dst}
+	}
+
+	return path, true, nil
+}
+
+// checkSymlinkTarget returns an error if the symlink at path would point
+// outside of dst
+func checkSymlinkTarget(dst, path, target string) error {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	if !isWithinDir(dst, target) {
+		return &RestorePathError{path + " -> " + target, dst}
+	}
+
+	return nil
+}
+
+// isWithinDir returns true if path is dir itself or located below it
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 func decodeChunk(repository Repository, archive Archive, chunk Chunk, b []byte) ([]byte, error) {
@@ -118,87 +837,365 @@ func decodeChunk(repository Repository, archive Archive, chunk Chunk, b []byte)
 	return b, nil
 }
 
+// decodeChunkTo decodes a chunk while writing it to w. Unlike decodeChunk it
+// doesn't hold the decoded chunk in memory, unless an authenticated
+// encryption method requires it. The checksum is verified once all data has
+// been written
+func decodeChunkTo(w io.Writer, repository Repository, archive Archive, chunk Chunk, b []byte) error {
+	r, err := NewDecodingReader(bytes.NewReader(b), archive.Compressed, archive.Encrypted, repository.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h := NewHasher(HashHighway256)
+	_, err = io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return err
+	}
+
+	hashsum := hex.EncodeToString(h.Sum(nil))
+	if chunk.DecryptedHash != hashsum {
+		return &CheckSumError{"highwayhash", chunk.DecryptedHash, hashsum}
+	}
+
+	return nil
+}
+
+// loadChunk loads and decodes a chunk from the backends. It never consults or
+// populates the chunk cache, which makes it suitable for scan-once operations
+// like verifying a repository
 func loadChunk(repository Repository, archive Archive, chunk Chunk) ([]byte, error) {
+	b, _, err := loadChunkParts(repository, archive, chunk)
+	return b, err
+}
+
+// loadChunkParts works like loadChunk, but also returns the sorted indices of
+// the parts known to be missing, which the chunk had to be reconstructed without
+func loadChunkParts(repository Repository, archive Archive, chunk Chunk) ([]byte, []uint, error) {
+	b, missing, err := loadStoredChunk(repository, chunk)
+	if err != nil {
+		return []byte{}, missing, err
+	}
+
+	d, err := decodeChunk(repository, archive, chunk, b)
+	return d, missing, err
+}
+
+// verifyChunk loads a chunk from the backends and checks whether it can be
+// decoded, without keeping the decoded data in memory. Returns the sorted
+// indices of the parts the chunk had to be reconstructed without
+func verifyChunk(repository Repository, archive Archive, chunk Chunk) ([]uint, error) {
+	b, missing, err := loadStoredChunk(repository, chunk)
+	if err != nil {
+		return missing, err
+	}
+
+	return missing, decodeChunkTo(ioutil.Discard, repository, archive, chunk, b)
+}
+
+// loadStoredChunk loads the stored, still encoded data of a chunk from the
+// backends and verifies it. Returns the sorted indices of the parts the chunk
+// had to be reconstructed without
+func loadStoredChunk(repository Repository, chunk Chunk) ([]byte, []uint, error) {
+	logger.Debugf("Loading chunk %s (%d data and %d parity parts)", chunk.Hash, chunk.DataParts, chunk.ParityParts)
 	if chunk.ParityParts > 0 {
 		enc, err := reedsolomon.New(int(chunk.DataParts), int(chunk.ParityParts))
 		if err != nil {
-			return []byte{}, err
+			return []byte{}, nil, err
 		}
-		pars := make([][]byte, chunk.DataParts+chunk.ParityParts)
+		total := int(chunk.DataParts + chunk.ParityParts)
+		pars := make([][]byte, total)
 		parsFound := uint(0)
-		parsMissing := 0
-
-		// try to load all parts until we can successfully combine/reconstruct the chunk
-		for i := 0; i < int(chunk.DataParts+chunk.ParityParts); i++ {
-			var cerr error
-			pars[i], cerr = repository.backend.LoadChunk(chunk, uint(i))
-			if cerr != nil {
-				pars[i] = nil
-				parsMissing++
+		var parsMissing []uint
+		var joinErr error
+
+		// load all parts concurrently. The channel is buffered, so workers
+		// finishing after we're done never block
+		done := make(chan struct{})
+		defer close(done)
+		results := make(chan partResult, total)
+		for i := 0; i < total; i++ {
+			go func(part int) {
+				select {
+				case <-done:
+					results <- partResult{part, nil, ErrLoadChunkFailed}
+					return
+				default:
+				}
+
+				b, err := repository.backend.LoadChunk(chunk, uint(part))
+				results <- partResult{part, b, err}
+			}(i)
+		}
+
+		// collect parts until we can successfully combine/reconstruct the chunk
+		for i := 0; i < total; i++ {
+			r := <-results
+			if r.err != nil {
+				parsMissing = append(parsMissing, uint(r.part))
+				if uint(len(parsMissing)) > chunk.ParityParts {
+					// too many parts are gone, waiting for the rest is pointless
+					break
+				}
 				continue
 			}
+			pars[r.part] = r.data
 			parsFound++
 
 			// check if we already have a sufficient amount of parts
 			if parsFound >= chunk.DataParts {
-				var b bytes.Buffer
-				w := bufio.NewWriter(&b)
-
-				// if more than one data-part was missing, we need to reconstruct the chunk
-				if parsMissing > 0 {
-					err = enc.Reconstruct(pars)
-					if err != nil {
-						continue
-					}
-				}
-				err = enc.Join(w, pars, chunk.Size)
+				b, corrupt, err := joinParts(enc, pars, chunk)
 				if err != nil {
-					// reconstruction failed, let's try it with another parity part
+					// try again once another part arrived
+					joinErr = err
 					continue
 				}
-				_ = w.Flush()
-				return decodeChunk(repository, archive, chunk, b.Bytes())
+				if corrupt >= 0 {
+					logger.Warnf("Part %d of chunk %s is corrupted", corrupt, chunk.Hash)
+					parsMissing = append(parsMissing, uint(corrupt))
+				}
+				sortParts(parsMissing)
+				return b, parsMissing, nil
 			}
 		}
 
-		return []byte{}, &DataReconstructionError{chunk, parsFound, chunk.DataParts - parsFound}
+		sortParts(parsMissing)
+		if _, ok := joinErr.(*CheckSumError); ok {
+			// all parts are there, but their data is corrupted
+			return []byte{}, parsMissing, joinErr
+		}
+		return []byte{}, parsMissing, &DataReconstructionError{
+			Chunk:          chunk,
+			BlocksFound:    parsFound,
+			FailedBackends: uint(len(parsMissing)),
+			MissingParts:   parsMissing,
+		}
 	}
 
 	b, err := repository.backend.LoadChunk(chunk, 0)
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, nil, err
+	}
+	err = verifyStoredChunk(chunk, b)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return b, nil, nil
+}
+
+// joinParts combines the parts of a chunk, reconstructing the missing ones,
+// and verifies the result. If the stored checksum doesn't match and there are
+// spare parts, every part gets left out in turn to find a corrupted one.
+// Returns the stored data and the index of the corrupted part, or -1
+func joinParts(enc reedsolomon.Encoder, pars [][]byte, chunk Chunk) ([]byte, int, error) {
+	b, err := joinAndVerify(enc, pars, chunk)
+	if _, ok := err.(*CheckSumError); !ok {
+		return b, -1, err
+	}
+
+	var found int
+	for _, p := range pars {
+		if p != nil {
+			found++
+		}
+	}
+	if found <= int(chunk.DataParts) {
+		return nil, -1, err
+	}
+
+	for i := range pars {
+		if pars[i] == nil {
+			continue
+		}
+
+		without := make([][]byte, len(pars))
+		copy(without, pars)
+		without[i] = nil
+		if d, jerr := joinAndVerify(enc, without, chunk); jerr == nil {
+			return d, i, nil
+		}
+	}
+
+	return nil, -1, err
+}
+
+// joinAndVerify combines the parts of a chunk, reconstructing the missing
+// ones, and verifies the stored checksum. pars doesn't get modified
+func joinAndVerify(enc reedsolomon.Encoder, pars [][]byte, chunk Chunk) ([]byte, error) {
+	shards := make([][]byte, len(pars))
+	copy(shards, pars)
+
+	for _, p := range shards {
+		if p == nil {
+			err := enc.Reconstruct(shards)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
 	}
-	return decodeChunk(repository, archive, chunk, b)
+
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	err := enc.Join(w, shards, chunk.Size)
+	if err != nil {
+		return nil, err
+	}
+	_ = w.Flush()
+
+	return b.Bytes(), verifyStoredChunk(chunk, b.Bytes())
+}
+
+// sortParts sorts a list of part indices
+func sortParts(parts []uint) {
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i] < parts[j]
+	})
+}
+
+// partResult carries a loaded part of a chunk or the error that occurred
+// loading it
+type partResult struct {
+	part int
+	data []byte
+	err  error
+}
+
+// verifyStoredChunk checks the data loaded from the backends before decoding
+// it, so corrupted storage can be told apart from a wrong key
+func verifyStoredChunk(chunk Chunk, b []byte) error {
+	hashsum := Hash(b, HashHighway256)
+	if chunk.Hash != hashsum {
+		return &CheckSumError{"highwayhash-stored", chunk.Hash, hashsum}
+	}
+
+	return nil
+}
+
+// chunkResult carries a loaded chunk's data or the error that occurred loading it
+type chunkResult struct {
+	Chunk        Chunk
+	Data         []byte
+	MissingParts []uint // parts the chunk had to be reconstructed without
+	Error        error
+}
+
+// loadChunks loads the chunks of an archive, beginning with chunk number
+// first, using a pool of workers. The results are delivered in order, with at
+// most workers chunks being loaded ahead of the consumer. Closing done stops
+// loading any further chunks
+func loadChunks(repository Repository, arc Archive, first uint, workers int, done <-chan struct{}) <-chan chan chunkResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type job struct {
+		num    uint
+		result chan chunkResult
+	}
+	jobs := make(chan job)
+	results := make(chan chan chunkResult, workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for j := range jobs {
+				idx, err := arc.IndexOfChunk(j.num)
+				if err != nil {
+					j.result <- chunkResult{Error: err}
+					continue
+				}
+
+				chunk := arc.Chunks[idx]
+				b, missing, err := loadChunkParts(repository, arc, chunk)
+				j.result <- chunkResult{Chunk: chunk, Data: b, MissingParts: missing, Error: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(results)
+
+		for i := first; i < uint(len(arc.Chunks)); i++ {
+			j := job{i, make(chan chunkResult, 1)}
+			select {
+			case results <- j.result:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- j:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return results
 }
 
 // DecodeArchive restores a single archive to path
-func DecodeArchive(progress chan Progress, repository Repository, arc Archive, path string) error {
+func DecodeArchive(progress chan Progress, repository Repository, arc Archive, path string, opts RestoreOptions) error {
 	p := newProgress(&arc)
 
+	mode, substituted := restoreMode(arc, opts)
+	if substituted {
+		progress <- newProgressWarning(&arc, &ModeError{arc.Path, mode})
+	}
+	if opts.DryRun {
+		return dryRunArchive(progress, arc, path, opts)
+	}
+
 	if arc.Type == Directory {
-		//fmt.Printf("Creating directory %s\n", path)
-		err := os.MkdirAll(path, arc.Mode)
+		logger.Debugf("Creating directory %s", path)
+		err := os.MkdirAll(path, mode)
+		if err != nil {
+			return err
+		}
+		// MkdirAll applies the umask and leaves existing directories alone
+		if opts.deferDirModes {
+			err = os.Chmod(path, mode|0700)
+		} else {
+			err = os.Chmod(path, mode)
+		}
 		if err != nil {
 			return err
 		}
 		p.TotalStatistics.Dirs++
+		p.Phase = PhaseStarted
 		progress <- p
 	} else if arc.Type == SymLink {
-		//fmt.Printf("Creating symlink %s -> %s\n", path, arc.PointsTo)
-		err := os.Symlink(arc.PointsTo, path)
+		logger.Debugf("Creating symlink %s -> %s", path, arc.PointsTo)
+		ok, err := prepareRestorePath(progress, &arc, path, opts)
+		if err != nil || !ok {
+			return err
+		}
+		// the symlink's parent directory may not have been restored yet
+		err = os.MkdirAll(filepath.Dir(path), 0755)
 		if err != nil {
 			return err
 		}
+		err = os.Symlink(arc.PointsTo, path)
+		if err != nil {
+			return err
+		}
+		err = lutimes(path, time.Unix(arc.ModTime, 0))
+		if err != nil {
+			progress <- newProgressWarning(&arc, err)
+		}
 		p.TotalStatistics.SymLinks++
+		p.Phase = PhaseStarted
 		progress <- p
 	} else if arc.Type == File {
-		parts := uint(len(arc.Chunks))
-		//fmt.Printf("Creating file %s (%d chunks).\n", path, parts)
+		logger.Debugf("Creating file %s (%d chunks)", path, len(arc.Chunks))
 
 		p.TotalStatistics.Files++
 		p.TotalStatistics.Size = arc.Size
 		p.TotalStatistics.StorageSize = arc.StorageSize
+		p.Phase = PhaseStarted
 		progress <- p
+		p.Phase = PhaseTransferring
 
 		// FIXME: we don't always need to create the path
 		// this is just a safety measure for now
@@ -207,37 +1204,55 @@ func DecodeArchive(progress chan Progress, repository Repository, arc Archive, p
 			return err
 		}
 
-		// write to disk
-		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, arc.Mode)
-		if err != nil {
-			return err
-		}
-
-		for i := uint(0); i < parts; i++ {
-			idx, erri := arc.IndexOfChunk(i)
-			if erri != nil {
-				return erri
+		var f *os.File
+		var first uint
+		var offset int
+		if opts.Resume {
+			f, first, offset, err = openResumable(path, arc)
+			if err != nil {
+				return err
 			}
+			if offset > 0 {
+				p.TotalStatistics.Transferred += uint64(offset)
+				p.CurrentItemStats.Transferred += uint64(offset)
+				progress <- p
+			}
+		}
 
-			chunk := arc.Chunks[idx]
-			b, errc := loadChunk(repository, arc, chunk)
-			if errc != nil {
-				return errc
+		if f == nil {
+			ok, err := prepareRestorePath(progress, &arc, path, opts)
+			if err != nil || !ok {
+				return err
 			}
 
-			_, err = f.Write(b)
+			// write to disk
+			f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
 			if err != nil {
 				return err
 			}
+		}
 
-			p.TotalStatistics.Transferred += uint64(len(b))
-			p.CurrentItemStats.Transferred += uint64(len(b))
-			progress <- p
-			// fmt.Printf("Chunk OK: %d bytes, hash: %s\n", size, chunk.DecryptedHash)
+		var w io.Writer = f
+		sw := &sparseWriter{f: f, offset: int64(offset)}
+		sparse := opts.Sparse && supportsSparse(f)
+		if sparse {
+			w = sw
+		} else if opts.Sparse {
+			logger.Debugf("Filesystem of %s doesn't support sparse files", path)
+		}
+
+		err = decodeArchiveContent(progress, repository, arc, first, offset, w, opts, &p)
+		if err == nil && sparse {
+			err = sw.Truncate()
+		}
+		if err != nil {
+			f.Close()
+			return err
 		}
 
 		err = f.Sync()
 		if err != nil {
+			f.Close()
 			return err
 		}
 		err = f.Close()
@@ -252,18 +1267,193 @@ func DecodeArchive(progress chan Progress, repository Repository, arc Archive, p
 		}
 	}
 
+	// Restore extended attributes
+	if arc.Type != SymLink {
+		err := restoreXAttrs(path, arc.XAttrs)
+		if err != nil {
+			progress <- newProgressWarning(&arc, err)
+		}
+	}
+
 	// Restore ownerships
-	return os.Lchown(path, int(arc.UID), int(arc.GID))
+	if opts.PreserveOwnership {
+		err := os.Lchown(path, int(arc.UID), int(arc.GID))
+		if os.IsPermission(err) {
+			progress <- newProgressWarning(&arc, &OwnershipError{arc.Path, arc.UID, arc.GID, err})
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// OpenFile applies the umask and leaves the mode of replaced files alone.
+	// Changing the ownership clears the setuid and setgid bits, so the mode
+	// gets applied last
+	if arc.Type == File {
+		err := os.Chmod(path, mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.Phase = PhaseCompleted
+	progress <- p
+	return nil
 }
 
-var (
-	cache map[string][]byte
-	mutex = &sync.Mutex{}
-)
+// dryRunArchive reports the same progress as restoring an archive would,
+// without loading any chunks or touching the filesystem. Items already
+// existing at path get reported according to the overwrite policy
+func dryRunArchive(progress chan Progress, arc Archive, path string, opts RestoreOptions) error {
+	p := newProgress(&arc)
+
+	switch arc.Type {
+	case Directory:
+		p.TotalStatistics.Dirs++
+		p.Phase = PhaseStarted
+		progress <- p
+	case SymLink:
+		ok, err := prepareRestorePath(progress, &arc, path, opts)
+		if err != nil || !ok {
+			return err
+		}
+		p.TotalStatistics.SymLinks++
+		p.Phase = PhaseStarted
+		progress <- p
+	case File:
+		p.TotalStatistics.Files++
+		p.TotalStatistics.Size = arc.Size
+		p.TotalStatistics.StorageSize = arc.StorageSize
+		p.Phase = PhaseStarted
+		progress <- p
+		p.Phase = PhaseTransferring
+
+		ok, err := prepareRestorePath(progress, &arc, path, opts)
+		if err != nil || !ok {
+			return err
+		}
+		for _, chunk := range arc.Chunks {
+			p.TotalStatistics.Transferred += uint64(chunk.OriginalSize)
+			p.CurrentItemStats.Transferred += uint64(chunk.OriginalSize)
+			progress <- p
+		}
+	}
+
+	p.Phase = PhaseCompleted
+	progress <- p
+	return nil
+}
+
+// DecodeArchiveToWriter streams the content of a single file archive to w.
+// No filesystem metadata like permissions or ownerships gets restored
+func DecodeArchiveToWriter(progress chan Progress, repository Repository, arc Archive, w io.Writer) error {
+	if arc.Type != File {
+		return ErrNotAFile
+	}
+
+	p := newProgress(&arc)
+	p.TotalStatistics.Files++
+	p.TotalStatistics.Size = arc.Size
+	p.TotalStatistics.StorageSize = arc.StorageSize
+	p.Phase = PhaseStarted
+	progress <- p
+	p.Phase = PhaseTransferring
+
+	err := decodeArchiveContent(progress, repository, arc, 0, 0, w, DefaultRestoreOptions(), &p)
+	if err != nil {
+		return err
+	}
+
+	p.Phase = PhaseCompleted
+	progress <- p
+	return nil
+}
+
+// decodeArchiveContent loads the chunks of a file archive, beginning with
+// chunk number first which starts at offset, and writes their decoded data to
+// w. The statistics of p get updated along the way
+func decodeArchiveContent(progress chan Progress, repository Repository, arc Archive, first uint, offset int, w io.Writer, opts RestoreOptions, p *Progress) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	// data skipped by resuming a restore doesn't count towards the speed
+	meter := newRateMeter(p.TotalStatistics.Transferred)
+	seen := opts.seen
+	if seen == nil {
+		seen = newSeenChunks()
+	}
+	for result := range loadChunks(repository, arc, first, opts.Concurrency, done) {
+		cr := <-result
+		if cr.Error != nil {
+			if rerr, ok := cr.Error.(*DataReconstructionError); ok {
+				rerr.Offset = offset
+			}
+			if !opts.BestEffort || cr.Chunk.OriginalSize == 0 {
+				return cr.Error
+			}
 
-func init() {
-	cache = make(map[string][]byte)
+			// fill the missing data with zeros and carry on
+			cr.Data = make([]byte, cr.Chunk.OriginalSize)
+			p.TotalStatistics.Errors++
+			progress <- newProgressWarning(&arc, &DataGapError{arc.Path, offset, cr.Chunk.OriginalSize, cr.Error})
+		} else if len(cr.MissingParts) > 0 {
+			// the data is intact, but the repository is degraded
+			p.TotalStatistics.Reconstructed++
+			progress <- newProgressWarning(&arc, &ReconstructionWarning{arc.Path, offset, cr.Chunk, cr.MissingParts})
+		}
+		b := cr.Data
+		offset += len(b)
+
+		if cr.Error == nil && seen.add(cr.Chunk.Hash) {
+			p.TotalStatistics.DedupChunks++
+			p.TotalStatistics.DedupSize += uint64(len(b))
+		}
+
+		_, err := w.Write(b)
+		if err != nil {
+			return err
+		}
 
+		p.TotalStatistics.Transferred += uint64(len(b))
+		p.CurrentItemStats.Transferred += uint64(len(b))
+		meter.update(p)
+		progress <- *p
+	}
+
+	return nil
+}
+
+// loadCachedChunk returns a chunk from the chunk cache or loads and caches it.
+// The second return value is true if the chunk was served from the cache
+func loadCachedChunk(repository Repository, arc Archive, chunk Chunk) ([]byte, bool, error) {
+	if repository.cache == nil {
+		cd, err := loadChunk(repository, arc, chunk)
+		return cd, false, err
+	}
+
+	return repository.cache.Load(chunk.Hash, func() ([]byte, error) {
+		return loadChunk(repository, arc, chunk)
+	})
+}
+
+// prefetchChunks loads the chunks following chunk number next into the chunk
+// cache in the background, keeping at most the repository's read-ahead of
+// prefetches outstanding
+func prefetchChunks(repository Repository, arc Archive, next uint) {
+	if repository.cache == nil {
+		return
+	}
+
+	for i := 0; i < repository.cache.ReadAhead(); i++ {
+		idx, err := arc.IndexOfChunk(next + uint(i))
+		if err != nil {
+			return
+		}
+
+		chunk := arc.Chunks[idx]
+		repository.cache.Prefetch(chunk.Hash, func() ([]byte, error) {
+			return loadChunk(repository, arc, chunk)
+		})
+	}
 }
 
 // DecodeArchiveData returns the content of a single archive
@@ -272,30 +1462,19 @@ func DecodeArchiveData(repository Repository, arc Archive) ([]byte, Stats, error
 	var stats Stats
 
 	if arc.Type == File {
-		parts := uint(len(arc.Chunks))
-
-		for i := uint(0); i < parts; i++ {
-			idx, err := arc.IndexOfChunk(i)
-			if err != nil {
-				return b, stats, err
-			}
-
-			chunk := arc.Chunks[idx]
-			mutex.Lock()
-			cd, ok := cache[chunk.Hash]
-			if ok {
-				fmt.Println("Using cached chunk", chunk.Hash)
-			} else {
-				cd, err = loadChunk(repository, arc, chunk)
-				if err != nil {
-					return b, stats, err
-				}
-				cache[chunk.Hash] = cd
-			}
+		r, err := NewArchiveReader(repository, arc)
+		if err != nil {
+			return b, stats, err
+		}
+		defer r.Close()
 
-			mutex.Unlock()
-			b = append(b, cd...)
+		buf := bytes.NewBuffer(make([]byte, 0, arc.Size))
+		_, err = buf.ReadFrom(r)
+		stats.Add(r.Stats())
+		if err != nil {
+			return buf.Bytes(), stats, err
 		}
+		b = buf.Bytes()
 
 		stats.StorageSize += arc.StorageSize
 		stats.Size += arc.Size
@@ -316,28 +1495,39 @@ func readArchiveChunk(repository Repository, arc Archive, chunkNum uint) (*[]byt
 	}
 
 	chunk := arc.Chunks[idx]
-	mutex.Lock()
-	cd, ok := cache[chunk.Hash]
-	if !ok {
-		cd, err = loadChunk(repository, arc, chunk)
-		if err != nil {
-			return &b, err
-		}
-		cache[chunk.Hash] = cd
+	cd, _, err := loadCachedChunk(repository, arc, chunk)
+	if err != nil {
+		return &b, err
 	}
 
-	mutex.Unlock()
 	b = append(b, cd...)
 
 	return &b, nil
 }
 
-// ReadArchive reads from an archive
+// ReadArchive reads size bytes at offset from an archive. Only the chunks
+// containing the requested range get loaded. If the range extends past the
+// end of the archive, the available bytes are returned together with io.EOF
 func ReadArchive(repository Repository, arc Archive, offset int, size int) (*[]byte, error) {
 	var b []byte
 
-	// fmt.Println("Read req:", offset, size)
+	logger.Debugf("Read request: %d bytes at offset %d", size, offset)
 	if arc.Type == File {
+		if offset < 0 || uint64(offset) > arc.Size {
+			return &b, &SeekError{offset}
+		}
+
+		// reads extending past the end of the file return the remaining
+		// data and io.EOF
+		var eof bool
+		if uint64(offset)+uint64(size) > arc.Size {
+			size = int(arc.Size - uint64(offset))
+			eof = true
+		}
+		if eof && size == 0 {
+			return &b, io.EOF
+		}
+
 		neededPart, internalOffset, err := arc.ChunkForOffset(offset)
 		if err != nil {
 			return &b, err
@@ -345,18 +1535,20 @@ func ReadArchive(repository Repository, arc Archive, offset int, size int) (*[]b
 
 		for len(b) < size {
 			if neededPart >= uint(len(arc.Chunks)) {
-				return &b, nil
+				// the chunks contain less data than the archive's size
+				return &b, io.EOF
 			}
 			cd, err := readArchiveChunk(repository, arc, neededPart)
-			if err != nil || len(*cd) == 0 {
-				//return b, err
-				panic(err)
+			if err != nil {
+				return &b, err
 			}
 
+			if internalOffset > len(*cd) {
+				return &b, &SeekError{offset}
+			}
 			d := (*cd)[internalOffset:]
-			if err != nil || len(d) == 0 {
-				//return b, err
-				panic(err)
+			if len(d) == 0 {
+				return &b, io.ErrUnexpectedEOF
 			}
 			if len(d)+len(b) > size {
 				b = append(b, d[:size-len(b)]...)
@@ -368,10 +1560,11 @@ func ReadArchive(repository Repository, arc Archive, offset int, size int) (*[]b
 			neededPart++
 		}
 
-		// cache the next block NOW
-		go func() {
-			_, _ = readArchiveChunk(repository, arc, neededPart)
-		}()
+		if eof {
+			return &b, io.EOF
+		}
+
+		prefetchChunks(repository, arc, neededPart)
 	}
 
 	return &b, nil
@@ -0,0 +1,2140 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// setupDecodeTest creates a repository in dir containing a single snapshot of files
+func setupDecodeTest(t *testing.T, dir string, files []string, compression uint16, parityParts uint) (Repository, *Snapshot) {
+	testPassword := "this_is_a_password"
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+	vol, err := NewVolume("test_name", "test_description")
+	if err != nil {
+		t.Fatalf("Failed creating volume: %s", err)
+	}
+	err = r.AddVolume(vol)
+	if err != nil {
+		t.Fatalf("Failed creating volume: %s", err)
+	}
+	snapshot, err := NewSnapshot("test_snapshot")
+	if err != nil {
+		t.Fatalf("Failed creating snapshot: %s", err)
+	}
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Fatalf("Failed opening chunk-index: %s", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed getting working dir: %s", err)
+	}
+	progress := snapshot.Add(wd, files, []string{}, r, &index, compression, EncryptionAES, 1, parityParts)
+	for p := range progress {
+		if p.Error != nil {
+			t.Fatalf("Failed adding to snapshot: %s", p.Error)
+		}
+	}
+
+	err = snapshot.Save(&r)
+	if err != nil {
+		t.Fatalf("Failed saving snapshot: %s", err)
+	}
+	err = vol.AddSnapshot(snapshot.ID)
+	if err != nil {
+		t.Fatalf("Failed adding snapshot to volume: %s", err)
+	}
+	err = r.Save()
+	if err != nil {
+		t.Fatalf("Failed saving volume: %s", err)
+	}
+	err = index.Save(&r)
+	if err != nil {
+		t.Fatalf("Failed saving chunk-index: %s", err)
+	}
+
+	r, err = OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed opening repository: %s", err)
+	}
+	_, snapshot, err = r.FindSnapshot(snapshot.ID)
+	if err != nil {
+		t.Fatalf("Failed finding snapshot: %s", err)
+	}
+
+	return r, snapshot
+}
+
+// writeRandomFile writes size bytes of random data to path
+func writeRandomFile(t *testing.T, path string, size int) []byte {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	err := ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatalf("Failed writing test file: %s", err)
+	}
+
+	return data
+}
+
+// corruptChunk flips a byte in the stored data of a chunk
+func corruptChunk(t *testing.T, repo string, chunk Chunk) {
+	var corrupted bool
+	err := filepath.Walk(filepath.Join(repo, "chunks"), func(path string, fi os.FileInfo, err error) error {
+		if err != nil || corrupted || !strings.HasPrefix(filepath.Base(path), chunk.Hash+".") {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		b[len(b)/2] ^= 0xff
+		corrupted = true
+		return ioutil.WriteFile(path, b, fi.Mode())
+	})
+	if err != nil || !corrupted {
+		t.Fatalf("Failed corrupting chunk: %v", err)
+	}
+}
+
+func TestDecodeArchiveZeroMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"decode.go"}, CompressionNone, 0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	arc := *snapshot.Archives["decode.go"]
+	arc.Mode = 0
+	path := filepath.Join(targetdir, arc.Path)
+
+	warnings := make(chan int)
+	progress := make(chan Progress)
+	go func() {
+		n := 0
+		for p := range progress {
+			if p.Warning != nil {
+				n++
+			}
+		}
+		warnings <- n
+	}()
+	err = DecodeArchive(progress, r, arc, path, DefaultRestoreOptions())
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+	if n := <-warnings; n != 1 {
+		t.Errorf("Expected 1 warning, got %d", n)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat restored file: %s", err)
+	}
+	if fi.Mode().Perm()&0600 != 0600 {
+		t.Errorf("Expected restored file to be readable & writable, got mode %s", fi.Mode())
+	}
+	if _, err := ioutil.ReadFile(path); err != nil {
+		t.Errorf("Failed reading restored file: %s", err)
+	}
+}
+
+func TestDecodeArchiveModeMask(t *testing.T) {
+	opts := DefaultRestoreOptions()
+	opts.FileModeMask = os.ModeSetuid | os.ModeSetgid | 0077
+	opts.DirModeMask = os.ModeSticky | 0027
+
+	tests := []struct {
+		arc      Archive
+		expected os.FileMode
+	}{
+		{Archive{Type: File, Mode: os.ModeSetuid | os.ModeSetgid | 0755}, 0700},
+		{Archive{Type: File, Mode: 0644}, 0600},
+		{Archive{Type: Directory, Mode: os.ModeDir | os.ModeSticky | 0777}, os.ModeDir | 0750},
+		{Archive{Type: SymLink, Mode: os.ModeSymlink | 0777}, os.ModeSymlink | 0777},
+	}
+	for _, tt := range tests {
+		if mode, _ := restoreMode(tt.arc, opts); mode != tt.expected {
+			t.Errorf("Expected mode %s for %s, got %s", tt.expected, tt.arc.Mode, mode)
+		}
+	}
+
+	// without any masks the stored modes are preserved
+	arc := tests[0].arc
+	if mode, _ := restoreMode(arc, DefaultRestoreOptions()); mode != arc.Mode {
+		t.Errorf("Expected mode %s, got %s", arc.Mode, mode)
+	}
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"decode.go"}, CompressionNone, 0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	arc = *snapshot.Archives["decode.go"]
+	arc.Mode = 0644
+	path := filepath.Join(targetdir, arc.Path)
+
+	progress := make(chan Progress)
+	go func() {
+		for range progress {
+		}
+	}()
+	err = DecodeArchive(progress, r, arc, path, opts)
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat restored file: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected restored file to have mode 0600, got %s", fi.Mode())
+	}
+}
+
+func TestDecodeArchiveReplacedMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"decode.go"}, CompressionNone, 0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	// neither the umask nor the mode of the replaced file may interfere
+	arc := *snapshot.Archives["decode.go"]
+	arc.Mode = 0777
+	path := filepath.Join(targetdir, arc.Path)
+	err = ioutil.WriteFile(path, []byte("existing"), 0600)
+	if err != nil {
+		t.Fatalf("Failed writing file: %s", err)
+	}
+
+	progress := make(chan Progress)
+	go func() {
+		for range progress {
+		}
+	}()
+	err = DecodeArchive(progress, r, arc, path, DefaultRestoreOptions())
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat restored file: %s", err)
+	}
+	if fi.Mode().Perm() != 0777 {
+		t.Errorf("Expected restored file to have mode 0777, got %s", fi.Mode())
+	}
+}
+
+func TestDecodeChunkCompression(t *testing.T) {
+	r := Repository{Key: "this_is_a_key"}
+	b := []byte("1234567890")
+
+	for _, method := range []uint16{CompressionGZip, CompressionZstd, CompressionBrotli} {
+		pipe, err := NewEncodingPipeline(method, EncryptionAES, r.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		be, err := pipe.Process(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		arc := Archive{Compressed: method, Encrypted: EncryptionAES}
+		chunk := Chunk{DecryptedHash: Hash(b, HashHighway256)}
+		bd, err := decodeChunk(r, arc, chunk, be)
+		if err != nil {
+			t.Errorf("Failed decoding chunk compressed with method %d: %s", method, err)
+		}
+		if string(b) != string(bd) {
+			t.Errorf("Data mismatch after decoding chunk compressed with method %d", method)
+		}
+
+		chunk.DecryptedHash = Hash([]byte("invalid"), HashHighway256)
+		_, err = decodeChunk(r, arc, chunk, be)
+		if _, ok := err.(*CheckSumError); !ok {
+			t.Errorf("Expected CheckSumError, got %v", err)
+		}
+	}
+}
+
+func TestOpenArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"decode.go"}, CompressionNone, 0)
+
+	rc, err := OpenArchive(r, *snapshot.Archives["decode.go"])
+	if err != nil {
+		t.Fatalf("Failed opening archive: %s", err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(iotest.OneByteReader(rc))
+	if err != nil {
+		t.Fatalf("Failed reading archive: %s", err)
+	}
+	orig, err := ioutil.ReadFile("decode.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, orig) {
+		t.Error("Data mismatch after reading archive")
+	}
+
+	_, err = OpenArchive(r, Archive{Type: Directory})
+	if err != ErrNotAFile {
+		t.Errorf("Expected %v, got %v", ErrNotAFile, err)
+	}
+}
+
+func TestDecodeArchiveConcurrency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a file large enough to be split into several chunks
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 5*preferredChunkSize)
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+	if len(arc.Chunks) < 2 {
+		t.Fatalf("Expected multiple chunks, got %d", len(arc.Chunks))
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		targetdir, err := ioutil.TempDir("", "knoxite.target")
+		if err != nil {
+			t.Fatalf("Failed creating temporary dir for restore: %s", err)
+		}
+		defer os.RemoveAll(targetdir)
+
+		opts := DefaultRestoreOptions()
+		opts.Concurrency = concurrency
+		path := filepath.Join(targetdir, "random")
+
+		progress := make(chan Progress)
+		go func() {
+			for range progress {
+			}
+		}()
+		err = DecodeArchive(progress, r, arc, path, opts)
+		close(progress)
+		if err != nil {
+			t.Fatalf("Failed restoring archive: %s", err)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed reading restored file: %s", err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Errorf("Data mismatch after restoring with concurrency %d", concurrency)
+		}
+	}
+}
+
+func TestDecodeArchiveToWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 3*preferredChunkSize)
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+
+	var transferred uint64
+	var last Progress
+	progress := make(chan Progress)
+	finished := make(chan struct{})
+	go func() {
+		for p := range progress {
+			if p.CurrentItemStats.Size != arc.Size {
+				t.Errorf("Expected item size %d, got %d", arc.Size, p.CurrentItemStats.Size)
+			}
+			if p.Remaining() != p.CurrentItemStats.Size-p.CurrentItemStats.Transferred {
+				t.Errorf("Unexpected amount of remaining bytes: %d", p.Remaining())
+			}
+			transferred = p.TotalStatistics.Transferred
+			last = p
+		}
+		close(finished)
+	}()
+
+	var buf bytes.Buffer
+	err = DecodeArchiveToWriter(progress, r, arc, &buf)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+	err = DecodeArchiveToWriter(progress, r, Archive{Type: SymLink}, &buf)
+	if err != ErrNotAFile {
+		t.Errorf("Expected %v, got %v", ErrNotAFile, err)
+	}
+	close(progress)
+	<-finished
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("Data mismatch after restoring to writer")
+	}
+	if transferred != arc.Size {
+		t.Errorf("Expected %d transferred bytes, got %d", arc.Size, transferred)
+	}
+	if last.Remaining() != 0 || last.Percentage() != 100 {
+		t.Errorf("Expected item to be complete, %d bytes remaining", last.Remaining())
+	}
+}
+
+func TestDecodeArchiveBestEffort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 3*preferredChunkSize)
+
+	repodir := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repodir, []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+
+	// remove the second chunk from the repository
+	idx, err := arc.IndexOfChunk(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := arc.Chunks[idx]
+	err = os.Remove(filepath.Join(repodir, chunksDirname, SubDirForChunk(missing.Hash), missing.Hash+".0_1"))
+	if err != nil {
+		t.Fatalf("Failed removing chunk: %s", err)
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+	path := filepath.Join(targetdir, "random")
+
+	opts := DefaultRestoreOptions()
+	err = DecodeArchive(make(chan Progress, 64), r, arc, path, opts)
+	if err == nil {
+		t.Error("Expected restore to fail without best-effort mode")
+	}
+
+	gaps := make(chan []*DataGapError)
+	progress := make(chan Progress)
+	go func() {
+		var g []*DataGapError
+		for p := range progress {
+			if gerr, ok := p.Warning.(*DataGapError); ok {
+				g = append(g, gerr)
+			}
+		}
+		gaps <- g
+	}()
+	opts.BestEffort = true
+	err = DecodeArchive(progress, r, arc, path, opts)
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive in best-effort mode: %s", err)
+	}
+
+	g := <-gaps
+	if len(g) != 1 {
+		t.Fatalf("Expected 1 gap, got %d", len(g))
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading restored file: %s", err)
+	}
+	if len(b) != len(data) {
+		t.Fatalf("Expected %d bytes, got %d", len(data), len(b))
+	}
+	if g[0].Size != missing.OriginalSize {
+		t.Errorf("Expected gap of %d bytes, got %d", missing.OriginalSize, g[0].Size)
+	}
+	if !bytes.Equal(b[g[0].Offset:g[0].Offset+g[0].Size], make([]byte, g[0].Size)) {
+		t.Error("Expected gap to be zero-filled")
+	}
+	if !bytes.Equal(b[:g[0].Offset], data[:g[0].Offset]) || !bytes.Equal(b[g[0].Offset+g[0].Size:], data[g[0].Offset+g[0].Size:]) {
+		t.Error("Data mismatch outside of the gap")
+	}
+}
+
+func TestReadArchiveBackendFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"decode.go"}, CompressionNone, 0)
+	arc := *snapshot.Archives["decode.go"]
+
+	// make all chunk loads fail
+	err = os.RemoveAll(filepath.Join(dir, chunksDirname))
+	if err != nil {
+		t.Fatalf("Failed removing chunks: %s", err)
+	}
+
+	_, err = ReadArchive(r, arc, 0, 1024)
+	if err == nil {
+		t.Error("Expected an error reading from a failing backend")
+	}
+}
+
+func TestReadArchiveBounds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"decode.go"}, CompressionNone, 0)
+	arc := *snapshot.Archives["decode.go"]
+
+	b, err := ReadArchive(r, arc, int(arc.Size)-4, 4)
+	if err != nil || len(*b) != 4 {
+		t.Errorf("Expected to read the last 4 bytes, got %d bytes: %v", len(*b), err)
+	}
+	tail := *b
+
+	// reading across the end of the file
+	b, err = ReadArchive(r, arc, int(arc.Size)-4, 16)
+	if err != io.EOF || !bytes.Equal(*b, tail) {
+		t.Errorf("Expected the last 4 bytes and %v reading across the end of file, got %d bytes: %v", io.EOF, len(*b), err)
+	}
+
+	// reading at the exact end of the file
+	b, err = ReadArchive(r, arc, int(arc.Size), 4)
+	if err != io.EOF || len(*b) != 0 {
+		t.Errorf("Expected %v reading at the end of file, got %d bytes: %v", io.EOF, len(*b), err)
+	}
+
+	// reading past the end of the file
+	_, err = ReadArchive(r, arc, int(arc.Size)+1, 4)
+	if _, ok := err.(*SeekError); !ok {
+		t.Errorf("Expected SeekError reading past the end of file, got %v", err)
+	}
+}
+
+// recordingBackend records which chunks have been loaded
+type recordingBackend struct {
+	Backend
+
+	mut    sync.Mutex
+	loaded []string
+}
+
+func (b *recordingBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	b.mut.Lock()
+	b.loaded = append(b.loaded, shasum)
+	b.mut.Unlock()
+	return b.Backend.LoadChunk(shasum, part, totalParts)
+}
+
+func TestReadArchiveTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 8192)
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	last := snapshot.Archives[src].Chunks[0]
+
+	// pretend the stored chunk is the tail of a 5GB file, whose other chunks
+	// don't even exist in the repository
+	n := (5 << 30) / preferredChunkSize
+	last.Num = uint(n)
+	arc := *snapshot.Archives[src]
+	arc.Chunks = []Chunk{last}
+	arc.Size = uint64(n*preferredChunkSize + len(data))
+	for i := 0; i < n; i++ {
+		arc.Chunks = append(arc.Chunks, Chunk{
+			Num:          uint(i),
+			Hash:         fmt.Sprintf("missing%d", i),
+			DataParts:    1,
+			OriginalSize: preferredChunkSize,
+		})
+	}
+
+	be := &recordingBackend{Backend: *r.backend.Backends[0]}
+	var b Backend = be
+	r.backend.Backends = []*Backend{&b}
+
+	d, err := ReadArchive(r, arc, int(arc.Size)-4096, 4096)
+	if err != nil {
+		t.Fatalf("Failed reading the tail of the archive: %s", err)
+	}
+	if !bytes.Equal(*d, data[len(data)-4096:]) {
+		t.Error("Data mismatch reading the tail of the archive")
+	}
+
+	be.mut.Lock()
+	defer be.mut.Unlock()
+	if len(be.loaded) != 1 || be.loaded[0] != last.Hash {
+		t.Errorf("Expected only the final chunk to be loaded, got %v", be.loaded)
+	}
+}
+
+// concurrencyBackend records how often each chunk got loaded and the maximum
+// amount of concurrent loads
+type concurrencyBackend struct {
+	Backend
+
+	mut     sync.Mutex
+	loads   map[string]int
+	current int
+	max     int
+}
+
+func (b *concurrencyBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	b.mut.Lock()
+	b.loads[shasum]++
+	b.current++
+	if b.current > b.max {
+		b.max = b.current
+	}
+	b.mut.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	defer func() {
+		b.mut.Lock()
+		b.current--
+		b.mut.Unlock()
+	}()
+	return b.Backend.LoadChunk(shasum, part, totalParts)
+}
+
+func TestArchiveReaderReadAhead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 8*(1<<20))
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+	if len(arc.Chunks) < 4 {
+		t.Fatalf("Expected at least 4 chunks, got %d", len(arc.Chunks))
+	}
+
+	be := &concurrencyBackend{Backend: *r.backend.Backends[0], loads: make(map[string]int)}
+	var b Backend = be
+	r.backend.Backends = []*Backend{&b}
+	r.SetChunkCacheSize(DefaultChunkCacheSize)
+	r.SetReadAhead(2)
+
+	f, err := OpenArchive(r, arc)
+	if err != nil {
+		t.Fatalf("Failed opening archive: %s", err)
+	}
+	defer f.Close()
+	d, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("Failed reading archive: %s", err)
+	}
+	if !bytes.Equal(d, data) {
+		t.Error("Data mismatch reading archive")
+	}
+
+	be.mut.Lock()
+	defer be.mut.Unlock()
+	for hash, n := range be.loads {
+		if n > 1 {
+			t.Errorf("Expected chunk %s to be loaded once, got %d loads", hash, n)
+		}
+	}
+	if be.max > 3 {
+		t.Errorf("Expected at most %d concurrent loads, got %d", 3, be.max)
+	}
+	if be.max < 2 {
+		t.Error("Expected chunks to be prefetched")
+	}
+}
+
+func TestRestorePath(t *testing.T) {
+	tests := []struct {
+		path        string
+		stripPrefix string
+		expected    string
+		ok          bool
+		err         bool
+	}{
+		{"/home/alice/project/main.go", "", "/tmp/dst/home/alice/project/main.go", true, false},
+		{"/home/alice/project/main.go", "/home/alice", "/tmp/dst/project/main.go", true, false},
+		{"/home/alice/project/main.go", "/home/alice/", "/tmp/dst/project/main.go", true, false},
+		{"/home/alice", "/home/alice", "/tmp/dst", true, false},
+		{"/home/alicia/main.go", "/home/alice", "", false, false},
+		{"/etc/passwd", "/home/alice", "", false, false},
+		{"../../etc/passwd", "", "", false, true},
+		{"/home/alice/../../../etc/passwd", "/home/alice", "", false, false},
+		{"project/../../etc/passwd", "project", "", false, false},
+		{"../etc/passwd", "..", "/tmp/dst/etc/passwd", true, false},
+	}
+
+	for _, tt := range tests {
+		opts := DefaultRestoreOptions()
+		opts.StripPrefix = tt.stripPrefix
+
+		path, ok, err := restorePath("/tmp/dst", tt.path, opts)
+		if tt.err {
+			if _, isPathErr := err.(*RestorePathError); !isPathErr {
+				t.Errorf("Expected RestorePathError for %s, got %v", tt.path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed mapping path %s: %s", tt.path, err)
+			continue
+		}
+		if ok != tt.ok || path != tt.expected {
+			t.Errorf("Expected %s (%v) for %s, got %s (%v)", tt.expected, tt.ok, tt.path, path, ok)
+		}
+	}
+}
+
+func TestCheckSymlinkTarget(t *testing.T) {
+	tests := []struct {
+		path   string
+		target string
+		valid  bool
+	}{
+		{"/tmp/dst/a/link", "file", true},
+		{"/tmp/dst/a/link", "../b/file", true},
+		{"/tmp/dst/a/link", "/tmp/dst/b/file", true},
+		{"/tmp/dst/a/link", "../../file", false},
+		{"/tmp/dst/a/link", "../../../etc/cron.d", false},
+		{"/tmp/dst/a/link", "/etc/cron.d", false},
+	}
+
+	for _, tt := range tests {
+		err := checkSymlinkTarget("/tmp/dst", tt.path, tt.target)
+		if tt.valid && err != nil {
+			t.Errorf("Expected symlink %s -> %s to be valid, got %s", tt.path, tt.target, err)
+		}
+		if _, isPathErr := err.(*RestorePathError); !tt.valid && !isPathErr {
+			t.Errorf("Expected RestorePathError for symlink %s -> %s, got %v", tt.path, tt.target, err)
+		}
+	}
+}
+
+func TestDecodeSnapshotHardLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "a")
+	link := filepath.Join(dir, "b")
+	data := writeRandomFile(t, src, 1024)
+	err = os.Link(src, link)
+	if err != nil {
+		t.Skipf("Hardlinks not supported: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src, link}, CompressionNone, 0)
+	links := 0
+	for _, arc := range snapshot.Archives {
+		if arc.LinkTarget != "" {
+			links++
+			if len(arc.Chunks) > 0 {
+				t.Errorf("Expected hardlink %s to be stored without chunks", arc.Path)
+			}
+		}
+	}
+	if links != 1 {
+		t.Fatalf("Expected 1 hardlink in snapshot, got %d", links)
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, DefaultRestoreOptions())
+	if err != nil {
+		t.Fatalf("Failed restoring snapshot: %s", err)
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Fatalf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+
+	fa, err := os.Stat(filepath.Join(targetdir, src))
+	if err != nil {
+		t.Fatalf("Failed to stat restored file: %s", err)
+	}
+	fb, err := os.Stat(filepath.Join(targetdir, link))
+	if err != nil {
+		t.Fatalf("Failed to stat restored hardlink: %s", err)
+	}
+	if !os.SameFile(fa, fb) {
+		t.Error("Expected restored hardlinks to share the same inode")
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(targetdir, link))
+	if err != nil {
+		t.Fatalf("Failed reading restored hardlink: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after restoring hardlink")
+	}
+}
+
+func TestDecodeArchiveOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "file")
+	data := writeRandomFile(t, src, 100)
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+
+	// existing files are longer than the restored one, so leftovers show
+	existing := bytes.Repeat([]byte("x"), 200)
+
+	tests := []struct {
+		policy   OverwritePolicy
+		age      int64 // age of the existing file relative to the archive
+		expected []byte
+		renamed  bool
+		err      bool
+		warning  bool
+	}{
+		{OverwriteReplace, 0, data, false, false, false},
+		{OverwriteSkip, 0, existing, false, false, true},
+		{OverwriteFail, 0, existing, false, true, false},
+		{OverwriteRename, 0, data, true, false, false},
+		{OverwriteIfNewer, 3600, data, false, false, false},
+		{OverwriteIfNewer, 0, existing, false, false, true},
+		{OverwriteIfNewer, -3600, existing, false, false, true},
+	}
+
+	for _, tt := range tests {
+		targetdir, err := ioutil.TempDir("", "knoxite.target")
+		if err != nil {
+			t.Fatalf("Failed creating temporary dir for restore: %s", err)
+		}
+		defer os.RemoveAll(targetdir)
+
+		path := filepath.Join(targetdir, "file")
+		err = ioutil.WriteFile(path, existing, 0644)
+		if err != nil {
+			t.Fatalf("Failed writing existing file: %s", err)
+		}
+		mtime := time.Unix(arc.ModTime-tt.age, 0)
+		err = os.Chtimes(path, mtime, mtime)
+		if err != nil {
+			t.Fatalf("Failed setting modification time: %s", err)
+		}
+
+		opts := DefaultRestoreOptions()
+		opts.Overwrite = tt.policy
+
+		progress := make(chan Progress)
+		warnings := make(chan int)
+		go func() {
+			n := 0
+			for p := range progress {
+				if _, ok := p.Warning.(*ExistError); ok {
+					n++
+				}
+			}
+			warnings <- n
+		}()
+		err = DecodeArchive(progress, r, arc, path, opts)
+		close(progress)
+
+		if _, ok := err.(*ExistError); tt.err != ok {
+			t.Errorf("Policy %d: unexpected error: %v", tt.policy, err)
+		}
+		if n := <-warnings; tt.warning != (n > 0) {
+			t.Errorf("Policy %d: unexpected amount of warnings: %d", tt.policy, n)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed reading restored file: %s", err)
+		}
+		if !bytes.Equal(b, tt.expected) {
+			t.Errorf("Policy %d: data mismatch after restore", tt.policy)
+		}
+
+		b, err = ioutil.ReadFile(path + ".orig")
+		if tt.renamed && (err != nil || !bytes.Equal(b, existing)) {
+			t.Errorf("Policy %d: expected existing file to be moved aside: %v", tt.policy, err)
+		}
+		if !tt.renamed && err == nil {
+			t.Errorf("Policy %d: existing file should not have been moved aside", tt.policy)
+		}
+	}
+}
+
+func TestDecodeArchiveErrors(t *testing.T) {
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	// a regular file where the restore expects a directory
+	blocker := filepath.Join(targetdir, "blocker")
+	writeRandomFile(t, blocker, 16)
+
+	readonly := filepath.Join(targetdir, "readonly")
+	err = os.Mkdir(readonly, 0555)
+	if err != nil {
+		t.Fatalf("Failed creating read-only dir: %s", err)
+	}
+	defer os.Chmod(readonly, 0755)
+	// permissions don't stop privileged users
+	privileged := os.Geteuid() == 0
+
+	tests := []struct {
+		arc      Archive
+		path     string
+		readonly bool
+	}{
+		{Archive{Path: "dir", Type: Directory, Mode: os.ModeDir | 0755}, filepath.Join(blocker, "dir"), false},
+		{Archive{Path: "link", Type: SymLink, PointsTo: "target"}, filepath.Join(blocker, "link"), false},
+		{Archive{Path: "file", Type: File, Mode: 0644}, filepath.Join(blocker, "file"), false},
+		{Archive{Path: "dir", Type: Directory, Mode: os.ModeDir | 0755}, filepath.Join(readonly, "dir"), true},
+		{Archive{Path: "link", Type: SymLink, PointsTo: "target"}, filepath.Join(readonly, "link"), true},
+		{Archive{Path: "file", Type: File, Mode: 0644}, filepath.Join(readonly, "file"), true},
+	}
+
+	for _, tt := range tests {
+		if tt.readonly && privileged {
+			continue
+		}
+
+		progress := make(chan Progress)
+		go func() {
+			for range progress {
+			}
+		}()
+		err = DecodeArchive(progress, Repository{}, tt.arc, tt.path, DefaultRestoreOptions())
+		close(progress)
+		if err == nil {
+			t.Errorf("Expected error restoring %s to %s", tt.arc.Path, tt.path)
+		}
+	}
+
+	// existing symlinks get replaced according to the overwrite policy
+	link := filepath.Join(targetdir, "link")
+	err = os.Symlink("old", link)
+	if err != nil {
+		t.Fatalf("Failed creating symlink: %s", err)
+	}
+	for _, policy := range []OverwritePolicy{OverwriteReplace, OverwriteFail} {
+		opts := DefaultRestoreOptions()
+		opts.Overwrite = policy
+
+		progress := make(chan Progress)
+		go func() {
+			for range progress {
+			}
+		}()
+		err = DecodeArchive(progress, Repository{}, Archive{Path: "link", Type: SymLink, PointsTo: "new"}, link, opts)
+		close(progress)
+		if _, ok := err.(*ExistError); ok != (policy == OverwriteFail) {
+			t.Errorf("Policy %d: unexpected error restoring symlink: %v", policy, err)
+		}
+	}
+	if target, err := os.Readlink(link); err != nil || target != "new" {
+		t.Errorf("Expected symlink to be replaced, got %s: %v", target, err)
+	}
+}
+
+func TestDecodeSnapshotContinueOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{}
+	data := make(map[string][]byte)
+	for _, name := range []string{"a", "b", "c"} {
+		src := filepath.Join(dir, name)
+		data[src] = writeRandomFile(t, src, 1024)
+		files = append(files, src)
+	}
+
+	repo := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repo, files, CompressionNone, 0)
+	broken := files[1]
+	corruptChunk(t, repo, snapshot.Archives[broken].Chunks[0])
+
+	for _, continueOnError := range []bool{false, true} {
+		targetdir, err := ioutil.TempDir("", "knoxite.target")
+		if err != nil {
+			t.Fatalf("Failed creating temporary dir for restore: %s", err)
+		}
+		defer os.RemoveAll(targetdir)
+
+		opts := DefaultRestoreOptions()
+		opts.ContinueOnError = continueOnError
+		progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, opts)
+		if err != nil {
+			t.Fatalf("Failed restoring snapshot: %s", err)
+		}
+
+		var errs []Progress
+		for p := range progress {
+			if p.Error != nil {
+				errs = append(errs, p)
+			}
+		}
+
+		if !continueOnError {
+			if len(errs) != 1 {
+				t.Errorf("Expected restore to abort after the first error, got %d errors", len(errs))
+			}
+			continue
+		}
+
+		if len(errs) != 2 {
+			t.Fatalf("Expected 2 errors, got %d", len(errs))
+		}
+		if errs[0].Path != broken {
+			t.Errorf("Expected error for %s, got %s: %s", broken, errs[0].Path, errs[0].Error)
+		}
+		if ierr, ok := errs[1].Error.(*IncompleteRestoreError); !ok || ierr.Failed != 1 || ierr.Total != len(files) {
+			t.Errorf("Expected IncompleteRestoreError for 1 of %d archives, got %v", len(files), errs[1].Error)
+		}
+
+		for _, src := range files {
+			if src == broken {
+				continue
+			}
+			b, err := ioutil.ReadFile(filepath.Join(targetdir, src))
+			if err != nil {
+				t.Errorf("Failed reading restored file: %s", err)
+			} else if !bytes.Equal(b, data[src]) {
+				t.Errorf("Data mismatch for %s", src)
+			}
+		}
+	}
+}
+
+func TestDecodeSnapshotFiltered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"docs", "node_modules"} {
+		err = os.Mkdir(filepath.Join(dir, d), 0755)
+		if err != nil {
+			t.Fatalf("Failed creating source dir: %s", err)
+		}
+	}
+	writeRandomFile(t, filepath.Join(dir, "docs", "a.pdf"), 2048)
+	writeRandomFile(t, filepath.Join(dir, "docs", "b.txt"), 1024)
+	writeRandomFile(t, filepath.Join(dir, "c.pdf"), 512)
+	excluded := filepath.Join(dir, "node_modules", "d.pdf")
+	writeRandomFile(t, excluded, 256)
+
+	r, snapshot := setupDecodeTest(t, "memory://TestDecodeSnapshotFiltered", []string{dir}, CompressionNone, 0)
+	be := (*r.BackendManager().Backends[0]).(*MemoryBackend)
+	r.SetChunkCacheSize(0)
+
+	// excluded files must not be loaded at all
+	for _, chunk := range snapshot.Archives[excluded].Chunks {
+		be.FailPart(chunk.Hash, 0, errors.New("simulated failure"))
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	progress, err := DecodeSnapshotFiltered(r, snapshot, targetdir, []string{"**/*.pdf"}, []string{"node_modules/"})
+	if err != nil {
+		t.Fatalf("Failed restoring snapshot: %s", err)
+	}
+	items := make(map[string]Stats)
+	for p := range progress {
+		if p.Error != nil {
+			t.Fatalf("Failed restoring snapshot: %s", p.Error)
+		}
+		items[p.Path] = p.TotalStatistics
+	}
+	var stats Stats
+	for _, s := range items {
+		stats.Add(s)
+	}
+	if stats.Files != 2 || stats.Dirs != 0 || stats.Transferred != 2048+512 {
+		t.Errorf("Unexpected restore statistics: %+v", stats)
+	}
+
+	for _, p := range []string{filepath.Join(dir, "docs", "a.pdf"), filepath.Join(dir, "c.pdf")} {
+		if _, err := os.Stat(filepath.Join(targetdir, p)); err != nil {
+			t.Errorf("Expected %s to be restored: %s", p, err)
+		}
+	}
+	for _, p := range []string{filepath.Join(dir, "docs", "b.txt"), excluded} {
+		if _, err := os.Stat(filepath.Join(targetdir, p)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be restored", p)
+		}
+	}
+
+	if _, err = DecodeSnapshotFiltered(r, snapshot, targetdir, []string{"[a-"}, nil); err == nil {
+		t.Error("Expected malformed include pattern to fail")
+	}
+}
+
+func TestDecodeSnapshotCompletedPhase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.Mkdir(src, 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	writeRandomFile(t, filepath.Join(src, "a"), 3*preferredChunkSize)
+	err = os.Link(filepath.Join(src, "a"), filepath.Join(src, "b"))
+	if err != nil {
+		t.Fatalf("Failed creating hardlink: %s", err)
+	}
+	err = os.Symlink("a", filepath.Join(src, "link"))
+	if err != nil {
+		t.Fatalf("Failed creating symlink: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	for _, dryRun := range []bool{true, false} {
+		targetdir, err := ioutil.TempDir("", "knoxite.target")
+		if err != nil {
+			t.Fatalf("Failed creating temporary dir for restore: %s", err)
+		}
+		defer os.RemoveAll(targetdir)
+
+		opts := DefaultRestoreOptions()
+		opts.DryRun = dryRun
+		progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, opts)
+		if err != nil {
+			t.Fatalf("Failed restoring snapshot: %s", err)
+		}
+
+		completed := make(map[string]int)
+		for p := range progress {
+			if p.Error != nil {
+				t.Fatalf("Failed restoring snapshot: %s", p.Error)
+			}
+			if p.Phase == PhaseCompleted {
+				completed[p.Path]++
+			}
+		}
+
+		if len(completed) != len(snapshot.Archives) {
+			t.Errorf("Expected %d completed archives, got %d (dry run: %t)", len(snapshot.Archives), len(completed), dryRun)
+		}
+		for path, n := range completed {
+			if n != 1 {
+				t.Errorf("Expected one completion of %s, got %d (dry run: %t)", path, n, dryRun)
+			}
+		}
+	}
+}
+
+func TestRestoreFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	for _, name := range []string{"sub/x", "sub/y", "c.conf", "d.txt"} {
+		writeRandomFile(t, filepath.Join(src, name), 1024)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	progress, err := RestoreFiles(r, snapshot, targetdir, []string{filepath.Join(src, "sub", "x"), "*.conf"})
+	if err != nil {
+		t.Fatalf("Failed restoring snapshot: %s", err)
+	}
+	var restored, skipped int
+	for p := range progress {
+		if p.Error != nil {
+			t.Fatalf("Failed restoring snapshot: %s", p.Error)
+		}
+		switch p.Phase {
+		case PhaseCompleted:
+			restored++
+		case PhaseSkipped:
+			skipped++
+		}
+	}
+	// src and src/sub get skipped, too
+	if restored != 2 || skipped != 4 {
+		t.Errorf("Expected 2 restored and 4 skipped archives, got %d and %d", restored, skipped)
+	}
+
+	for _, name := range []string{"sub/x", "c.conf"} {
+		if _, err := os.Stat(filepath.Join(targetdir, src, name)); err != nil {
+			t.Errorf("Expected %s to be restored: %s", name, err)
+		}
+	}
+	for _, name := range []string{"sub/y", "d.txt"} {
+		if _, err := os.Stat(filepath.Join(targetdir, src, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be restored", name)
+		}
+	}
+}
+
+func TestDecodeSnapshotArchiveConcurrency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, "sub", "deeper"), 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	files := make(map[string][]byte)
+	for i := 0; i < 16; i++ {
+		p := filepath.Join(src, "sub", "deeper", fmt.Sprintf("%d", i))
+		files[p] = writeRandomFile(t, p, 1024)
+	}
+	err = os.Chmod(filepath.Join(src, "sub"), 0700)
+	if err != nil {
+		t.Fatalf("Failed changing mode: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	r.SetChunkCacheSize(0)
+
+	for _, workers := range []int{1, 8} {
+		be := &concurrencyBackend{Backend: *r.backend.Backends[0], loads: make(map[string]int)}
+		var b Backend = be
+		rb := r
+		rb.backend.Backends = []*Backend{&b}
+
+		targetdir, err := ioutil.TempDir("", "knoxite.target")
+		if err != nil {
+			t.Fatalf("Failed creating temporary dir for restore: %s", err)
+		}
+		defer os.RemoveAll(targetdir)
+
+		opts := DefaultRestoreOptions()
+		opts.ArchiveConcurrency = workers
+		progress, err := DecodeSnapshot(rb, snapshot, targetdir, []string{}, opts)
+		if err != nil {
+			t.Fatalf("Failed restoring snapshot: %s", err)
+		}
+		for p := range progress {
+			if p.Error != nil {
+				t.Fatalf("Failed restoring snapshot: %s", p.Error)
+			}
+		}
+
+		if workers == 1 && be.max != 1 {
+			t.Errorf("Expected files to be restored one by one, got %d concurrent loads", be.max)
+		}
+		if workers > 1 && be.max < 2 {
+			t.Errorf("Expected files to be restored concurrently, got %d concurrent loads", be.max)
+		}
+
+		for p, data := range files {
+			b, err := ioutil.ReadFile(filepath.Join(targetdir, p))
+			if err != nil || !bytes.Equal(b, data) {
+				t.Errorf("Data mismatch for %s: %v", p, err)
+			}
+		}
+		fi, err := os.Stat(filepath.Join(targetdir, src, "sub"))
+		if err != nil {
+			t.Fatalf("Failed to stat restored dir: %s", err)
+		}
+		if fi.Mode().Perm() != 0700 {
+			t.Errorf("Expected restored dir to have mode 0700, got %s", fi.Mode())
+		}
+	}
+}
+
+func TestDecodeSnapshotReadOnlyDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, "readonly"), 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	p := filepath.Join(src, "readonly", "file")
+	data := writeRandomFile(t, p, 1024)
+	err = os.Chmod(filepath.Join(src, "readonly"), 0500)
+	if err != nil {
+		t.Fatalf("Failed changing mode: %s", err)
+	}
+	defer os.Chmod(filepath.Join(src, "readonly"), 0700)
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+	defer os.Chmod(filepath.Join(targetdir, src, "readonly"), 0700)
+
+	opts := DefaultRestoreOptions()
+	opts.ArchiveConcurrency = 4
+	progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, opts)
+	if err != nil {
+		t.Fatalf("Failed restoring snapshot: %s", err)
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Fatalf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(targetdir, p))
+	if err != nil || !bytes.Equal(b, data) {
+		t.Errorf("Data mismatch for %s: %v", p, err)
+	}
+	fi, err := os.Stat(filepath.Join(targetdir, src, "readonly"))
+	if err != nil {
+		t.Fatalf("Failed to stat restored directory: %s", err)
+	}
+	if fi.Mode().Perm() != 0500 {
+		t.Errorf("Expected directory to be restored with mode 0500, got %o", fi.Mode().Perm())
+	}
+}
+
+func TestDecodeSnapshotDirModTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	for i := 0; i < 4; i++ {
+		writeRandomFile(t, filepath.Join(src, "sub", fmt.Sprintf("%d", i)), 1024)
+	}
+	mtimes := map[string]time.Time{
+		src:                       time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC),
+		filepath.Join(src, "sub"): time.Date(2016, 4, 2, 12, 0, 0, 0, time.UTC),
+	}
+	for p, mtime := range mtimes {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("Failed changing modification time: %s", err)
+		}
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, DefaultRestoreOptions())
+	if err != nil {
+		t.Fatalf("Failed restoring snapshot: %s", err)
+	}
+	for p := range progress {
+		if p.Error != nil {
+			t.Fatalf("Failed restoring snapshot: %s", p.Error)
+		}
+	}
+
+	for p, mtime := range mtimes {
+		fi, err := os.Stat(filepath.Join(targetdir, p))
+		if err != nil {
+			t.Fatalf("Failed to stat restored directory: %s", err)
+		}
+		if !fi.ModTime().Equal(mtime) {
+			t.Errorf("Expected %s to be restored with modification time %s, got %s", p, mtime, fi.ModTime())
+		}
+	}
+}
+
+func TestDecodeSnapshotFreeSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"decode.go"}, CompressionNone, 0)
+	// pretend the file is way bigger than any disk
+	arc := *snapshot.Archives["decode.go"]
+	arc.Size = 1 << 62
+	snapshot.Archives["decode.go"] = &arc
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	_, err = DecodeSnapshot(r, snapshot, targetdir, []string{}, DefaultRestoreOptions())
+	if _, ok := err.(*InsufficientSpaceError); !ok {
+		t.Fatalf("Expected InsufficientSpaceError, got %v", err)
+	}
+	if fis, _ := ioutil.ReadDir(targetdir); len(fis) > 0 {
+		t.Errorf("Expected nothing to be written to the destination, found %s", fis[0].Name())
+	}
+
+	opts := DefaultRestoreOptions()
+	opts.Force = true
+	progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, opts)
+	if err != nil {
+		t.Fatalf("Failed restoring snapshot: %s", err)
+	}
+	for range progress {
+	}
+}
+
+func TestDecodeSnapshotUnwritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	writeRandomFile(t, filepath.Join(src, "sub", "file"), 1024)
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	// a regular file can't be restored into, not even by privileged users
+	dst := filepath.Join(dir, "blocker")
+	writeRandomFile(t, dst, 16)
+
+	for _, checkpoint := range []bool{true, false} {
+		opts := DefaultRestoreOptions()
+		opts.Checkpoint = checkpoint
+		progress, err := DecodeSnapshot(r, snapshot, dst, []string{}, opts)
+		if err != nil {
+			continue
+		}
+
+		failed := false
+		for p := range progress {
+			failed = failed || p.Error != nil
+		}
+		if !failed {
+			t.Errorf("Expected restoring to %s to fail (checkpoint %t)", dst, checkpoint)
+		}
+	}
+}
+
+func TestDecodeSnapshotDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.Mkdir(src, 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	writeRandomFile(t, filepath.Join(src, "a"), 3*preferredChunkSize)
+	writeRandomFile(t, filepath.Join(src, "b"), 1024)
+	err = os.Symlink("a", filepath.Join(src, "link"))
+	if err != nil {
+		t.Fatalf("Failed creating symlink: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	// restore returns the accumulated final statistics of every item
+	restore := func(targetdir string, dryRun bool) Stats {
+		opts := DefaultRestoreOptions()
+		opts.DryRun = dryRun
+		progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, opts)
+		if err != nil {
+			t.Fatalf("Failed restoring snapshot: %s", err)
+		}
+
+		items := make(map[string]Stats)
+		for p := range progress {
+			if p.Error != nil {
+				t.Fatalf("Failed restoring snapshot: %s", p.Error)
+			}
+			items[p.Path] = p.TotalStatistics
+		}
+
+		var stats Stats
+		for _, s := range items {
+			stats.Add(s)
+		}
+		return stats
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	dry := restore(targetdir, true)
+	entries, err := ioutil.ReadDir(targetdir)
+	if err != nil {
+		t.Fatalf("Failed reading target dir: %s", err)
+	}
+	if len(entries) > 0 {
+		t.Errorf("Expected dry run to not write anything, found %d entries", len(entries))
+	}
+
+	stats := restore(targetdir, false)
+	if dry != stats {
+		t.Errorf("Expected dry run statistics %v to match restore %v", dry, stats)
+	}
+	if stats.Files != 2 || stats.SymLinks != 1 || stats.Transferred != 3*preferredChunkSize+1024 {
+		t.Errorf("Unexpected restore statistics: %+v", stats)
+	}
+}
+
+func TestDecodeArchiveDryRunConflicts(t *testing.T) {
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	path := filepath.Join(targetdir, "file")
+	existing := writeRandomFile(t, path, 100)
+	arc := Archive{Path: "file", Type: File, Mode: 0644}
+
+	for _, policy := range []OverwritePolicy{OverwriteReplace, OverwriteSkip, OverwriteFail, OverwriteRename} {
+		opts := DefaultRestoreOptions()
+		opts.DryRun = true
+		opts.Overwrite = policy
+
+		progress := make(chan Progress)
+		warnings := make(chan int)
+		go func() {
+			n := 0
+			for p := range progress {
+				if _, ok := p.Warning.(*ExistError); ok {
+					n++
+				}
+			}
+			warnings <- n
+		}()
+		err = DecodeArchive(progress, Repository{}, arc, path, opts)
+		close(progress)
+		n := <-warnings
+
+		if policy == OverwriteFail {
+			if _, ok := err.(*ExistError); !ok {
+				t.Errorf("Policy %d: expected ExistError, got %v", policy, err)
+			}
+		} else if err != nil || n != 1 {
+			t.Errorf("Policy %d: expected conflict warning, got %d warnings, error %v", policy, n, err)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil || !bytes.Equal(b, existing) {
+			t.Errorf("Policy %d: dry run modified existing file: %v", policy, err)
+		}
+		if _, err := os.Lstat(path + ".orig"); !os.IsNotExist(err) {
+			t.Errorf("Policy %d: dry run moved existing file aside", policy)
+		}
+	}
+}
+
+func TestLoadChunkStoredChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "file")
+	writeRandomFile(t, src, 1024)
+
+	repo := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repo, []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+	corruptChunk(t, repo, arc.Chunks[0])
+
+	_, err = loadChunk(r, arc, arc.Chunks[0])
+	cerr, ok := err.(*CheckSumError)
+	if !ok {
+		t.Fatalf("Expected CheckSumError, got %v", err)
+	}
+	if cerr.Method != "highwayhash-stored" {
+		t.Errorf("Expected checksum error for stored data, got %s", cerr.Method)
+	}
+}
+
+// delayedPartBackend delays loading a single part of every chunk
+type delayedPartBackend struct {
+	Backend
+
+	part  uint
+	delay time.Duration
+}
+
+func (b *delayedPartBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	if part == b.part {
+		time.Sleep(b.delay)
+	}
+	return b.Backend.LoadChunk(shasum, part, totalParts)
+}
+
+func TestLoadChunkCorruptedPart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "file")
+	data := writeRandomFile(t, src, 1024)
+
+	repo := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repo, []string{src}, CompressionNone, 1)
+	arc := *snapshot.Archives[src]
+	corruptChunk(t, repo, arc.Chunks[0])
+
+	// make sure the corrupted part arrives first
+	var be Backend = &delayedPartBackend{Backend: *r.backend.Backends[0], part: 1, delay: 50 * time.Millisecond}
+	r.backend.Backends = []*Backend{&be}
+
+	// the corrupted part gets rebuilt from the parity part
+	b, missing, err := loadChunkParts(r, arc, arc.Chunks[0])
+	if err != nil {
+		t.Fatalf("Failed loading chunk: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after loading chunk")
+	}
+	if fmt.Sprint(missing) != "[0]" {
+		t.Errorf("Expected part 0 to be reported as corrupted, got %v", missing)
+	}
+
+	// with both parts corrupted, the stored checksum can't be matched
+	parity, err := filepath.Glob(filepath.Join(repo, chunksDirname, "*", "*", arc.Chunks[0].Hash+".1_1"))
+	if err != nil || len(parity) != 1 {
+		t.Fatalf("Failed finding parity part: %v", err)
+	}
+	pb, err := ioutil.ReadFile(parity[0])
+	if err != nil {
+		t.Fatalf("Failed reading parity part: %s", err)
+	}
+	pb[0] ^= 0xff
+	if err = ioutil.WriteFile(parity[0], pb, 0600); err != nil {
+		t.Fatalf("Failed corrupting parity part: %s", err)
+	}
+	_, err = loadChunk(r, arc, arc.Chunks[0])
+	if cerr, ok := err.(*CheckSumError); !ok || cerr.Method != "highwayhash-stored" {
+		t.Errorf("Expected checksum error for stored data, got %v", err)
+	}
+}
+
+func TestLoadChunkParityParts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 1024)
+
+	repodir := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repodir, []string{src}, CompressionNone, 2)
+	arc := *snapshot.Archives[src]
+	chunk := arc.Chunks[0]
+	if chunk.DataParts != 1 || chunk.ParityParts != 2 {
+		t.Fatalf("Expected 1 data and 2 parity parts, got %d and %d", chunk.DataParts, chunk.ParityParts)
+	}
+
+	// remove parts one by one, the chunk can be reconstructed as long as
+	// any single part is left
+	for part := 0; part < 3; part++ {
+		err = os.Remove(filepath.Join(repodir, chunksDirname, SubDirForChunk(chunk.Hash), fmt.Sprintf("%s.%d_1", chunk.Hash, part)))
+		if err != nil {
+			t.Fatalf("Failed removing chunk part: %s", err)
+		}
+
+		b, err := loadChunk(r, arc, chunk)
+		if part < 2 {
+			if err != nil {
+				t.Fatalf("Failed loading chunk with %d missing parts: %s", part+1, err)
+			}
+			if !bytes.Equal(b, data) {
+				t.Errorf("Data mismatch with %d missing parts", part+1)
+			}
+			continue
+		}
+
+		derr, ok := err.(*DataReconstructionError)
+		if !ok {
+			t.Fatalf("Expected DataReconstructionError, got %v", err)
+		}
+		if derr.BlocksFound != 0 || derr.FailedBackends != 3 {
+			t.Errorf("Expected 0 parts found and 3 failed, got %d and %d", derr.BlocksFound, derr.FailedBackends)
+		}
+		if fmt.Sprint(derr.MissingParts) != "[0 1 2]" {
+			t.Errorf("Expected parts [0 1 2] to be missing, got %v", derr.MissingParts)
+		}
+	}
+}
+
+// recordingLogger keeps all debug messages it receives
+type recordingLogger struct {
+	nopLogger
+
+	mut   sync.Mutex
+	debug []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func TestDecodeArchiveDataCacheStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 3*preferredChunkSize)
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+	chunks := uint64(len(arc.Chunks))
+
+	b, stats, err := DecodeArchiveData(r, arc)
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after decoding archive")
+	}
+	if stats.Chunks != chunks || stats.CachedChunks != 0 {
+		t.Errorf("Expected %d loaded and 0 cached chunks, got %d and %d", chunks, stats.Chunks, stats.CachedChunks)
+	}
+
+	// the second run gets served entirely from the chunk cache
+	l := &recordingLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+	_, stats, err = DecodeArchiveData(r, arc)
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+	if stats.Chunks != 0 || stats.CachedChunks != chunks {
+		t.Errorf("Expected 0 loaded and %d cached chunks, got %d and %d", chunks, stats.Chunks, stats.CachedChunks)
+	}
+	if stats.CachedSize != arc.StorageSize {
+		t.Errorf("Expected %d cached bytes, got %d", arc.StorageSize, stats.CachedSize)
+	}
+	if uint64(len(l.debug)) != chunks {
+		t.Errorf("Expected %d debug messages about cached chunks, got %d", chunks, len(l.debug))
+	}
+}
+
+// slowBackend delays every successful LoadChunk call, so failing parts are
+// known before a chunk gets reconstructed
+type slowBackend struct {
+	Backend
+}
+
+func (b *slowBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	d, err := b.Backend.LoadChunk(shasum, part, totalParts)
+	if err == nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return d, err
+}
+
+func TestDecodeArchiveReconstructionWarning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 2*preferredChunkSize)
+
+	repodir := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repodir, []string{src}, CompressionNone, 2)
+	arc := *snapshot.Archives[src]
+	*r.backend.Backends[0] = &slowBackend{*r.backend.Backends[0]}
+
+	// degrade the first chunk
+	idx, err := arc.IndexOfChunk(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := arc.Chunks[idx]
+	for part := 0; part < 2; part++ {
+		err = os.Remove(filepath.Join(repodir, chunksDirname, SubDirForChunk(chunk.Hash), fmt.Sprintf("%s.%d_1", chunk.Hash, part)))
+		if err != nil {
+			t.Fatalf("Failed removing chunk part: %s", err)
+		}
+	}
+
+	warnings := make(chan []*ReconstructionWarning)
+	progress := make(chan Progress)
+	go func() {
+		var w []*ReconstructionWarning
+		for p := range progress {
+			if rw, ok := p.Warning.(*ReconstructionWarning); ok {
+				w = append(w, rw)
+			}
+		}
+		warnings <- w
+	}()
+	path := filepath.Join(dir, "restored")
+	err = DecodeArchive(progress, r, arc, path, DefaultRestoreOptions())
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+
+	w := <-warnings
+	if len(w) != 1 {
+		t.Fatalf("Expected 1 reconstruction warning, got %d", len(w))
+	}
+	if w[0].Chunk.Hash != chunk.Hash || fmt.Sprint(w[0].MissingParts) != "[0 1]" || w[0].Offset != 0 {
+		t.Errorf("Unexpected reconstruction warning: %s", w[0])
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading restored file: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after restoring a degraded archive")
+	}
+}
+
+// missingPartsBackend fails loading the missing parts right away and takes
+// its time delivering all others
+type missingPartsBackend struct {
+	Backend
+
+	missing map[uint]bool
+}
+
+func (b *missingPartsBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	if b.missing[part] {
+		return nil, os.ErrNotExist
+	}
+	time.Sleep(2 * time.Second)
+	return []byte{}, nil
+}
+
+func TestLoadChunkTooManyPartsMissing(t *testing.T) {
+	var be Backend = &missingPartsBackend{missing: map[uint]bool{0: true, 2: true}}
+	r := Repository{
+		backend: BackendManager{
+			Backends:    []*Backend{&be},
+			RetryPolicy: DefaultRetryPolicy,
+		},
+	}
+	chunk := Chunk{Hash: "chunk", DataParts: 2, ParityParts: 1}
+
+	start := time.Now()
+	_, err := loadChunk(r, Archive{}, chunk)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected loading the chunk to fail fast, took %s", d)
+	}
+	derr, ok := err.(*DataReconstructionError)
+	if !ok {
+		t.Fatalf("Expected DataReconstructionError, got %v", err)
+	}
+	if fmt.Sprint(derr.MissingParts) != "[0 2]" {
+		t.Errorf("Expected parts [0 2] to be missing, got %v", derr.MissingParts)
+	}
+}
+
+func TestDecodeArchiveDataDedup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 8192)
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	// an archive consisting of the same chunk three times
+	arc := *snapshot.Archives[src]
+	chunk := arc.Chunks[0]
+	arc.Chunks = nil
+	for i := uint(0); i < 3; i++ {
+		chunk.Num = i
+		arc.Chunks = append(arc.Chunks, chunk)
+	}
+	arc.Size = uint64(3 * len(data))
+	expected := bytes.Repeat(data, 3)
+
+	b, stats, err := DecodeArchiveData(r, arc)
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+	if !bytes.Equal(b, expected) {
+		t.Error("Data mismatch after decoding archive")
+	}
+	if stats.DedupChunks != 2 || stats.DedupSize != uint64(2*len(data)) {
+		t.Errorf("Expected 2 deduplicated chunks with %d bytes, got %d with %d bytes", 2*len(data), stats.DedupChunks, stats.DedupSize)
+	}
+
+	var buf bytes.Buffer
+	progress := make(chan Progress, 64)
+	err = DecodeArchiveToWriter(progress, r, arc, &buf)
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Error("Data mismatch after decoding archive")
+	}
+	var p Progress
+	for p = range progress {
+	}
+	if p.TotalStatistics.DedupChunks != 2 || p.TotalStatistics.DedupSize != uint64(2*len(data)) {
+		t.Errorf("Expected 2 deduplicated chunks with %d bytes, got %d with %d bytes", 2*len(data), p.TotalStatistics.DedupChunks, p.TotalStatistics.DedupSize)
+	}
+}
+
+func TestDecodeSnapshotDedup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// identical files stored as separate archives sharing their chunk
+	src := filepath.Join(dir, "src")
+	err = os.Mkdir(src, 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	data := writeRandomFile(t, filepath.Join(src, "a"), 8192)
+	for _, name := range []string{"b", "c"} {
+		err = ioutil.WriteFile(filepath.Join(src, name), data, 0644)
+		if err != nil {
+			t.Fatalf("Failed writing %s: %s", name, err)
+		}
+	}
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	progress, err := DecodeSnapshot(r, snapshot, filepath.Join(dir, "restore"), []string{}, DefaultRestoreOptions())
+	if err != nil {
+		t.Fatalf("Failed restoring snapshot: %s", err)
+	}
+	var stats Stats
+	for p := range progress {
+		if p.Error != nil {
+			t.Fatalf("Failed restoring snapshot: %s", p.Error)
+		}
+		if p.Phase == PhaseCompleted {
+			stats.Add(p.TotalStatistics)
+		}
+	}
+	if stats.DedupChunks != 2 || stats.DedupSize != uint64(2*len(data)) {
+		t.Errorf("Expected 2 deduplicated chunks with %d bytes, got %d with %d bytes", 2*len(data), stats.DedupChunks, stats.DedupSize)
+	}
+}
+
+// latencyBackend serves chunk parts from memory after a fixed delay
+type latencyBackend struct {
+	Backend
+
+	parts [][]byte
+	delay time.Duration
+}
+
+func (b *latencyBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	time.Sleep(b.delay)
+	return b.parts[part], nil
+}
+
+func TestLoadChunkPartsConcurrently(t *testing.T) {
+	data := bytes.Repeat([]byte("knoxite"), 10000)
+	parts, err := redundantData(data, 6, 2)
+	if err != nil {
+		t.Fatalf("Failed splitting data: %s", err)
+	}
+
+	var be Backend = &latencyBackend{parts: parts, delay: 100 * time.Millisecond}
+	r := Repository{
+		backend: BackendManager{
+			Backends:    []*Backend{&be},
+			RetryPolicy: DefaultRetryPolicy,
+		},
+	}
+	chunk := Chunk{
+		Hash:          Hash(data, HashHighway256),
+		DecryptedHash: Hash(data, HashHighway256),
+		DataParts:     6,
+		ParityParts:   2,
+		Size:          len(data),
+	}
+
+	// loading the parts one after another would take at least 600ms
+	start := time.Now()
+	b, err := loadChunk(r, Archive{}, chunk)
+	if err != nil {
+		t.Fatalf("Failed loading chunk: %s", err)
+	}
+	if d := time.Since(start); d > 300*time.Millisecond {
+		t.Errorf("Expected parts to be loaded concurrently, took %s", d)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after loading chunk")
+	}
+}
+
+func TestDecodeArchiveLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	writeRandomFile(t, src, 3*preferredChunkSize)
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+
+	l := &recordingLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	err = DecodeArchive(make(chan Progress, 64), r, arc, filepath.Join(dir, "restored"), DefaultRestoreOptions())
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+
+	loads := 0
+	for _, msg := range l.debug {
+		if strings.HasPrefix(msg, "Loading chunk") {
+			loads++
+		}
+	}
+	if loads != len(arc.Chunks) {
+		t.Errorf("Expected %d chunk loads to be logged, got %d", len(arc.Chunks), loads)
+	}
+}
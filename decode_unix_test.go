@@ -0,0 +1,165 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestDecodeArchiveOwnership(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"decode.go"}, CompressionNone, 0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	// an owner we can only restore with root privileges
+	arc := *snapshot.Archives["decode.go"]
+	arc.UID = uint32(os.Getuid() + 12345)
+	arc.GID = uint32(os.Getgid() + 12345)
+
+	restore := func(path string, opts RestoreOptions) (uint32, []error) {
+		var warnings []error
+		progress := make(chan Progress)
+		done := make(chan struct{})
+		go func() {
+			for p := range progress {
+				if p.Warning != nil {
+					warnings = append(warnings, p.Warning)
+				}
+			}
+			close(done)
+		}()
+		err := DecodeArchive(progress, r, arc, path, opts)
+		close(progress)
+		<-done
+		if err != nil {
+			t.Fatalf("Failed restoring archive: %s", err)
+		}
+
+		var st syscall.Stat_t
+		if err := syscall.Lstat(path, &st); err != nil {
+			t.Fatalf("Failed to stat restored file: %s", err)
+		}
+		return st.Uid, warnings
+	}
+
+	opts := DefaultRestoreOptions()
+	opts.PreserveOwnership = false
+	uid, warnings := restore(filepath.Join(targetdir, "unowned"), opts)
+	if uid != uint32(os.Getuid()) || len(warnings) > 0 {
+		t.Errorf("Expected file owned by %d without warnings, got owner %d and %v", os.Getuid(), uid, warnings)
+	}
+
+	uid, warnings = restore(filepath.Join(targetdir, "owned"), DefaultRestoreOptions())
+	if os.Getuid() == 0 {
+		if uid != arc.UID {
+			t.Errorf("Expected file owned by %d, got %d", arc.UID, uid)
+		}
+		return
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", warnings)
+	}
+	if _, ok := warnings[0].(*OwnershipError); !ok {
+		t.Errorf("Expected OwnershipError, got %v", warnings[0])
+	}
+}
+
+func TestDecodeArchiveDirMode(t *testing.T) {
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	oldmask := syscall.Umask(022)
+	defer syscall.Umask(oldmask)
+
+	// a new directory and one which already exists with a different mode
+	existing := filepath.Join(targetdir, "existing")
+	if err := os.Mkdir(existing, 0755); err != nil {
+		t.Fatalf("Failed creating directory: %s", err)
+	}
+
+	for _, path := range []string{filepath.Join(targetdir, "new"), existing} {
+		arc := Archive{Path: filepath.Base(path), Type: Directory, Mode: os.ModeDir | 0700}
+		err = DecodeArchive(make(chan Progress, 8), Repository{}, arc, path, DefaultRestoreOptions())
+		if err != nil {
+			t.Fatalf("Failed restoring directory: %s", err)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat restored directory: %s", err)
+		}
+		if fi.Mode().Perm() != 0700 {
+			t.Errorf("Expected %s to be restored with mode 0700, got %o", path, fi.Mode().Perm())
+		}
+	}
+}
+
+func TestDecodeArchiveSymlink(t *testing.T) {
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	link := filepath.Join(targetdir, "link")
+	arc := Archive{Path: "link", Type: SymLink, PointsTo: "target", ModTime: 1500000000}
+
+	// restoring the same symlink twice, then over an existing file
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			if err := os.Remove(link); err != nil {
+				t.Fatalf("Failed removing symlink: %s", err)
+			}
+			if err := ioutil.WriteFile(link, []byte("data"), 0644); err != nil {
+				t.Fatalf("Failed creating file: %s", err)
+			}
+		}
+
+		progress := make(chan Progress, 8)
+		err = DecodeArchive(progress, Repository{}, arc, link, DefaultRestoreOptions())
+		close(progress)
+		if err != nil {
+			t.Fatalf("Failed restoring symlink: %s", err)
+		}
+		for p := range progress {
+			if p.Warning != nil && os.Getuid() == 0 {
+				t.Errorf("Unexpected warning restoring symlink: %s", p.Warning)
+			}
+		}
+
+		if target, err := os.Readlink(link); err != nil || target != arc.PointsTo {
+			t.Errorf("Expected symlink to %s, got %s: %v", arc.PointsTo, target, err)
+		}
+		fi, err := os.Lstat(link)
+		if err != nil {
+			t.Fatalf("Failed to stat restored symlink: %s", err)
+		}
+		if fi.ModTime().Unix() != arc.ModTime {
+			t.Errorf("Expected symlink modification time %d, got %d", arc.ModTime, fi.ModTime().Unix())
+		}
+	}
+}
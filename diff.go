@@ -0,0 +1,119 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "sort"
+
+// Changes between two snapshots
+const (
+	Unchanged   = iota // Archive is identical in both snapshots
+	Added              // Archive only exists in the newer snapshot
+	Removed            // Archive only exists in the older snapshot
+	Modified           // Archive's content or metadata changed
+	TypeChanged        // Archive changed its type, e.g. a file became a directory
+)
+
+// DiffEntry describes how an archive differs between two snapshots
+type DiffEntry struct {
+	Path   string
+	Change uint8
+	Old    *Archive // nil if the archive has been added
+	New    *Archive // nil if the archive has been removed
+}
+
+// DiffSnapshots compares the snapshots with the IDs a and b, where a is
+// considered to be the older one
+func DiffSnapshots(repository Repository, a, b string) ([]DiffEntry, error) {
+	_, sa, err := repository.FindSnapshot(a)
+	if err != nil {
+		return nil, err
+	}
+	_, sb, err := repository.FindSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return sa.Diff(sb), nil
+}
+
+// Diff compares the archives of snapshot with those of a newer snapshot by
+// path. Content changes get detected by the chunk checksums, so no data
+// needs to be loaded. The entries are sorted by path
+func (snapshot *Snapshot) Diff(newer *Snapshot) []DiffEntry {
+	var diff []DiffEntry
+	for path, old := range snapshot.Archives {
+		arc, ok := newer.Archives[path]
+		if !ok {
+			diff = append(diff, DiffEntry{Path: path, Change: Removed, Old: old})
+			continue
+		}
+
+		diff = append(diff, DiffEntry{Path: path, Change: diffArchives(old, arc), Old: old, New: arc})
+	}
+	for path, arc := range newer.Archives {
+		if _, ok := snapshot.Archives[path]; !ok {
+			diff = append(diff, DiffEntry{Path: path, Change: Added, New: arc})
+		}
+	}
+
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].Path < diff[j].Path
+	})
+	return diff
+}
+
+// diffArchives returns how an archive changed between two snapshots
+func diffArchives(old, arc *Archive) uint8 {
+	if old.Type != arc.Type {
+		return TypeChanged
+	}
+	if old.Mode != arc.Mode || old.UID != arc.UID || old.GID != arc.GID {
+		return Modified
+	}
+
+	switch arc.Type {
+	case File:
+		if old.Size != arc.Size || old.LinkTarget != arc.LinkTarget {
+			return Modified
+		}
+		if len(old.Chunks) == 0 && len(arc.Chunks) == 0 && old.ModTime != arc.ModTime {
+			// without any chunks, the modification time is all we can go by
+			return Modified
+		}
+		if !sameContent(old.Chunks, arc.Chunks) {
+			return Modified
+		}
+	case SymLink:
+		if old.PointsTo != arc.PointsTo {
+			return Modified
+		}
+	}
+
+	return Unchanged
+}
+
+// sameContent returns true if two lists of chunks contain the same data.
+// Chunks get compared by the checksums of their decrypted data, so archives
+// stored with different compression or encryption settings still match
+func sameContent(a, b []Chunk) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	hashes := make(map[uint]string, len(a))
+	for _, c := range a {
+		hashes[c.Num] = c.DecryptedHash
+	}
+	for _, c := range b {
+		if h, ok := hashes[c.Num]; !ok || h != c.DecryptedHash {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,66 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "testing"
+
+func TestSnapshotDiff(t *testing.T) {
+	chunks := func(hashes ...string) []Chunk {
+		var c []Chunk
+		for i, h := range hashes {
+			c = append(c, Chunk{Num: uint(i), DecryptedHash: h})
+		}
+		return c
+	}
+
+	old := &Snapshot{Archives: map[string]*Archive{
+		"dir":       {Path: "dir", Type: Directory, Mode: 0755},
+		"unchanged": {Path: "unchanged", Type: File, Size: 2, Chunks: chunks("a", "b")},
+		"modified":  {Path: "modified", Type: File, Size: 2, Chunks: chunks("a", "b")},
+		"empty":     {Path: "empty", Type: File, ModTime: 1},
+		"link":      {Path: "link", Type: SymLink, PointsTo: "unchanged"},
+		"removed":   {Path: "removed", Type: File, Size: 1, Chunks: chunks("a")},
+		"retyped":   {Path: "retyped", Type: File, Size: 1, Chunks: chunks("a")},
+	}}
+	newer := &Snapshot{Archives: map[string]*Archive{
+		"dir":       {Path: "dir", Type: Directory, Mode: 0755, ModTime: 2},
+		"unchanged": {Path: "unchanged", Type: File, Size: 2, ModTime: 2, Chunks: chunks("a", "b")},
+		"modified":  {Path: "modified", Type: File, Size: 2, Chunks: chunks("a", "c")},
+		"empty":     {Path: "empty", Type: File, ModTime: 2},
+		"link":      {Path: "link", Type: SymLink, PointsTo: "modified"},
+		"added":     {Path: "added", Type: File, Size: 1, Chunks: chunks("a")},
+		"retyped":   {Path: "retyped", Type: Directory},
+	}}
+
+	expected := []struct {
+		path   string
+		change uint8
+	}{
+		{"added", Added},
+		{"dir", Unchanged},
+		{"empty", Modified},
+		{"link", Modified},
+		{"modified", Modified},
+		{"removed", Removed},
+		{"retyped", TypeChanged},
+		{"unchanged", Unchanged},
+	}
+
+	diff := old.Diff(newer)
+	if len(diff) != len(expected) {
+		t.Fatalf("Expected %d diff entries, got %d", len(expected), len(diff))
+	}
+	for i, e := range expected {
+		if diff[i].Path != e.path || diff[i].Change != e.change {
+			t.Errorf("Expected change %d for %s, got %d for %s", e.change, e.path, diff[i].Change, diff[i].Path)
+		}
+		if (diff[i].Old == nil) != (e.change == Added) || (diff[i].New == nil) != (e.change == Removed) {
+			t.Errorf("Unexpected archives for %s: %v, %v", e.path, diff[i].Old, diff[i].New)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CachingBackend wraps a Backend and keeps a copy of loaded chunk parts on
+// local disk, so they don't have to be fetched again, even after a restart.
+// Once the cached data exceeds maxSize bytes, the least recently used parts
+// get evicted
+type CachingBackend struct {
+	Backend
+
+	mut     sync.Mutex
+	dir     string
+	maxSize uint64
+	size    uint64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type diskCacheEntry struct {
+	name string
+	size uint64
+}
+
+// NewCachingBackend returns a CachingBackend storing its cache in dir. Parts
+// cached by earlier runs are picked up again
+func NewCachingBackend(backend Backend, dir string, maxSize uint64) (*CachingBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// oldest files go to the back of the list
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+
+	cb := &CachingBackend{
+		Backend: backend,
+		dir:     dir,
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || filepath.Ext(fi.Name()) == ".tmp" {
+			continue
+		}
+
+		cb.entries[fi.Name()] = cb.lru.PushBack(&diskCacheEntry{fi.Name(), uint64(fi.Size())})
+		cb.size += uint64(fi.Size())
+	}
+	cb.mut.Lock()
+	cb.evict()
+	cb.mut.Unlock()
+
+	return cb, nil
+}
+
+// LoadChunk loads a single Chunk from the cache, or from the wrapped backend
+// when it's not cached yet
+func (backend *CachingBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	name := shasum + "." + strconv.FormatUint(uint64(part), 10) + "_" + strconv.FormatUint(uint64(totalParts), 10)
+
+	if b, ok := backend.get(name); ok {
+		return b, nil
+	}
+
+	b, err := backend.Backend.LoadChunk(shasum, part, totalParts)
+	if err != nil {
+		return b, err
+	}
+
+	// failing to cache a chunk must not fail loading it
+	_ = backend.add(name, b)
+	return b, nil
+}
+
+// DeleteChunk deletes a single Chunk from the wrapped backend and the cache
+func (backend *CachingBackend) DeleteChunk(shasum string, part, totalParts uint) error {
+	name := shasum + "." + strconv.FormatUint(uint64(part), 10) + "_" + strconv.FormatUint(uint64(totalParts), 10)
+
+	backend.mut.Lock()
+	if e, ok := backend.entries[name]; ok {
+		backend.remove(e)
+	}
+	backend.mut.Unlock()
+
+	return backend.Backend.DeleteChunk(shasum, part, totalParts)
+}
+
+// Size returns the amount of bytes currently cached
+func (backend *CachingBackend) Size() uint64 {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	return backend.size
+}
+
+// get returns the cached data for a chunk part and marks it as recently used
+func (backend *CachingBackend) get(name string) ([]byte, bool) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	e, ok := backend.entries[name]
+	if !ok {
+		return nil, false
+	}
+
+	path := filepath.Join(backend.dir, name)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		backend.remove(e)
+		return nil, false
+	}
+
+	// the modification time keeps track of usage across restarts
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	backend.lru.MoveToFront(e)
+	return b, true
+}
+
+// add caches the data for a chunk part, unless it exceeds the cache's entire
+// budget
+func (backend *CachingBackend) add(name string, data []byte) error {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	if _, ok := backend.entries[name]; ok || uint64(len(data)) > backend.maxSize {
+		return nil
+	}
+
+	// write to a temporary file first, so we never end up with partial parts
+	path := filepath.Join(backend.dir, name)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		_ = os.Remove(path + ".tmp")
+		return err
+	}
+
+	backend.entries[name] = backend.lru.PushFront(&diskCacheEntry{name, uint64(len(data))})
+	backend.size += uint64(len(data))
+	backend.evict()
+	return nil
+}
+
+// evict removes the least recently used parts until the cache fits into its
+// budget. Must be called with the mutex held
+func (backend *CachingBackend) evict() {
+	for backend.size > backend.maxSize {
+		e := backend.lru.Back()
+		if e == nil {
+			return
+		}
+
+		backend.remove(e)
+	}
+}
+
+// remove deletes a part from the cache. Must be called with the mutex held
+func (backend *CachingBackend) remove(e *list.Element) {
+	entry := backend.lru.Remove(e).(*diskCacheEntry)
+	delete(backend.entries, entry.name)
+	backend.size -= entry.size
+	_ = os.Remove(filepath.Join(backend.dir, entry.name))
+}
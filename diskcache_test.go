@@ -0,0 +1,92 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// countingBackend counts the calls to LoadChunk
+type countingBackend struct {
+	Backend
+
+	calls int
+}
+
+func (b *countingBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	b.calls++
+	return []byte(shasum), nil
+}
+
+func TestCachingBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite.diskcache")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cb := &countingBackend{}
+	backend, err := NewCachingBackend(cb, dir, 16)
+	if err != nil {
+		t.Fatalf("Failed creating caching backend: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		b, err := backend.LoadChunk("chunk1", 0, 1)
+		if err != nil {
+			t.Fatalf("Failed loading chunk: %s", err)
+		}
+		if string(b) != "chunk1" {
+			t.Errorf("Loaded chunk data mismatches: %s", b)
+		}
+	}
+	if cb.calls != 1 {
+		t.Errorf("Expected 1 call to the wrapped backend, got %d", cb.calls)
+	}
+
+	// the cache survives re-opening it
+	backend, err = NewCachingBackend(cb, dir, 16)
+	if err != nil {
+		t.Fatalf("Failed re-opening caching backend: %s", err)
+	}
+	if backend.Size() != 6 {
+		t.Errorf("Expected 6 cached bytes, got %d", backend.Size())
+	}
+	if _, err := backend.LoadChunk("chunk1", 0, 1); err != nil {
+		t.Fatalf("Failed loading chunk: %s", err)
+	}
+	if cb.calls != 1 {
+		t.Errorf("Expected 1 call to the wrapped backend, got %d", cb.calls)
+	}
+
+	// caching a third part exceeds the budget and evicts chunk2, which is
+	// the least recently used one
+	for _, hash := range []string{"chunk2", "chunk1", "chunk3"} {
+		if _, err := backend.LoadChunk(hash, 0, 1); err != nil {
+			t.Fatalf("Failed loading chunk: %s", err)
+		}
+	}
+	if backend.Size() != 12 {
+		t.Errorf("Expected 12 cached bytes, got %d", backend.Size())
+	}
+	calls := cb.calls
+	if _, err := backend.LoadChunk("chunk1", 0, 1); err != nil {
+		t.Fatalf("Failed loading chunk: %s", err)
+	}
+	if cb.calls != calls {
+		t.Errorf("Expected chunk1 to be served from the cache")
+	}
+	if _, err := backend.LoadChunk("chunk2", 0, 1); err != nil {
+		t.Fatalf("Failed loading chunk: %s", err)
+	}
+	if cb.calls != calls+1 {
+		t.Errorf("Expected chunk2 to be evicted from the cache")
+	}
+}
@@ -0,0 +1,26 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "syscall"
+
+// freeSpace returns the space available to unprivileged users on the
+// filesystem containing path
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	// Available blocks * size per block = available space in bytes
+	// we convert both types to a uint64 as their type varies on different OS
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,28 @@
+// +build windows
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the space available to the current user on the volume
+// containing path
+func freeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var available, total, free uint64
+	err = windows.GetDiskFreeSpaceEx(p, &available, &total, &free)
+	if err != nil {
+		return 0, err
+	}
+	return available, nil
+}
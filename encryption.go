@@ -8,29 +8,48 @@
 package knoxite
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/sha256"
 	"errors"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
 )
 
 // Available encryption algos
 const (
 	EncryptionNone = iota
 	EncryptionAES
+	EncryptionChaCha20
+	EncryptionAESGCM
+)
+
+// HKDF labels of the subkeys authenticated encryption methods derive from the
+// password, so nonces never get derived with the cipher's key
+const (
+	aeadKeyLabel  = "knoxite aead key"
+	nonceKeyLabel = "knoxite nonce key"
 )
 
 // Error declarations
 var (
-	ErrInvalidPassword = errors.New("Empty password not permitted")
+	ErrInvalidPassword      = errors.New("Empty password not permitted")
+	ErrAuthenticationFailed = errors.New("Data could not be authenticated, it is either corrupted or the key is wrong")
 )
 
 // Encryptor is a pipeline processor that encrypts data
 type Encryptor struct {
 	Method uint16
 
-	iv    []byte
-	block cipher.Block
+	nonceKey []byte
+	iv       []byte
+	block    cipher.Block
+	aead     cipher.AEAD
 }
 
 // NewEncryptor returns a newly configured Encryptor
@@ -38,28 +57,36 @@ func NewEncryptor(method uint16, password string) (Encryptor, error) {
 	e := Encryptor{
 		Method: method,
 	}
-	if method == EncryptionAES {
-		if len(password) == 0 {
-			return e, ErrInvalidPassword
-		}
+	if method == EncryptionNone {
+		return e, nil
+	}
+	if len(password) == 0 {
+		return e, ErrInvalidPassword
+	}
 
+	var err error
+	switch method {
+	case EncryptionAES:
 		key := sha256.Sum256([]byte(password))
 		e.iv = key[:aes.BlockSize]
-
-		var err error
 		e.block, err = aes.NewCipher(key[:])
-		if err != nil {
-			return e, err
-		}
+	case EncryptionChaCha20, EncryptionAESGCM:
+		e.aead, e.nonceKey, err = newAEAD(method, password)
 	}
 
-	return e, nil
+	return e, err
 }
 
 // Process encrypts the data
 func (e Encryptor) Process(data []byte) ([]byte, error) {
-	if e.Method == EncryptionNone {
+	switch e.Method {
+	case EncryptionNone:
 		return data, nil
+	case EncryptionChaCha20, EncryptionAESGCM:
+		// the nonce gets derived from the plaintext, so identical data
+		// results in identical ciphertexts and can still be deduplicated
+		nonce := deriveNonce(e.nonceKey, data, e.aead.NonceSize())
+		return e.aead.Seal(nonce, nonce, data, nil), nil
 	}
 
 	b := make([]byte, len(data))
@@ -75,6 +102,7 @@ type Decryptor struct {
 
 	iv    []byte
 	block cipher.Block
+	aead  cipher.AEAD
 }
 
 // NewDecryptor returns a newly configured Decryptor
@@ -82,28 +110,33 @@ func NewDecryptor(method uint16, password string) (Decryptor, error) {
 	e := Decryptor{
 		Method: method,
 	}
-	if method == EncryptionAES {
-		if len(password) == 0 {
-			return e, ErrInvalidPassword
-		}
+	if method == EncryptionNone {
+		return e, nil
+	}
+	if len(password) == 0 {
+		return e, ErrInvalidPassword
+	}
 
+	var err error
+	switch method {
+	case EncryptionAES:
 		key := sha256.Sum256([]byte(password))
 		e.iv = key[:aes.BlockSize]
-
-		var err error
 		e.block, err = aes.NewCipher(key[:])
-		if err != nil {
-			return e, err
-		}
+	case EncryptionChaCha20, EncryptionAESGCM:
+		e.aead, _, err = newAEAD(method, password)
 	}
 
-	return e, nil
+	return e, err
 }
 
 // Process decrypts the data
 func (e Decryptor) Process(data []byte) ([]byte, error) {
-	if e.Method == EncryptionNone {
+	switch e.Method {
+	case EncryptionNone:
 		return data, nil
+	case EncryptionChaCha20, EncryptionAESGCM:
+		return openAEAD(e.aead, data)
 	}
 
 	b := make([]byte, len(data))
@@ -112,3 +145,89 @@ func (e Decryptor) Process(data []byte) ([]byte, error) {
 
 	return b, nil
 }
+
+// Reader returns a reader decrypting the data read from r. Data encrypted
+// with an authenticated method can only be decrypted once it has been read
+// entirely, all other methods decrypt the data as it streams through
+func (e Decryptor) Reader(r io.Reader) (io.Reader, error) {
+	switch e.Method {
+	case EncryptionNone:
+		return r, nil
+	case EncryptionChaCha20, EncryptionAESGCM:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		b, err := openAEAD(e.aead, data)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+	}
+
+	return cipher.StreamReader{
+		S: cipher.NewCFBDecrypter(e.block, e.iv),
+		R: r,
+	}, nil
+}
+
+// newAEAD returns the AEAD of an authenticated encryption method and the
+// separate key its nonces get derived with, both derived from password
+func newAEAD(method uint16, password string) (cipher.AEAD, []byte, error) {
+	key, err := deriveSubkey(password, aeadKeyLabel)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonceKey, err := deriveSubkey(password, nonceKeyLabel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var aead cipher.AEAD
+	if method == EncryptionChaCha20 {
+		aead, err = chacha20poly1305.New(key)
+	} else {
+		aead, err = newGCM(key)
+	}
+	return aead, nonceKey, err
+}
+
+// deriveSubkey derives a 256-bit key for the purpose named by label from
+// password
+func deriveSubkey(password, label string) ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, []byte(password), nil, []byte(label)), key)
+	return key, err
+}
+
+// newGCM returns an AES-256-GCM AEAD for the given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// deriveNonce returns a nonce of the given size, derived from a keyed hash of data
+func deriveNonce(key, data []byte, size int) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(data)
+	return mac.Sum(nil)[:size]
+}
+
+// openAEAD authenticates and decrypts data, which is prefixed with its nonce
+func openAEAD(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return []byte{}, ErrAuthenticationFailed
+	}
+
+	nonce := data[:aead.NonceSize()]
+	b, err := aead.Open(nil, nonce, data[aead.NonceSize():], nil)
+	if err != nil {
+		return []byte{}, ErrAuthenticationFailed
+	}
+
+	return b, nil
+}
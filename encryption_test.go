@@ -8,6 +8,7 @@
 package knoxite
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -15,26 +16,87 @@ func TestEncryption(t *testing.T) {
 	testPassword := "this_is_a_password"
 	b := []byte("1234567890")
 
-	epipe, err := NewEncodingPipeline(CompressionNone, EncryptionAES, testPassword)
-	if err != nil {
-		t.Error(err)
+	for _, method := range []uint16{EncryptionAES, EncryptionChaCha20, EncryptionAESGCM} {
+		epipe, err := NewEncodingPipeline(CompressionNone, method, testPassword)
+		if err != nil {
+			t.Error(err)
+		}
+		be, err := epipe.Process(b)
+		if err != nil {
+			t.Error(err)
+		}
+
+		dpipe, err := NewDecodingPipeline(CompressionNone, method, testPassword)
+		if err != nil {
+			t.Error(err)
+		}
+		bd, err := dpipe.Process(be)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if string(b) != string(bd) {
+			t.Error("Data mismatch after encryption & decryption cycle.")
+		}
 	}
-	be, err := epipe.Process(b)
-	if err != nil {
-		t.Error(err)
+}
+
+func TestEncryptionAuthentication(t *testing.T) {
+	testPassword := "this_is_a_password"
+	b := []byte("1234567890")
+
+	for _, method := range []uint16{EncryptionChaCha20, EncryptionAESGCM} {
+		epipe, _ := NewEncodingPipeline(CompressionNone, method, testPassword)
+		be, err := epipe.Process(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// identical data must result in identical ciphertexts to allow deduplication
+		be2, _ := epipe.Process(b)
+		if string(be) != string(be2) {
+			t.Error("Expected identical ciphertexts for identical data")
+		}
+
+		be[len(be)-1] ^= 0xff
+		dpipe, _ := NewDecodingPipeline(CompressionNone, method, testPassword)
+		_, err = dpipe.Process(be)
+		if err != ErrAuthenticationFailed {
+			t.Errorf("Expected %v, got %v", ErrAuthenticationFailed, err)
+		}
 	}
+}
+
+func TestEncryptionSubkeys(t *testing.T) {
+	testPassword := "this_is_a_password"
+	b := []byte("1234567890")
 
-	dpipe, err := NewDecodingPipeline(CompressionNone, EncryptionAES, testPassword)
+	key, err := deriveSubkey(testPassword, aeadKeyLabel)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
-	bd, err := dpipe.Process(be)
+	nonceKey, err := deriveSubkey(testPassword, nonceKeyLabel)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
+	if bytes.Equal(key, nonceKey) {
+		t.Fatal("Expected distinct keys for encryption and nonces")
+	}
+
+	for _, method := range []uint16{EncryptionChaCha20, EncryptionAESGCM} {
+		e, err := NewEncryptor(method, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		be, err := e.Process(b)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	if string(b) != string(bd) {
-		t.Error("Data mismatch after encryption & decryption cycle.")
+		size := e.aead.NonceSize()
+		if !bytes.Equal(be[:size], deriveNonce(nonceKey, b, size)) {
+			t.Error("Expected the nonce to be derived with the nonce key")
+		}
 	}
 }
 
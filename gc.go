@@ -0,0 +1,101 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "time"
+
+// DefaultGCGracePeriod is the minimum age of chunks deleted by GarbageCollect
+const DefaultGCGracePeriod = 24 * time.Hour
+
+// GCStats reports what garbage collection removed from a repository
+type GCStats struct {
+	Chunks    int    // amount of deleted chunks
+	Parts     int    // amount of deleted chunk parts, including parity parts
+	Skipped   int    // amount of unreferenced chunk parts within the grace period
+	FreedSize uint64 // storage space freed by deleting the chunk parts
+}
+
+// GarbageCollect deletes all chunks from the repository's backends which
+// aren't referenced by any snapshot, e.g. leftovers of aborted backups. Unlike
+// ChunkIndex.Pack it doesn't rely on the chunk-index, but requires backends
+// implementing ChunkLister.
+//
+// A backup running concurrently stores its chunks before the snapshot
+// referencing them, so chunks modified less than grace before the collection
+// started are left alone. The grace period must exceed the duration of the
+// longest running backup
+func GarbageCollect(repository *Repository, grace time.Duration) (GCStats, error) {
+	var stats GCStats
+	cutoff := time.Now().Add(-grace)
+
+	var listers []ChunkLister
+	for _, be := range repository.backend.Backends {
+		lister, ok := (*be).(ChunkLister)
+		if !ok {
+			return stats, ErrListChunksUnsupported
+		}
+		listers = append(listers, lister)
+	}
+
+	referenced := make(map[string]bool)
+	for _, vol := range repository.Volumes {
+		for _, id := range vol.Snapshots {
+			snapshot, err := vol.LoadSnapshot(id, repository)
+			if err != nil {
+				return stats, err
+			}
+
+			for hash := range snapshot.ChunkRefs() {
+				referenced[hash] = true
+			}
+		}
+	}
+
+	deleted := make(map[string]bool)
+	for i, lister := range listers {
+		chunks, err := lister.ListChunks()
+		if err != nil {
+			return stats, err
+		}
+
+		for _, chunk := range chunks {
+			if referenced[chunk.Hash] {
+				continue
+			}
+			if chunk.ModTime.After(cutoff) {
+				logger.Debugf("Skipping recent chunk %s (part %d)", chunk.Hash, chunk.Part)
+				stats.Skipped++
+				continue
+			}
+
+			logger.Infof("Chunk %s (part %d) isn't referenced by any snapshot. Deleting!", chunk.Hash, chunk.Part)
+			err = (*repository.backend.Backends[i]).DeleteChunk(chunk.Hash, chunk.Part, chunk.TotalParts)
+			if err != nil {
+				return stats, err
+			}
+			deleted[chunk.Hash] = true
+			stats.Parts++
+			stats.FreedSize += chunk.Size
+		}
+	}
+	stats.Chunks = len(deleted)
+	if len(deleted) == 0 {
+		return stats, nil
+	}
+
+	// make sure future backups don't deduplicate against deleted chunks
+	index, err := OpenChunkIndex(repository)
+	if err != nil {
+		return stats, err
+	}
+	for hash := range deleted {
+		delete(index.Chunks, hash)
+	}
+
+	return stats, index.Save(repository)
+}
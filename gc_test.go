@@ -0,0 +1,87 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseChunkFilename(t *testing.T) {
+	tests := []struct {
+		name       string
+		shasum     string
+		part       uint
+		totalParts uint
+		ok         bool
+	}{
+		{"abcdef.0_1", "abcdef", 0, 1, true},
+		{"abcdef.12_10", "abcdef", 12, 10, true},
+		{"index", "", 0, 0, false},
+		{"abcdef.x_1", "", 0, 0, false},
+		{".0_1", "", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		shasum, part, totalParts, ok := ParseChunkFilename(tt.name)
+		if shasum != tt.shasum || part != tt.part || totalParts != tt.totalParts || ok != tt.ok {
+			t.Errorf("Unexpected result parsing %s: %s %d %d %v", tt.name, shasum, part, totalParts, ok)
+		}
+	}
+}
+
+func TestGarbageCollect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	data := writeRandomFile(t, file, 1024)
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{file}, CompressionNone, 1)
+
+	// simulate the leftovers of an aborted backup, including a parity part
+	orphan := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	for part := uint(0); part < 2; part++ {
+		if _, err = r.backend.StoreChunkPart(Chunk{Hash: orphan, DataParts: 1}, part, []byte("orphaned")); err != nil {
+			t.Fatalf("Failed storing chunk: %s", err)
+		}
+	}
+
+	stats, err := GarbageCollect(&r, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed collecting garbage: %s", err)
+	}
+	if stats.Chunks != 0 || stats.Skipped != 2 {
+		t.Errorf("Expected recent chunks to be skipped, got %+v", stats)
+	}
+
+	stats, err = GarbageCollect(&r, 0)
+	if err != nil {
+		t.Fatalf("Failed collecting garbage: %s", err)
+	}
+	if stats.Chunks != 1 || stats.Parts != 2 || stats.FreedSize != 16 {
+		t.Errorf("Expected 1 chunk with 2 parts and 16 bytes to be deleted, got %+v", stats)
+	}
+	if _, err = r.backend.LoadChunk(Chunk{Hash: orphan, DataParts: 1}, 0); err == nil {
+		t.Error("Expected orphaned chunk to be deleted")
+	}
+
+	b, _, err := DecodeArchiveData(r, *snapshot.Archives[file])
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after collecting garbage")
+	}
+}
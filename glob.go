@@ -0,0 +1,66 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"path"
+	"strings"
+)
+
+// matchGlob reports whether an archive path matches a glob pattern. Besides
+// the syntax of path.Match, "**" matches any number of path elements.
+// Patterns without a slash match at any depth, patterns matching a directory
+// also match everything below it, and a trailing slash is ignored, so
+// "node_modules/" matches every node_modules directory and its content
+func matchGlob(pattern, name string) (bool, error) {
+	pattern = strings.Trim(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	return matchElements(strings.Split(pattern, "/"),
+		strings.Split(strings.TrimPrefix(cleanArchivePath(name), "/"), "/"))
+}
+
+// matchElements matches path elements against pattern elements. Remaining
+// path elements are allowed once the whole pattern matched
+func matchElements(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				match, err := matchElements(pattern[1:], name[i:])
+				if err != nil || match {
+					return match, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+
+		match, err := path.Match(pattern[0], name[0])
+		if err != nil || !match {
+			return false, err
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return true, nil
+}
+
+// validGlob returns false if pattern is malformed
+func validGlob(pattern string) bool {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
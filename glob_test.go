@@ -0,0 +1,45 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"**/*.pdf", "/home/user/docs/a.pdf", true},
+		{"**/*.pdf", "a.pdf", true},
+		{"**/*.pdf", "/home/user/docs/a.txt", false},
+		{"*.pdf", "/home/user/docs/a.pdf", true},
+		{"node_modules/", "/src/app/node_modules", true},
+		{"node_modules/", "/src/app/node_modules/pkg/index.js", true},
+		{"node_modules/", "/src/app/node_modules_old/index.js", false},
+		{"/src/app", "/src/app/main.go", true},
+		{"/src/app", "/other/src/app/main.go", false},
+		{"src/**/test", "/src/a/b/test/x", true},
+		{"src/**/test", "/src/test", true},
+		{"src/*/test", "/src/a/b/test", false},
+	}
+
+	for _, tt := range tests {
+		match, err := matchGlob(tt.pattern, tt.path)
+		if err != nil {
+			t.Fatalf("Failed matching %s: %s", tt.pattern, err)
+		}
+		if match != tt.match {
+			t.Errorf("Expected match of %s against %s to be %t, got %t", tt.pattern, tt.path, tt.match, match)
+		}
+	}
+
+	if validGlob("docs/[a-") {
+		t.Error("Expected malformed pattern to be invalid")
+	}
+}
@@ -10,6 +10,7 @@ package knoxite
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"hash"
 
 	"github.com/minio/highwayhash"
 )
@@ -35,3 +36,15 @@ func Hash(b []byte, hashtype uint8) string {
 
 	return hex.EncodeToString(data[:])
 }
+
+// NewHasher returns a hash.Hash computing the same checksums as Hash, for data
+// which isn't available all at once
+func NewHasher(hashtype uint8) hash.Hash {
+	if hashtype == HashHighway256 {
+		// only fails for keys of the wrong size
+		h, _ := highwayhash.New(hashkey[:])
+		return h
+	}
+
+	return sha256.New()
+}
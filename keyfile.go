@@ -0,0 +1,90 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// KeyFileSize is the amount of random bytes in generated key files
+	KeyFileSize = 64
+	// minKeyFileSize is the minimum amount of bytes a key file must contain
+	minKeyFileSize = 32
+)
+
+// Error declarations
+var (
+	ErrKeyFileTooShort = errors.New("Key file is too short, it must contain at least 32 bytes")
+)
+
+// GenerateKeyFile writes a new key file with random content to path. An
+// existing file never gets overwritten
+func GenerateKeyFile(path string) error {
+	b := make([]byte, KeyFileSize)
+	if _, err := rand.Read(b); err != nil {
+		return ErrGenerateRandomKeyFailed
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// PasswordFromKeyFile derives a repository password from the content of a
+// key file, which can be used instead of a passphrase with NewRepository and
+// OpenRepository
+func PasswordFromKeyFile(path string) (string, error) {
+	b, err := readKeyFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	key := sha256.Sum256(b)
+	return base64.URLEncoding.EncodeToString(key[:]), nil
+}
+
+// PasswordFromKeyFileAndPassword derives a repository password from both the
+// content of a key file and a passphrase, so unlocking a repository requires
+// knowing the passphrase as well as possessing the key file
+func PasswordFromKeyFileAndPassword(path, password string) (string, error) {
+	b, err := readKeyFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, b)
+	_, _ = mac.Write([]byte(password))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// readKeyFile returns the content of a key file
+func readKeyFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < minKeyFileSize {
+		return nil, ErrKeyFileTooShort
+	}
+
+	return b, nil
+}
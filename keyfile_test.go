@@ -0,0 +1,110 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyfile := filepath.Join(dir, "keyfile")
+	if err = GenerateKeyFile(keyfile); err != nil {
+		t.Fatalf("Failed generating key file: %s", err)
+	}
+	if err = GenerateKeyFile(keyfile); !os.IsExist(err) {
+		t.Errorf("Expected existing key file not to be overwritten, got %v", err)
+	}
+
+	password, err := PasswordFromKeyFile(keyfile)
+	if err != nil {
+		t.Fatalf("Failed reading key file: %s", err)
+	}
+
+	repodir := filepath.Join(dir, "repo")
+	r, err := NewRepository(repodir, password)
+	if err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+	r2, err := OpenRepository(repodir, password)
+	if err != nil {
+		t.Fatalf("Failed opening repository with key file: %s", err)
+	}
+	if r2.Key != r.Key {
+		t.Error("Repository key mismatch after opening it with a key file")
+	}
+
+	// a different key file must not open the repository
+	other := filepath.Join(dir, "other")
+	if err = GenerateKeyFile(other); err != nil {
+		t.Fatalf("Failed generating key file: %s", err)
+	}
+	password, err = PasswordFromKeyFile(other)
+	if err != nil {
+		t.Fatalf("Failed reading key file: %s", err)
+	}
+	if _, err = OpenRepository(repodir, password); err != ErrOpenRepositoryFailed {
+		t.Errorf("Expected %v, got %v", ErrOpenRepositoryFailed, err)
+	}
+
+	short := filepath.Join(dir, "short")
+	if err = ioutil.WriteFile(short, []byte("too short"), 0600); err != nil {
+		t.Fatalf("Failed writing key file: %s", err)
+	}
+	if _, err = PasswordFromKeyFile(short); err != ErrKeyFileTooShort {
+		t.Errorf("Expected %v, got %v", ErrKeyFileTooShort, err)
+	}
+}
+
+func TestKeyFileAndPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyfile := filepath.Join(dir, "keyfile")
+	if err = GenerateKeyFile(keyfile); err != nil {
+		t.Fatalf("Failed generating key file: %s", err)
+	}
+	password, err := PasswordFromKeyFileAndPassword(keyfile, "this_is_a_password")
+	if err != nil {
+		t.Fatalf("Failed reading key file: %s", err)
+	}
+
+	repodir := filepath.Join(dir, "repo")
+	if _, err = NewRepository(repodir, password); err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+	if _, err = OpenRepository(repodir, password); err != nil {
+		t.Fatalf("Failed opening repository with key file and password: %s", err)
+	}
+
+	// neither the key file nor the password alone open the repository
+	keyOnly, err := PasswordFromKeyFile(keyfile)
+	if err != nil {
+		t.Fatalf("Failed reading key file: %s", err)
+	}
+	wrong, err := PasswordFromKeyFileAndPassword(keyfile, "wrong_password")
+	if err != nil {
+		t.Fatalf("Failed reading key file: %s", err)
+	}
+	for _, pw := range []string{keyOnly, "this_is_a_password", wrong} {
+		if _, err = OpenRepository(repodir, pw); err != ErrOpenRepositoryFailed {
+			t.Errorf("Expected %v, got %v", ErrOpenRepositoryFailed, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// repositoryMagic prefixes repository files which store their key in keyslots
+var repositoryMagic = []byte("knoxite:keyslots\n")
+
+// repositoryFile is the stored format of a repository's metadata. The data is
+// encrypted with the repository's Key, which in turn is stored once per
+// password in the keyslots
+type repositoryFile struct {
+	Slots []keySlot
+	Data  []byte
+}
+
+// KDFParams configures the Argon2id key derivation, which turns passwords
+// into the keys protecting the keyslots
+type KDFParams struct {
+	Time    uint32 // amount of passes over the memory
+	Memory  uint32 // memory usage in KiB
+	Threads uint8  // degree of parallelism
+}
+
+// DefaultKDFParams are used for new keyslots. Keyslots protected with weaker
+// parameters get upgraded when the repository gets opened with them
+var DefaultKDFParams = KDFParams{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 4,
+}
+
+// weakerThan returns true if deriving a key with p is cheaper than with o
+func (p KDFParams) weakerThan(o KDFParams) bool {
+	return p.Time < o.Time || p.Memory < o.Memory
+}
+
+// keySlot stores the repository key, encrypted with a key derived from a
+// password
+type keySlot struct {
+	KDF  KDFParams
+	Salt []byte
+	Key  []byte
+}
+
+// slotKey derives the key protecting a keyslot from password
+func (s keySlot) slotKey(password string) string {
+	k := argon2.IDKey([]byte(password), s.Salt, s.KDF.Time, s.KDF.Memory, s.KDF.Threads, 32)
+	return base64.URLEncoding.EncodeToString(k)
+}
+
+// Error declarations
+var (
+	ErrPasswordExists   = errors.New("Password already unlocks this repository")
+	ErrPasswordNotFound = errors.New("Password does not unlock this repository")
+	ErrLastPassword     = errors.New("Can't remove the last password of a repository")
+)
+
+// wrapKey encrypts the repository key with a key derived from password,
+// using a fresh salt and DefaultKDFParams
+func wrapKey(password, key string) (keySlot, error) {
+	if len(password) == 0 {
+		return keySlot{}, ErrInvalidPassword
+	}
+
+	slot := keySlot{
+		KDF:  DefaultKDFParams,
+		Salt: make([]byte, 16),
+	}
+	if _, err := rand.Read(slot.Salt); err != nil {
+		return slot, err
+	}
+
+	e, err := NewEncryptor(EncryptionAESGCM, slot.slotKey(password))
+	if err != nil {
+		return slot, err
+	}
+	slot.Key, err = e.Process([]byte(key))
+	return slot, err
+}
+
+// unwrapKey decrypts the repository key stored in a keyslot with the key
+// slotKey derived from the password
+func unwrapKey(slotKey string, slot keySlot) (string, error) {
+	d, err := NewDecryptor(EncryptionAESGCM, slotKey)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := d.Process(slot.Key)
+	return string(b), err
+}
+
+// findKeySlot returns the index of the keyslot unlocked by password and the
+// repository key stored in it, or -1. The key of every keyslot only gets
+// derived once
+func (r *Repository) findKeySlot(password string) (int, string) {
+	for i, slot := range r.keySlots {
+		if key, err := unwrapKey(slot.slotKey(password), slot); err == nil {
+			return i, key
+		}
+	}
+
+	return -1, ""
+}
+
+// upgradeKeySlot rewraps keyslot i with password, if it's protected with
+// weaker than the default KDF parameters. Returns true if the keyslot has
+// been upgraded
+func (r *Repository) upgradeKeySlot(i int, password string) (bool, error) {
+	if !r.keySlots[i].KDF.weakerThan(DefaultKDFParams) {
+		return false, nil
+	}
+
+	slot, err := wrapKey(password, r.Key)
+	if err != nil {
+		return false, err
+	}
+	r.keySlots[i] = slot
+	return true, nil
+}
+
+// encodeRepositoryFile encrypts the repository's metadata with its Key
+func (r *Repository) encodeRepositoryFile() ([]byte, error) {
+	pipe, err := NewEncodingPipeline(CompressionNone, EncryptionAESGCM, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := pipe.Encode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(append([]byte{}, repositoryMagic...))
+	err = gob.NewEncoder(buf).Encode(repositoryFile{
+		Slots: r.keySlots,
+		Data:  data,
+	})
+	return buf.Bytes(), err
+}
+
+// decodeRepositoryFile unlocks the repository's Key with password and
+// decrypts its metadata. The keyslot of password gets upgraded if it's
+// protected with weaker than the default KDF parameters, in which case true
+// gets returned
+func (r *Repository) decodeRepositoryFile(b []byte, password string) (bool, error) {
+	var file repositoryFile
+	err := gob.NewDecoder(bytes.NewReader(b[len(repositoryMagic):])).Decode(&file)
+	if err != nil {
+		return false, err
+	}
+	r.keySlots = file.Slots
+
+	i, key := r.findKeySlot(password)
+	if i < 0 {
+		return false, ErrPasswordNotFound
+	}
+
+	pipe, err := NewDecodingPipeline(CompressionNone, EncryptionAESGCM, key)
+	if err != nil {
+		return false, err
+	}
+	err = pipe.Decode(file.Data, r)
+	if err != nil {
+		return false, err
+	}
+
+	return r.upgradeKeySlot(i, password)
+}
+
+// AddPassword adds another password which unlocks the repository
+func (r *Repository) AddPassword(password string) error {
+	if i, _ := r.findKeySlot(password); i >= 0 {
+		return ErrPasswordExists
+	}
+
+	slot, err := wrapKey(password, r.Key)
+	if err != nil {
+		return err
+	}
+	r.keySlots = append(r.keySlots, slot)
+
+	return r.Save()
+}
+
+// RemovePassword removes a password, so it no longer unlocks the repository.
+// The last remaining password can't be removed
+func (r *Repository) RemovePassword(password string) error {
+	i, _ := r.findKeySlot(password)
+	if i < 0 {
+		return ErrPasswordNotFound
+	}
+	if len(r.keySlots) == 1 {
+		return ErrLastPassword
+	}
+
+	r.keySlots = append(r.keySlots[:i:i], r.keySlots[i+1:]...)
+	if password == r.password {
+		r.password = ""
+	}
+
+	return r.Save()
+}
@@ -0,0 +1,164 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// deriving keys with the default parameters is deliberately slow, which
+	// would slow down every test creating or opening a repository
+	DefaultKDFParams = KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+
+	os.Exit(m.Run())
+}
+
+func TestRepositoryKeySlots(t *testing.T) {
+	testPassword := "this_is_a_password"
+	otherPassword := "this_is_another_password"
+	newPassword := "this_is_a_new_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"repository.go"}, CompressionNone, 0)
+	data, err := ioutil.ReadFile("repository.go")
+	if err != nil {
+		t.Fatalf("Failed reading file: %s", err)
+	}
+
+	if err = r.AddPassword(otherPassword); err != nil {
+		t.Fatalf("Failed adding password: %s", err)
+	}
+	if err = r.AddPassword(otherPassword); err != ErrPasswordExists {
+		t.Errorf("Expected %v, got %v", ErrPasswordExists, err)
+	}
+	if err = r.ChangePassword(newPassword); err != nil {
+		t.Fatalf("Failed changing password: %s", err)
+	}
+
+	if _, err = OpenRepository(dir, testPassword); err != ErrOpenRepositoryFailed {
+		t.Errorf("Expected %v for the replaced password, got %v", ErrOpenRepositoryFailed, err)
+	}
+	for _, password := range []string{otherPassword, newPassword} {
+		r, err = OpenRepository(dir, password)
+		if err != nil {
+			t.Fatalf("Failed opening repository: %s", err)
+		}
+
+		// chunks stay decodable without having been rewritten
+		b, _, err := DecodeArchiveData(r, *snapshot.Archives["repository.go"])
+		if err != nil {
+			t.Fatalf("Failed decoding archive: %s", err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Error("Data mismatch after changing the password")
+		}
+	}
+
+	if err = r.RemovePassword(otherPassword); err != nil {
+		t.Fatalf("Failed removing password: %s", err)
+	}
+	if _, err = OpenRepository(dir, otherPassword); err != ErrOpenRepositoryFailed {
+		t.Errorf("Expected %v for the removed password, got %v", ErrOpenRepositoryFailed, err)
+	}
+	if err = r.RemovePassword(newPassword); err != ErrLastPassword {
+		t.Errorf("Expected %v, got %v", ErrLastPassword, err)
+	}
+}
+
+func TestRepositoryMigrateKeySlots(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+
+	// store the repository the way version 4 did, encrypted with the password
+	r.Version = 4
+	pipe, err := NewEncodingPipeline(CompressionNone, EncryptionAES, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pipe.Encode(r)
+	if err != nil {
+		t.Fatalf("Failed encoding repository: %s", err)
+	}
+	if err = r.backend.SaveRepository(b); err != nil {
+		t.Fatalf("Failed saving repository: %s", err)
+	}
+
+	r2, err := OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed opening version 4 repository: %s", err)
+	}
+	if r2.Version != RepositoryVersion || r2.Key != r.Key {
+		t.Errorf("Repository wasn't migrated correctly, version %d", r2.Version)
+	}
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, RepoFilename))
+	if err != nil {
+		t.Fatalf("Failed reading repository file: %s", err)
+	}
+	if !bytes.HasPrefix(b, repositoryMagic) {
+		t.Error("Expected migrated repository to be stored with keyslots")
+	}
+	if _, err = OpenRepository(dir, testPassword); err != nil {
+		t.Errorf("Failed opening migrated repository: %s", err)
+	}
+}
+
+func TestRepositoryUpgradeKeySlots(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// keyslots created with weaker parameters get upgraded once they unlock
+	// the repository
+	defaults := DefaultKDFParams
+	DefaultKDFParams = KDFParams{Time: 1, Memory: 1024, Threads: 1}
+	_, err = NewRepository(dir, testPassword)
+	DefaultKDFParams = defaults
+	if err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+
+	r, err := OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed opening repository: %s", err)
+	}
+	if r.keySlots[0].KDF != DefaultKDFParams {
+		t.Errorf("Expected keyslot to be upgraded to %v, got %v", DefaultKDFParams, r.keySlots[0].KDF)
+	}
+	r2, err := OpenRepository(dir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed opening upgraded repository: %s", err)
+	}
+	if r2.keySlots[0].KDF != DefaultKDFParams {
+		t.Error("Upgraded keyslot wasn't saved")
+	}
+}
@@ -0,0 +1,258 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+var (
+	// StaleLockAge is the age after which a lock which hasn't been refreshed
+	// is considered stale, e.g. because its owner crashed
+	StaleLockAge = 30 * time.Minute
+	// LockRefreshInterval is how often held locks get refreshed
+	LockRefreshInterval = 5 * time.Minute
+)
+
+// Error declarations
+var (
+	ErrLockingUnsupported = errors.New("Backend doesn't support locking")
+	ErrLockLost           = errors.New("Lock got removed by another process")
+)
+
+// Lock describes a lock held on a repository
+type Lock struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Exclusive bool      `json:"exclusive"`
+	Time      time.Time `json:"time"`
+}
+
+// RepositoryLock is a lock acquired by this process. It gets refreshed
+// periodically until it's released
+type RepositoryLock struct {
+	Lock
+
+	locker    Locker
+	refreshed time.Time
+	done      chan struct{}
+	lost      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// LockError records the lock preventing another lock from being acquired
+type LockError struct {
+	Lock Lock
+}
+
+func (e *LockError) Error() string {
+	kind := "shared"
+	if e.Lock.Exclusive {
+		kind = "exclusive"
+	}
+	return fmt.Sprintf("Repository is locked (%s) by %s since %s", kind, e.Lock.Owner, e.Lock.Time.Format(time.RFC3339))
+}
+
+// conflicts returns true if lock prevents acquiring another lock
+func (lock Lock) conflicts(exclusive bool) bool {
+	return exclusive || lock.Exclusive
+}
+
+// isStale returns true if lock hasn't been refreshed for StaleLockAge
+func (lock Lock) isStale() bool {
+	return time.Since(lock.Time) > StaleLockAge
+}
+
+// LockRepository acquires a lock on the repository. Operations modifying or
+// deleting existing data, like pruning, need an exclusive lock. All others
+// take a shared lock, which can be held by several processes at once.
+// Stale locks get removed
+func LockRepository(repository *Repository, exclusive bool) (*RepositoryLock, error) {
+	if len(repository.backend.Backends) == 0 {
+		return nil, ErrLockingUnsupported
+	}
+	locker, ok := (*repository.backend.Backends[0]).(Locker)
+	if !ok {
+		return nil, ErrLockingUnsupported
+	}
+
+	u, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	lock := &RepositoryLock{
+		Lock: Lock{
+			ID:        u.String()[:8],
+			Owner:     fmt.Sprintf("%s (pid %d)", host, os.Getpid()),
+			Exclusive: exclusive,
+			Time:      time.Now(),
+		},
+		locker: locker,
+		done:   make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+	lock.refreshed = lock.Time
+
+	if err = lock.acquire(); err != nil {
+		return nil, err
+	}
+
+	lock.wg.Add(1)
+	go lock.refresh()
+	return lock, nil
+}
+
+// acquire stores the lock, unless it conflicts with another live lock
+func (lock *RepositoryLock) acquire() error {
+	locks, err := listLocks(lock.locker)
+	if err != nil {
+		return err
+	}
+	for _, l := range locks {
+		if l.isStale() {
+			logger.Warnf("Removing stale lock of %s from %s", l.Owner, l.Time.Format(time.RFC3339))
+			if err = lock.locker.DeleteLock(l.ID); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if l.conflicts(lock.Exclusive) {
+			return &LockError{l}
+		}
+	}
+	if err = lock.store(); err != nil {
+		return err
+	}
+
+	// another process may have acquired a lock at the same time
+	locks, err = listLocks(lock.locker)
+	if err != nil {
+		_ = lock.locker.DeleteLock(lock.ID)
+		return err
+	}
+	for _, l := range locks {
+		if l.ID != lock.ID && !l.isStale() && l.conflicts(lock.Exclusive) {
+			_ = lock.locker.DeleteLock(lock.ID)
+			return &LockError{l}
+		}
+	}
+
+	return nil
+}
+
+// refresh periodically updates the lock's time, so it doesn't become stale.
+// Lost gets closed when the lock got removed in the meantime
+func (lock *RepositoryLock) refresh() {
+	defer lock.wg.Done()
+
+	ticker := time.NewTicker(LockRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.done:
+			return
+		case <-ticker.C:
+		}
+
+		err := lock.update()
+		if err == ErrLockLost {
+			logger.Warnf("Repository lock of %s got removed", lock.Owner)
+			close(lock.lost)
+			return
+		}
+		if err != nil {
+			logger.Warnf("Refreshing repository lock failed: %s", err)
+		}
+	}
+}
+
+// update stores the lock with the current time
+func (lock *RepositoryLock) update() error {
+	if time.Since(lock.refreshed) > StaleLockAge {
+		// others may have removed the lock as stale already
+		return ErrLockLost
+	}
+
+	locks, err := listLocks(lock.locker)
+	if err != nil {
+		return err
+	}
+	var found bool
+	for _, l := range locks {
+		if l.ID == lock.ID {
+			found = true
+		}
+	}
+	if !found {
+		return ErrLockLost
+	}
+
+	lock.Time = time.Now()
+	if err = lock.store(); err != nil {
+		return err
+	}
+	lock.refreshed = lock.Time
+	return nil
+}
+
+// Lost returns a channel which gets closed when the lock got removed by
+// another process. The operation holding the lock must be aborted then
+func (lock *RepositoryLock) Lost() <-chan struct{} {
+	return lock.lost
+}
+
+// Release stops refreshing the lock and removes it from the repository
+func (lock *RepositoryLock) Release() error {
+	close(lock.done)
+	lock.wg.Wait()
+
+	select {
+	case <-lock.lost:
+		return ErrLockLost
+	default:
+	}
+	return lock.locker.DeleteLock(lock.ID)
+}
+
+// store writes the lock to the repository
+func (lock *RepositoryLock) store() error {
+	b, err := json.Marshal(lock.Lock)
+	if err != nil {
+		return err
+	}
+
+	return lock.locker.StoreLock(lock.ID, b)
+}
+
+func listLocks(locker Locker) ([]Lock, error) {
+	data, err := locker.ListLocks()
+	if err != nil {
+		return nil, err
+	}
+
+	var locks []Lock
+	for _, b := range data {
+		var l Lock
+		if err = json.Unmarshal(b, &l); err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, nil
+}
@@ -0,0 +1,174 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLockRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, "this_is_a_password")
+	if err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+
+	// shared locks can be held by several processes
+	shared1, err := LockRepository(&r, false)
+	if err != nil {
+		t.Fatalf("Failed acquiring shared lock: %s", err)
+	}
+	shared2, err := LockRepository(&r, false)
+	if err != nil {
+		t.Fatalf("Failed acquiring second shared lock: %s", err)
+	}
+
+	if _, err = LockRepository(&r, true); err == nil {
+		t.Fatal("Expected exclusive lock to fail while shared locks are held")
+	} else if _, ok := err.(*LockError); !ok {
+		t.Errorf("Expected LockError, got %v", err)
+	}
+
+	for _, l := range []*RepositoryLock{shared1, shared2} {
+		if err = l.Release(); err != nil {
+			t.Fatalf("Failed releasing lock: %s", err)
+		}
+	}
+
+	exclusive, err := LockRepository(&r, true)
+	if err != nil {
+		t.Fatalf("Failed acquiring exclusive lock: %s", err)
+	}
+	if _, err = LockRepository(&r, false); err == nil {
+		t.Error("Expected shared lock to fail while an exclusive lock is held")
+	}
+	if err = exclusive.Release(); err != nil {
+		t.Fatalf("Failed releasing lock: %s", err)
+	}
+
+	locker := (*r.backend.Backends[0]).(Locker)
+	locks, err := listLocks(locker)
+	if err != nil {
+		t.Fatalf("Failed listing locks: %s", err)
+	}
+	if len(locks) != 0 {
+		t.Errorf("Expected all locks to be released, got %v", locks)
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewRepository(dir, "this_is_a_password")
+	if err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+
+	// a crashed process left an exclusive lock behind
+	locker := (*r.backend.Backends[0]).(Locker)
+	stale := Lock{ID: "crashed", Owner: "test", Exclusive: true, Time: time.Now().Add(-2 * StaleLockAge)}
+	b, _ := json.Marshal(stale)
+	if err = locker.StoreLock(stale.ID, b); err != nil {
+		t.Fatalf("Failed storing lock: %s", err)
+	}
+
+	lock, err := LockRepository(&r, true)
+	if err != nil {
+		t.Fatalf("Expected stale lock to be removed, got %v", err)
+	}
+	locks, err := listLocks(locker)
+	if err != nil {
+		t.Fatalf("Failed listing locks: %s", err)
+	}
+	if len(locks) != 1 || locks[0].ID != lock.ID {
+		t.Errorf("Expected only the new lock to be held, got %v", locks)
+	}
+	if err = lock.Release(); err != nil {
+		t.Fatalf("Failed releasing lock: %s", err)
+	}
+}
+
+func TestLostLock(t *testing.T) {
+	interval := LockRefreshInterval
+	LockRefreshInterval = 10 * time.Millisecond
+	defer func() {
+		LockRefreshInterval = interval
+	}()
+
+	r, err := NewRepository("memory://TestLostLock", "this_is_a_password")
+	if err != nil {
+		t.Fatalf("Failed creating repository: %s", err)
+	}
+
+	lock, err := LockRepository(&r, false)
+	if err != nil {
+		t.Fatalf("Failed acquiring lock: %s", err)
+	}
+
+	// another process removes the lock, e.g. because it considered it stale
+	locker := (*r.backend.Backends[0]).(Locker)
+	if err = locker.DeleteLock(lock.ID); err != nil {
+		t.Fatalf("Failed deleting lock: %s", err)
+	}
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the lost lock to be noticed")
+	}
+	if err = lock.Release(); err != ErrLockLost {
+		t.Errorf("Expected ErrLockLost releasing a lost lock, got %v", err)
+	}
+}
+
+// listErrorFilesystem fails to list any directory
+type listErrorFilesystem struct {
+	*StorageLocal
+}
+
+func (fs listErrorFilesystem) ListFiles(path string) ([]string, error) {
+	return nil, &os.PathError{Op: "readdirent", Path: path, Err: os.ErrPermission}
+}
+
+func TestListLocksError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// only missing locks may be treated as no locks being held
+	backend, _ := NewStorageFilesystem(dir, listErrorFilesystem{&StorageLocal{}})
+	if _, err = backend.ListLocks(); !os.IsPermission(err) {
+		t.Errorf("Expected a permission error, got %v", err)
+	}
+
+	backend, _ = NewStorageFilesystem(dir, &StorageLocal{})
+	if locks, err := backend.ListLocks(); err != nil || len(locks) != 0 {
+		t.Errorf("Expected no locks, got %q: %v", locks, err)
+	}
+
+	// locking requires listing the stored locks
+	backend, _ = NewStorageFilesystem(dir, struct{ BackendFilesystem }{&StorageLocal{}})
+	if _, err = backend.ListLocks(); err != ErrLockingUnsupported {
+		t.Errorf("Expected ErrLockingUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "time"
+
+// lutimes is a no-op on platforms which can't change the modification time
+// of symlinks
+func lutimes(path string, mtime time.Time) error {
+	return nil
+}
@@ -0,0 +1,28 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// lutimes sets the modification time of a symlink itself, without following
+// it
+func lutimes(path string, mtime time.Time) error {
+	tv := unix.NsecToTimeval(mtime.UnixNano())
+	err := unix.Lutimes(path, []unix.Timeval{tv, tv})
+	if err != nil {
+		return &os.PathError{Op: "lutimes", Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// +build !openbsd
+// +build !windows
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// Mount serves a snapshot as a read-only filesystem at mountpoint. Files get
+// read on demand with ReadArchive. Mount blocks until the filesystem gets
+// unmounted, e.g. by calling Unmount
+func Mount(repository Repository, snapshot *Snapshot, mountpoint string) error {
+	c, err := fuse.Mount(
+		mountpoint,
+		fuse.ReadOnly(),
+		fuse.FSName("knoxite"),
+	)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = fs.Serve(c, mountFS{newMountTree(&repository, snapshot)})
+	if err != nil {
+		return err
+	}
+
+	// check if the mount process has an error to report
+	<-c.Ready
+	return c.MountError
+}
+
+// Unmount unmounts the snapshot mounted at mountpoint
+func Unmount(mountpoint string) error {
+	return fuse.Unmount(mountpoint)
+}
+
+// mountFS is the filesystem a snapshot gets mounted as
+type mountFS struct {
+	root *mountNode
+}
+
+// Root returns the top-level directory of the filesystem
+func (m mountFS) Root() (fs.Node, error) {
+	return m.root, nil
+}
+
+// mountNode is a file, directory or symlink of a mounted snapshot
+type mountNode struct {
+	items      map[string]*mountNode
+	archive    Archive
+	repository *Repository
+	snapshot   *Snapshot
+}
+
+// newMountTree returns the root directory of a mounted snapshot. Archives
+// stored with absolute paths get mounted relative to the mountpoint, parent
+// directories missing in the snapshot get faked
+func newMountTree(repository *Repository, snapshot *Snapshot) *mountNode {
+	newNode := func(arc Archive) *mountNode {
+		return &mountNode{
+			items:      make(map[string]*mountNode),
+			archive:    arc,
+			repository: repository,
+			snapshot:   snapshot,
+		}
+	}
+
+	root := newNode(Archive{Type: Directory, Mode: os.ModeDir | 0555})
+	for _, arc := range snapshot.Archives {
+		name := exportName(arc.Path)
+		if name == "" {
+			continue
+		}
+
+		item := root
+		elems := strings.Split(name, "/")
+		for i, elem := range elems {
+			child, ok := item.items[elem]
+			if !ok {
+				child = newNode(Archive{
+					Path:    path.Join(elems[:i+1]...),
+					Type:    Directory,
+					Mode:    os.ModeDir | 0755,
+					ModTime: arc.ModTime,
+					UID:     arc.UID,
+					GID:     arc.GID,
+				})
+				item.items[elem] = child
+			}
+			item = child
+		}
+		item.archive = *arc
+	}
+
+	return root
+}
+
+// Attr returns this node's filesystem attributes
+func (node *mountNode) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = node.archive.Mode
+	a.Size = node.archive.Size
+	a.Mtime = time.Unix(node.archive.ModTime, 0)
+	a.Uid = node.archive.UID
+	a.Gid = node.archive.GID
+
+	switch node.archive.Type {
+	case SymLink:
+		a.Mode |= os.ModeSymlink
+	case Directory:
+		a.Mode |= os.ModeDir
+	}
+
+	return nil
+}
+
+// Lookup is used to stat items
+func (node *mountNode) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	item, ok := node.items[name]
+	if ok {
+		return item, nil
+	}
+
+	return nil, fuse.ENOENT
+}
+
+// ReadDirAll returns all items directly below this node
+func (node *mountNode) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	entries := []fuse.Dirent{}
+
+	for k, v := range node.items {
+		ent := fuse.Dirent{Name: k}
+		switch v.archive.Type {
+		case File:
+			ent.Type = fuse.DT_File
+		case Directory:
+			ent.Type = fuse.DT_Dir
+		case SymLink:
+			ent.Type = fuse.DT_Link
+		}
+
+		entries = append(entries, ent)
+	}
+
+	return entries, nil
+}
+
+// Open opens a file
+func (node *mountNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, fuse.Errno(syscall.EACCES)
+	}
+	resp.Flags |= fuse.OpenKeepCache
+	return node, nil
+}
+
+// Read reads from a file
+func (node *mountNode) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	arc := node.archive
+	if arc.LinkTarget != "" {
+		// hardlinks share the data of the archive they're pointing to
+		target, ok := node.snapshot.Archives[arc.LinkTarget]
+		if !ok {
+			return fuse.ENOENT
+		}
+		arc = *target
+	}
+
+	d, err := ReadArchive(*node.repository, arc, int(req.Offset), req.Size)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	// a short read signals the end of the file
+	resp.Data = *d
+	return nil
+}
+
+// Readlink returns the target a symlink is pointing to
+func (node *mountNode) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	return node.archive.PointsTo, nil
+}
@@ -0,0 +1,26 @@
+// +build openbsd windows
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "errors"
+
+// ErrMountUnsupported is returned when mounting snapshots on platforms
+// without FUSE support
+var ErrMountUnsupported = errors.New("Mounting snapshots is not supported on this platform")
+
+// Mount is not supported on this platform
+func Mount(repository Repository, snapshot *Snapshot, mountpoint string) error {
+	return ErrMountUnsupported
+}
+
+// Unmount is not supported on this platform
+func Unmount(mountpoint string) error {
+	return ErrMountUnsupported
+}
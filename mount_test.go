@@ -0,0 +1,113 @@
+// +build !openbsd
+// +build !windows
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+// lookupMountNode walks a mounted snapshot's tree down to a slash-separated
+// path
+func lookupMountNode(t *testing.T, root *mountNode, p string) *mountNode {
+	node := root
+	for _, elem := range strings.Split(strings.TrimPrefix(p, "/"), "/") {
+		n, err := node.Lookup(context.Background(), elem)
+		if err != nil {
+			t.Fatalf("Failed looking up %s: %s", p, err)
+		}
+		node = n.(*mountNode)
+	}
+	return node
+}
+
+// readMountNode reads the entire content of a file of a mounted snapshot
+func readMountNode(t *testing.T, node *mountNode, blockSize int) []byte {
+	var b []byte
+	for {
+		req := &fuse.ReadRequest{Offset: int64(len(b)), Size: blockSize}
+		resp := &fuse.ReadResponse{}
+		if err := node.Read(context.Background(), req, resp); err != nil {
+			t.Fatalf("Failed reading %s: %s", node.archive.Path, err)
+		}
+		b = append(b, resp.Data...)
+		if len(resp.Data) < blockSize {
+			return b
+		}
+	}
+}
+
+func TestMountTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	data := writeRandomFile(t, filepath.Join(src, "sub", "file"), 300000)
+	err = os.Link(filepath.Join(src, "sub", "file"), filepath.Join(src, "hardlink"))
+	if err != nil {
+		t.Fatalf("Failed creating hardlink: %s", err)
+	}
+	err = os.Symlink("sub/file", filepath.Join(src, "link"))
+	if err != nil {
+		t.Fatalf("Failed creating symlink: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	root := newMountTree(&r, snapshot)
+
+	var a fuse.Attr
+	sub := lookupMountNode(t, root, filepath.ToSlash(filepath.Join(src, "sub")))
+	if err := sub.Attr(context.Background(), &a); err != nil || !a.Mode.IsDir() {
+		t.Errorf("Expected a directory, got mode %s: %v", a.Mode, err)
+	}
+	entries, err := sub.ReadDirAll(context.Background())
+	if err != nil || len(entries) != 1 || entries[0].Name != "file" || entries[0].Type != fuse.DT_File {
+		t.Errorf("Unexpected directory entries %v: %v", entries, err)
+	}
+
+	file := lookupMountNode(t, root, filepath.ToSlash(filepath.Join(src, "sub", "file")))
+	// only one of the hardlinked archives holds the data
+	hardlink := lookupMountNode(t, root, filepath.ToSlash(filepath.Join(src, "hardlink")))
+	if hardlink.archive.LinkTarget == "" && file.archive.LinkTarget == "" {
+		t.Fatalf("Expected one of the hardlinked files to be stored as a link")
+	}
+	for _, node := range []*mountNode{file, hardlink} {
+		if err := node.Attr(context.Background(), &a); err != nil || a.Size != uint64(len(data)) {
+			t.Errorf("Expected size %d for %s, got %d: %v", len(data), node.archive.Path, a.Size, err)
+		}
+		if b := readMountNode(t, node, 4096); !bytes.Equal(b, data) {
+			t.Errorf("Data mismatch reading %s, got %d of %d bytes", node.archive.Path, len(b), len(data))
+		}
+	}
+
+	link := lookupMountNode(t, root, filepath.ToSlash(filepath.Join(src, "link")))
+	if target, err := link.Readlink(context.Background(), &fuse.ReadlinkRequest{}); err != nil || target != "sub/file" {
+		t.Errorf("Expected symlink to sub/file, got %s: %v", target, err)
+	}
+
+	if _, err := root.Lookup(context.Background(), "missing"); err != fuse.ENOENT {
+		t.Errorf("Expected ENOENT looking up a missing item, got %v", err)
+	}
+}
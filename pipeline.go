@@ -10,6 +10,7 @@ package knoxite
 import (
 	"bytes"
 	"encoding/gob"
+	"io"
 )
 
 // PipelineProcessor is a simple interface to process data
@@ -56,6 +57,22 @@ func NewDecodingPipeline(compression, encryption uint16, password string) (Pipel
 	}, nil
 }
 
+// NewDecodingReader returns a reader decrypting and decompressing the data
+// read from r. Unlike a decoding Pipeline it works on blocks of data, so the
+// decoded data never has to be held in memory entirely
+func NewDecodingReader(r io.Reader, compression, encryption uint16, password string) (io.ReadCloser, error) {
+	decryptor, err := NewDecryptor(encryption, password)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := decryptor.Reader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decompressor{Method: compression}.Reader(dr)
+}
+
 // Process sends the data through all configured processors and returns the result
 func (p *Pipeline) Process(data []byte) ([]byte, error) {
 	var err error
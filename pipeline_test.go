@@ -0,0 +1,77 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodingReader(t *testing.T) {
+	testPassword := "this_is_a_password"
+	b := bytes.Repeat([]byte("1234567890"), 10000)
+
+	for _, compression := range []uint16{CompressionNone, CompressionGZip, CompressionLZMA, CompressionFlate, CompressionZlib, CompressionZstd, CompressionBrotli} {
+		for _, encryption := range []uint16{EncryptionNone, EncryptionAES, EncryptionChaCha20, EncryptionAESGCM} {
+			pipe, err := NewEncodingPipeline(compression, encryption, testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+			be, err := pipe.Process(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewDecodingReader(iotest.HalfReader(bytes.NewReader(be)), compression, encryption, testPassword)
+			if err != nil {
+				t.Fatalf("Failed creating decoding reader (compression %d, encryption %d): %s", compression, encryption, err)
+			}
+			bd, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Errorf("Failed decoding (compression %d, encryption %d): %s", compression, encryption, err)
+			}
+			_ = r.Close()
+
+			if !bytes.Equal(b, bd) {
+				t.Errorf("Data mismatch after decoding (compression %d, encryption %d)", compression, encryption)
+			}
+		}
+	}
+}
+
+func TestDecodeChunkTo(t *testing.T) {
+	r := Repository{Key: "this_is_a_key"}
+	b := bytes.Repeat([]byte("1234567890"), 10000)
+
+	pipe, err := NewEncodingPipeline(CompressionZstd, EncryptionAES, r.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	be, err := pipe.Process(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arc := Archive{Compressed: CompressionZstd, Encrypted: EncryptionAES}
+	chunk := Chunk{DecryptedHash: Hash(b, HashHighway256)}
+	var buf bytes.Buffer
+	if err = decodeChunkTo(&buf, r, arc, chunk, be); err != nil {
+		t.Fatalf("Failed decoding chunk: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), b) {
+		t.Error("Data mismatch after decoding chunk")
+	}
+
+	chunk.DecryptedHash = Hash([]byte("invalid"), HashHighway256)
+	err = decodeChunkTo(ioutil.Discard, r, arc, chunk, be)
+	if _, ok := err.(*CheckSumError); !ok {
+		t.Errorf("Expected CheckSumError, got %v", err)
+	}
+}
@@ -7,15 +7,40 @@
 
 package knoxite
 
-import "time"
+import (
+	"math"
+	"time"
+)
+
+// speedWindow is the time span the transfer speed of a Progress gets
+// smoothed over
+const speedWindow = 5 * time.Second
+
+// ProgressPhase tells which stage of handling an item an update belongs to
+type ProgressPhase int
+
+// Phases of an item's progress
+const (
+	PhaseTransferring ProgressPhase = iota // Intermediate update while transferring data
+	PhaseStarted                           // First update for an item
+	PhaseCompleted                         // Item has been handled completely, sent once per item
+	PhaseSkipped                           // Item got left out, sent instead of any other phase
+)
 
 // Progress contains stats and current path
 type Progress struct {
 	Path             string
+	Phase            ProgressPhase
 	Timer            time.Time
 	CurrentItemStats Stats
 	TotalStatistics  Stats
 	Error            error
+	Warning          error
+
+	// Speed is the current transfer speed in bytes per second
+	Speed uint64
+	// ETA estimates the time left until TotalStatistics.Size got transferred
+	ETA time.Duration
 }
 
 func newProgress(archive *Archive) Progress {
@@ -39,7 +64,147 @@ func newProgressError(err error) Progress {
 	}
 }
 
+func newProgressWarning(archive *Archive, warning error) Progress {
+	return Progress{
+		Path:    archive.Path,
+		Timer:   time.Now(),
+		Warning: warning,
+	}
+}
+
+// CoalesceProgress forwards the updates from in to the returned channel,
+// which gets closed after in. Updates the consumer hasn't received yet get
+// replaced by newer ones for the same item, so sending to in never waits for
+// a slow consumer and at most one pending update per item gets queued.
+// Errors, warnings and the latest update of every item are always delivered
+func CoalesceProgress(in <-chan Progress) chan Progress {
+	out := make(chan Progress)
+	go func() {
+		defer close(out)
+
+		var queue []Progress
+		// the queue positions of the replaceable updates by path, counted
+		// from the first update ever queued
+		pending := make(map[string]int)
+		sent := 0
+		for in != nil || len(queue) > 0 {
+			var send chan Progress
+			var next Progress
+			if len(queue) > 0 {
+				send = out
+				next = queue[0]
+			}
+
+			select {
+			case p, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				i, ok := pending[p.Path]
+				if ok && p.Error == nil && p.Warning == nil {
+					queue[i-sent] = p
+				} else {
+					i = sent + len(queue)
+					queue = append(queue, p)
+				}
+				if coalescable(p) {
+					pending[p.Path] = i
+				} else {
+					// later updates must not overtake this one
+					delete(pending, p.Path)
+				}
+			case send <- next:
+				if i, ok := pending[next.Path]; ok && i == sent {
+					delete(pending, next.Path)
+				}
+				queue = queue[1:]
+				sent++
+			}
+		}
+	}()
+
+	return out
+}
+
+// coalescable returns true if newer updates of the same item may replace p.
+// Only intermediate updates get replaced
+func coalescable(p Progress) bool {
+	return p.Phase == PhaseTransferring && p.Error == nil && p.Warning == nil
+}
+
+func newProgressSkipped(archive *Archive) Progress {
+	return Progress{
+		Path:            archive.Path,
+		Phase:           PhaseSkipped,
+		Timer:           time.Now(),
+		TotalStatistics: Stats{Skipped: 1},
+	}
+}
+
 // TransferSpeed returns the average transfer speed in bytes per second
 func (p Progress) TransferSpeed() uint64 {
 	return uint64(float64(p.CurrentItemStats.Transferred) / time.Since(p.Timer).Seconds())
 }
+
+// Remaining returns the amount of bytes left to transfer for the current item
+func (p Progress) Remaining() uint64 {
+	if p.CurrentItemStats.Transferred >= p.CurrentItemStats.Size {
+		return 0
+	}
+	return p.CurrentItemStats.Size - p.CurrentItemStats.Transferred
+}
+
+// Percentage returns how much of the current item has been transferred,
+// ranging from 0 to 100
+func (p Progress) Percentage() float64 {
+	if p.CurrentItemStats.Size == 0 || p.Remaining() == 0 {
+		return 100
+	}
+	return float64(p.CurrentItemStats.Transferred) / float64(p.CurrentItemStats.Size) * 100
+}
+
+// rateMeter calculates the current transfer speed of a stream of Progress
+// updates as an exponentially weighted moving average
+type rateMeter struct {
+	last        time.Time
+	transferred uint64
+	speed       float64
+	measured    bool
+}
+
+// newRateMeter returns a rateMeter starting at the given amount of already
+// transferred bytes
+func newRateMeter(transferred uint64) *rateMeter {
+	return &rateMeter{
+		last:        time.Now(),
+		transferred: transferred,
+	}
+}
+
+// update measures the bytes transferred since the previous update and sets
+// the Speed and ETA of p accordingly
+func (m *rateMeter) update(p *Progress) {
+	now := time.Now()
+	dt := now.Sub(m.last).Seconds()
+	if dt > 0 && p.TotalStatistics.Transferred >= m.transferred {
+		rate := float64(p.TotalStatistics.Transferred-m.transferred) / dt
+		if m.measured {
+			// older samples fade out over the course of speedWindow
+			alpha := 1 - math.Exp(-dt/speedWindow.Seconds())
+			m.speed += alpha * (rate - m.speed)
+		} else {
+			m.speed = rate
+			m.measured = true
+		}
+	}
+	m.last = now
+	m.transferred = p.TotalStatistics.Transferred
+
+	p.Speed = uint64(m.speed)
+	p.ETA = 0
+	if m.speed > 0 && p.TotalStatistics.Size > p.TotalStatistics.Transferred {
+		remaining := float64(p.TotalStatistics.Size - p.TotalStatistics.Transferred)
+		p.ETA = time.Duration(remaining / m.speed * float64(time.Second))
+	}
+}
@@ -36,3 +36,136 @@ func TestProgressError(t *testing.T) {
 		t.Errorf("Expected error, got %s", p.Error)
 	}
 }
+
+func TestProgressRemaining(t *testing.T) {
+	tests := []struct {
+		size        uint64
+		transferred uint64
+		remaining   uint64
+		percentage  float64
+	}{
+		{0, 0, 0, 100},
+		{1000, 0, 1000, 0},
+		{1000, 250, 750, 25},
+		{1000, 1000, 0, 100},
+		{1000, 1500, 0, 100},
+	}
+
+	for _, tt := range tests {
+		p := Progress{
+			CurrentItemStats: Stats{
+				Size:        tt.size,
+				Transferred: tt.transferred,
+			},
+		}
+
+		if r := p.Remaining(); r != tt.remaining {
+			t.Errorf("Expected %d remaining bytes, got %d", tt.remaining, r)
+		}
+		if pc := p.Percentage(); pc != tt.percentage {
+			t.Errorf("Expected %.2f%%, got %.2f%%", tt.percentage, pc)
+		}
+	}
+}
+
+func TestProgressSpeedAndETA(t *testing.T) {
+	p := Progress{
+		TotalStatistics: Stats{
+			Size: 4096,
+		},
+	}
+	m := newRateMeter(0)
+
+	time.Sleep(500 * time.Millisecond)
+	p.TotalStatistics.Transferred = 1024
+	m.update(&p)
+
+	// time.Sleep only approximates the duration, apply some threshold
+	if p.Speed < 1600 || p.Speed > 2048 {
+		t.Errorf("Expected a speed of %d, got %d", 2048, p.Speed)
+	}
+	if p.ETA < 1400*time.Millisecond || p.ETA > 2*time.Second {
+		t.Errorf("Expected an ETA of %s, got %s", 1500*time.Millisecond, p.ETA)
+	}
+
+	// a stalled transfer slows the smoothed speed down, but doesn't stop it
+	time.Sleep(500 * time.Millisecond)
+	speed := p.Speed
+	m.update(&p)
+	if p.Speed >= speed || p.Speed == 0 {
+		t.Errorf("Expected speed to drop below %d, got %d", speed, p.Speed)
+	}
+
+	p.TotalStatistics.Transferred = 4096
+	m.update(&p)
+	if p.ETA != 0 {
+		t.Errorf("Expected no ETA for a finished transfer, got %s", p.ETA)
+	}
+}
+
+func TestCoalesceProgress(t *testing.T) {
+	in := make(chan Progress)
+	out := CoalesceProgress(in)
+
+	// nobody reads from out yet, so sending must never block
+	for i := 0; i < 1000; i++ {
+		in <- Progress{Path: "a", TotalStatistics: Stats{Transferred: uint64(i)}}
+	}
+	in <- Progress{Path: "a", Warning: errors.New("warning")}
+	in <- Progress{Path: "b", TotalStatistics: Stats{Transferred: 1}}
+	in <- Progress{Path: "b", TotalStatistics: Stats{Transferred: 2}}
+	close(in)
+
+	var updates []Progress
+	for p := range out {
+		updates = append(updates, p)
+	}
+	if len(updates) != 3 {
+		t.Fatalf("Expected 3 updates, got %d", len(updates))
+	}
+	if updates[0].Path != "a" || updates[0].TotalStatistics.Transferred != 999 {
+		t.Errorf("Expected latest update of a, got %+v", updates[0])
+	}
+	if updates[1].Warning == nil {
+		t.Errorf("Expected warning, got %+v", updates[1])
+	}
+	if updates[2].Path != "b" || updates[2].TotalStatistics.Transferred != 2 {
+		t.Errorf("Expected latest update of b, got %+v", updates[2])
+	}
+}
+
+func TestCoalesceProgressInterleaved(t *testing.T) {
+	in := make(chan Progress)
+	out := CoalesceProgress(in)
+
+	// concurrently restored items send their updates interleaved
+	for i := 1; i <= 1000; i++ {
+		in <- Progress{Path: "a", TotalStatistics: Stats{Transferred: uint64(i)}}
+		in <- Progress{Path: "b", TotalStatistics: Stats{Transferred: uint64(i)}}
+	}
+	in <- Progress{Path: "a", Phase: PhaseCompleted}
+	in <- Progress{Path: "b", TotalStatistics: Stats{Transferred: 1001}}
+	in <- Progress{Path: "b", Warning: errors.New("warning")}
+	in <- Progress{Path: "b", TotalStatistics: Stats{Transferred: 1002}}
+	close(in)
+
+	var updates []Progress
+	for p := range out {
+		updates = append(updates, p)
+	}
+	if len(updates) != 4 {
+		t.Fatalf("Expected 4 updates, got %d: %+v", len(updates), updates)
+	}
+	if updates[0].Path != "a" || updates[0].Phase != PhaseCompleted {
+		t.Errorf("Expected completion of a, got %+v", updates[0])
+	}
+	if updates[1].Path != "b" || updates[1].TotalStatistics.Transferred != 1001 {
+		t.Errorf("Expected latest update of b before its warning, got %+v", updates[1])
+	}
+	if updates[2].Warning == nil {
+		t.Errorf("Expected warning, got %+v", updates[2])
+	}
+	if updates[3].Path != "b" || updates[3].TotalStatistics.Transferred != 1002 {
+		t.Errorf("Expected latest update of b, got %+v", updates[3])
+	}
+}
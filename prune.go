@@ -0,0 +1,158 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Error declarations
+var (
+	ErrRetentionPolicyEmpty = errors.New("Retention policy doesn't keep any snapshots")
+)
+
+// RetentionPolicy decides which snapshots of a volume to keep. A snapshot is
+// kept as soon as any of the rules selects it
+type RetentionPolicy struct {
+	KeepLast    int           // keep the n most recent snapshots
+	KeepDaily   int           // keep the most recent snapshot of the last n days with snapshots
+	KeepWeekly  int           // keep the most recent snapshot of the last n weeks with snapshots
+	KeepMonthly int           // keep the most recent snapshot of the last n months with snapshots
+	KeepYearly  int           // keep the most recent snapshot of the last n years with snapshots
+	KeepWithin  time.Duration // keep all snapshots taken within this duration before the most recent one
+	KeepTags    []string      // keep all snapshots carrying any of these tags
+}
+
+// PruneStats reports what pruning removed from a repository
+type PruneStats struct {
+	Snapshots int    // amount of removed snapshots
+	Chunks    int    // amount of deleted chunks
+	FreedSize uint64 // storage space freed by deleting the chunks
+}
+
+// IsEmpty returns true if the policy doesn't select any snapshots
+func (p RetentionPolicy) IsEmpty() bool {
+	return p.KeepLast == 0 && p.KeepDaily == 0 && p.KeepWeekly == 0 &&
+		p.KeepMonthly == 0 && p.KeepYearly == 0 && p.KeepWithin == 0 &&
+		len(p.KeepTags) == 0
+}
+
+// Apply splits snapshots into those to keep and those to remove. Both lists
+// are sorted by date, most recent first
+func (p RetentionPolicy) Apply(snapshots []*Snapshot) (keep, remove []*Snapshot) {
+	sorted := append([]*Snapshot{}, snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.After(sorted[j].Date)
+	})
+
+	buckets := []struct {
+		count int
+		key   func(t time.Time) string
+		last  string
+	}{
+		{p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }, ""},
+		{p.KeepWeekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", y, w)
+		}, ""},
+		{p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }, ""},
+		{p.KeepYearly, func(t time.Time) string { return t.Format("2006") }, ""},
+	}
+
+	for i, s := range sorted {
+		keepIt := i < p.KeepLast
+		if p.KeepWithin > 0 && sorted[0].Date.Sub(s.Date) <= p.KeepWithin {
+			keepIt = true
+		}
+		for _, tag := range p.KeepTags {
+			if s.HasTag(tag) {
+				keepIt = true
+			}
+		}
+
+		// the first snapshot of every bucket is the most recent one in it
+		for b := range buckets {
+			if buckets[b].count == 0 {
+				continue
+			}
+			key := buckets[b].key(s.Date)
+			if key != buckets[b].last {
+				buckets[b].last = key
+				buckets[b].count--
+				keepIt = true
+			}
+		}
+
+		if keepIt {
+			keep = append(keep, s)
+		} else {
+			remove = append(remove, s)
+		}
+	}
+
+	return keep, remove
+}
+
+// PruneSnapshots applies policy to the snapshots of every volume, removes the
+// snapshots it doesn't keep and deletes all chunks no longer referenced by
+// any remaining snapshot
+func PruneSnapshots(repository *Repository, policy RetentionPolicy) (PruneStats, error) {
+	var stats PruneStats
+	if policy.IsEmpty() {
+		return stats, ErrRetentionPolicyEmpty
+	}
+
+	index, err := OpenChunkIndex(repository)
+	if err != nil {
+		return stats, err
+	}
+
+	var removed []string
+	for _, vol := range repository.Volumes {
+		var snapshots []*Snapshot
+		for _, id := range vol.Snapshots {
+			snapshot, err := vol.LoadSnapshot(id, repository)
+			if err != nil {
+				return stats, err
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+
+		_, remove := policy.Apply(snapshots)
+		for _, snapshot := range remove {
+			logger.Infof("Removing snapshot %s from %s", snapshot.ID, snapshot.Date.Format(time.RFC3339))
+			if err := vol.RemoveSnapshot(snapshot.ID); err != nil {
+				return stats, err
+			}
+			removed = append(removed, snapshot.ID)
+		}
+	}
+	if len(removed) == 0 {
+		return stats, nil
+	}
+
+	// the snapshots must be gone before deleting their chunks
+	err = repository.Save()
+	if err != nil {
+		return stats, err
+	}
+	stats.Snapshots = len(removed)
+
+	for _, id := range removed {
+		index.RemoveSnapshot(id)
+	}
+	stats.Chunks, stats.FreedSize, err = index.pack(repository)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, index.Save(repository)
+}
@@ -0,0 +1,140 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+	var snapshots []*Snapshot
+	for _, d := range []time.Duration{
+		0, time.Hour, 24 * time.Hour, 25 * time.Hour, 8 * 24 * time.Hour,
+		40 * 24 * time.Hour, 400 * 24 * time.Hour,
+	} {
+		snapshots = append(snapshots, &Snapshot{ID: now.Add(-d).Format(time.RFC3339), Date: now.Add(-d)})
+	}
+	snapshots[len(snapshots)-1].Tags = []string{"pre-upgrade"}
+
+	tests := []struct {
+		policy RetentionPolicy
+		keep   int
+	}{
+		{RetentionPolicy{KeepLast: 3}, 3},
+		{RetentionPolicy{KeepLast: 100}, 7},
+		{RetentionPolicy{KeepDaily: 2}, 2},
+		{RetentionPolicy{KeepDaily: 100}, 5},
+		{RetentionPolicy{KeepWeekly: 100}, 5},
+		{RetentionPolicy{KeepMonthly: 100}, 3},
+		{RetentionPolicy{KeepYearly: 100}, 2},
+		{RetentionPolicy{KeepWithin: 24 * time.Hour}, 3},
+		{RetentionPolicy{KeepLast: 1, KeepYearly: 2}, 2},
+		{RetentionPolicy{KeepLast: 1, KeepTags: []string{"pre-upgrade"}}, 2},
+	}
+
+	for _, tt := range tests {
+		keep, remove := tt.policy.Apply(snapshots)
+		if len(keep) != tt.keep || len(keep)+len(remove) != len(snapshots) {
+			t.Errorf("Expected policy %+v to keep %d snapshots, got %d and %d removed", tt.policy, tt.keep, len(keep), len(remove))
+		}
+		if len(keep) > 0 && keep[0] != snapshots[0] {
+			t.Errorf("Expected policy %+v to keep the most recent snapshot", tt.policy)
+		}
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	testPassword := "this_is_a_password"
+
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	shared := filepath.Join(dir, "shared")
+	data := writeRandomFile(t, shared, 1024)
+	old := filepath.Join(dir, "old")
+	writeRandomFile(t, old, 1024)
+
+	repodir := filepath.Join(dir, "repo")
+	r, oldSnapshot := setupDecodeTest(t, repodir, []string{shared, old}, CompressionNone, 0)
+
+	// a second snapshot shares one of the files with the first one
+	index, err := OpenChunkIndex(&r)
+	if err != nil {
+		t.Fatalf("Failed opening chunk-index: %s", err)
+	}
+	snapshot, err := NewSnapshot("test_snapshot")
+	if err != nil {
+		t.Fatalf("Failed creating snapshot: %s", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed getting working dir: %s", err)
+	}
+	for p := range snapshot.Add(wd, []string{shared}, []string{}, r, &index, CompressionNone, EncryptionAES, 1, 0) {
+		if p.Error != nil {
+			t.Fatalf("Failed adding to snapshot: %s", p.Error)
+		}
+	}
+	if err = snapshot.Save(&r); err != nil {
+		t.Fatalf("Failed saving snapshot: %s", err)
+	}
+	if err = r.Volumes[0].AddSnapshot(snapshot.ID); err != nil {
+		t.Fatalf("Failed adding snapshot to volume: %s", err)
+	}
+	if err = r.Save(); err != nil {
+		t.Fatalf("Failed saving repository: %s", err)
+	}
+	if err = index.Save(&r); err != nil {
+		t.Fatalf("Failed saving chunk-index: %s", err)
+	}
+
+	if _, err = PruneSnapshots(&r, RetentionPolicy{}); err != ErrRetentionPolicyEmpty {
+		t.Errorf("Expected %v, got %v", ErrRetentionPolicyEmpty, err)
+	}
+
+	stats, err := PruneSnapshots(&r, RetentionPolicy{KeepLast: 1})
+	if err != nil {
+		t.Fatalf("Failed pruning snapshots: %s", err)
+	}
+	if stats.Snapshots != 1 || stats.Chunks != len(oldSnapshot.Archives[old].Chunks) {
+		t.Errorf("Expected 1 snapshot and %d chunks to be removed, got %d and %d", len(oldSnapshot.Archives[old].Chunks), stats.Snapshots, stats.Chunks)
+	}
+	if stats.FreedSize != oldSnapshot.Archives[old].StorageSize {
+		t.Errorf("Expected %d bytes to be freed, got %d", oldSnapshot.Archives[old].StorageSize, stats.FreedSize)
+	}
+
+	r, err = OpenRepository(repodir, testPassword)
+	if err != nil {
+		t.Fatalf("Failed opening repository: %s", err)
+	}
+	if _, _, err = r.FindSnapshot(oldSnapshot.ID); err != ErrSnapshotNotFound {
+		t.Errorf("Expected %v for the pruned snapshot, got %v", ErrSnapshotNotFound, err)
+	}
+
+	// the chunks of the remaining snapshot are untouched
+	_, snapshot, err = r.FindSnapshot(snapshot.ID)
+	if err != nil {
+		t.Fatalf("Failed finding snapshot: %s", err)
+	}
+	b, _, err := DecodeArchiveData(r, *snapshot.Archives[shared])
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after pruning")
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitedBackend wraps a Backend and limits the throughput of chunk
+// transfers. All other calls are passed through unchanged
+type RateLimitedBackend struct {
+	Backend
+
+	read  *tokenBucket
+	write *tokenBucket
+}
+
+// NewRateLimitedBackend returns a RateLimitedBackend, limiting reads and
+// writes to the given amount of bytes per second. A limit of 0 disables
+// limiting in that direction
+func NewRateLimitedBackend(backend Backend, readLimit, writeLimit uint64) *RateLimitedBackend {
+	return &RateLimitedBackend{
+		Backend: backend,
+		read:    newTokenBucket(readLimit),
+		write:   newTokenBucket(writeLimit),
+	}
+}
+
+// SetReadLimit changes the maximum amount of bytes loaded per second
+func (backend *RateLimitedBackend) SetReadLimit(limit uint64) {
+	backend.read.SetRate(limit)
+}
+
+// SetWriteLimit changes the maximum amount of bytes stored per second
+func (backend *RateLimitedBackend) SetWriteLimit(limit uint64) {
+	backend.write.SetRate(limit)
+}
+
+// LoadChunk loads a single Chunk, waiting until the read limit permits it
+func (backend *RateLimitedBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	b, err := backend.Backend.LoadChunk(shasum, part, totalParts)
+	backend.read.Wait(len(b))
+	return b, err
+}
+
+// StoreChunk stores a single Chunk, waiting until the write limit permits it
+func (backend *RateLimitedBackend) StoreChunk(shasum string, part, totalParts uint, data []byte) (uint64, error) {
+	backend.write.Wait(len(data))
+	return backend.Backend.StoreChunk(shasum, part, totalParts, data)
+}
+
+// ListChunks returns all chunk parts stored on the wrapped backend
+func (backend *RateLimitedBackend) ListChunks() ([]StoredChunk, error) {
+	lister, ok := backend.Backend.(ChunkLister)
+	if !ok {
+		return nil, ErrListChunksUnsupported
+	}
+	return lister.ListChunks()
+}
+
+// StoreLock stores a single lock on the wrapped backend
+func (backend *RateLimitedBackend) StoreLock(id string, data []byte) error {
+	locker, ok := backend.Backend.(Locker)
+	if !ok {
+		return ErrLockingUnsupported
+	}
+	return locker.StoreLock(id, data)
+}
+
+// ListLocks returns all locks stored on the wrapped backend
+func (backend *RateLimitedBackend) ListLocks() ([][]byte, error) {
+	locker, ok := backend.Backend.(Locker)
+	if !ok {
+		return nil, ErrLockingUnsupported
+	}
+	return locker.ListLocks()
+}
+
+// DeleteLock removes a lock from the wrapped backend
+func (backend *RateLimitedBackend) DeleteLock(id string) error {
+	locker, ok := backend.Backend.(Locker)
+	if !ok {
+		return ErrLockingUnsupported
+	}
+	return locker.DeleteLock(id)
+}
+
+// tokenBucket allows bursts of up to one second worth of data and throttles
+// anything beyond the configured rate
+type tokenBucket struct {
+	mut    sync.Mutex
+	rate   uint64 // bytes per second, 0 means unlimited
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate uint64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// SetRate changes the rate of the bucket. Data which has already been
+// accounted for isn't affected
+func (tb *tokenBucket) SetRate(rate uint64) {
+	tb.mut.Lock()
+	defer tb.mut.Unlock()
+
+	tb.refill()
+	tb.rate = rate
+	if tb.tokens > float64(rate) {
+		tb.tokens = float64(rate)
+	}
+}
+
+// Wait blocks until n bytes may be transferred
+func (tb *tokenBucket) Wait(n int) {
+	tb.mut.Lock()
+	if tb.rate == 0 {
+		tb.mut.Unlock()
+		return
+	}
+
+	// tokens may go negative: the debt delays this and all following transfers
+	tb.refill()
+	tb.tokens -= float64(n)
+	var delay time.Duration
+	if tb.tokens < 0 {
+		delay = time.Duration(-tb.tokens / float64(tb.rate) * float64(time.Second))
+	}
+	tb.mut.Unlock()
+
+	time.Sleep(delay)
+}
+
+// refill adds the tokens gathered since the last refill. Must be called with
+// the mutex held
+func (tb *tokenBucket) refill() {
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * float64(tb.rate)
+	if tb.tokens > float64(tb.rate) {
+		tb.tokens = float64(tb.rate)
+	}
+	tb.last = now
+}
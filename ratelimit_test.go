@@ -0,0 +1,64 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"testing"
+	"time"
+)
+
+// sizedBackend returns chunks of a fixed size
+type sizedBackend struct {
+	Backend
+
+	size int
+}
+
+func (b *sizedBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	return make([]byte, b.size), nil
+}
+
+func (b *sizedBackend) StoreChunk(shasum string, part, totalParts uint, data []byte) (uint64, error) {
+	return uint64(len(data)), nil
+}
+
+func TestRateLimitedBackend(t *testing.T) {
+	backend := NewRateLimitedBackend(&sizedBackend{size: 50000}, 100000, 0)
+
+	// the first second worth of data passes immediately, the rest gets throttled
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := backend.LoadChunk("chunk", 0, 1); err != nil {
+			t.Fatalf("Failed loading chunk: %s", err)
+		}
+	}
+	if d := time.Since(start); d < 450*time.Millisecond {
+		t.Errorf("Loading chunks wasn't throttled, took %s", d)
+	}
+
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := backend.StoreChunk("chunk", 0, 1, make([]byte, 50000)); err != nil {
+			t.Fatalf("Failed storing chunk: %s", err)
+		}
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Storing chunks was throttled without a write limit, took %s", d)
+	}
+
+	backend.SetReadLimit(0)
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := backend.LoadChunk("chunk", 0, 1); err != nil {
+			t.Fatalf("Failed loading chunk: %s", err)
+		}
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Loading chunks was throttled after removing the limit, took %s", d)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// RepairChunk regenerates the parts of a chunk which are missing from the
+// backends and stores them again. It returns the amount of parts healed.
+// Chunks without parity parts can't be repaired
+func RepairChunk(repository Repository, chunk Chunk) (uint, error) {
+	if chunk.ParityParts == 0 {
+		_, err := repository.backend.LoadChunk(chunk, 0)
+		return 0, err
+	}
+
+	enc, err := reedsolomon.New(int(chunk.DataParts), int(chunk.ParityParts))
+	if err != nil {
+		return 0, err
+	}
+
+	total := int(chunk.DataParts + chunk.ParityParts)
+	pars := make([][]byte, total)
+	var missing []uint
+	for i := 0; i < total; i++ {
+		b, err := repository.backend.LoadChunk(chunk, uint(i))
+		if err != nil {
+			missing = append(missing, uint(i))
+			continue
+		}
+		pars[i] = b
+	}
+	if len(missing) == 0 {
+		return 0, nil
+	}
+
+	if err := enc.Reconstruct(pars); err != nil {
+		return 0, &DataReconstructionError{
+			Chunk:          chunk,
+			BlocksFound:    uint(total - len(missing)),
+			FailedBackends: uint(len(missing)),
+			MissingParts:   missing,
+		}
+	}
+
+	// never write back parts regenerated from corrupted data
+	var b bytes.Buffer
+	if err := enc.Join(&b, pars, chunk.Size); err != nil {
+		return 0, err
+	}
+	if err := verifyStoredChunk(chunk, b.Bytes()); err != nil {
+		return 0, err
+	}
+
+	var healed uint
+	for _, part := range missing {
+		if _, err := repository.backend.StoreChunkPart(chunk, part, pars[part]); err != nil {
+			return healed, err
+		}
+		healed++
+	}
+
+	return healed, nil
+}
+
+// RepairSnapshot runs RepairChunk for every chunk referenced by a snapshot and
+// returns the total amount of parts healed. Chunks which can't be repaired
+// don't stop the repair, the first error encountered gets returned
+func RepairSnapshot(repository Repository, snapshotID string) (uint, error) {
+	_, snapshot, err := repository.FindSnapshot(snapshotID)
+	if err != nil {
+		return 0, err
+	}
+
+	var healed uint
+	var firstErr error
+	repaired := make(map[string]bool)
+	for _, arc := range snapshot.Archives {
+		for _, chunk := range arc.Chunks {
+			// chunks shared by several archives only need to be repaired once
+			if repaired[chunk.Hash] {
+				continue
+			}
+			repaired[chunk.Hash] = true
+
+			n, err := RepairChunk(repository, chunk)
+			healed += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return healed, firstErr
+}
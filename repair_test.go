@@ -0,0 +1,81 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepairSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	writeRandomFile(t, src, 3*preferredChunkSize)
+
+	repodir := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repodir, []string{src}, CompressionNone, 2)
+	arc := *snapshot.Archives[src]
+
+	// remove two out of three parts of every chunk
+	partPath := func(chunk Chunk, part int) string {
+		return filepath.Join(repodir, chunksDirname, SubDirForChunk(chunk.Hash), fmt.Sprintf("%s.%d_1", chunk.Hash, part))
+	}
+	for _, chunk := range arc.Chunks {
+		for part := 0; part < 2; part++ {
+			err = os.Remove(partPath(chunk, part))
+			if err != nil {
+				t.Fatalf("Failed removing chunk part: %s", err)
+			}
+		}
+	}
+
+	healed, err := RepairSnapshot(r, snapshot.ID)
+	if err != nil {
+		t.Fatalf("Failed repairing snapshot: %s", err)
+	}
+	if healed != uint(2*len(arc.Chunks)) {
+		t.Errorf("Expected %d healed parts, got %d", 2*len(arc.Chunks), healed)
+	}
+	for _, chunk := range arc.Chunks {
+		for part := 0; part < 3; part++ {
+			if _, err := os.Stat(partPath(chunk, part)); err != nil {
+				t.Errorf("Expected part %d of chunk %s to exist: %s", part, chunk.Hash, err)
+			}
+		}
+	}
+
+	// a healthy snapshot needs no repair
+	healed, err = RepairSnapshot(r, snapshot.ID)
+	if err != nil {
+		t.Fatalf("Failed repairing snapshot: %s", err)
+	}
+	if healed != 0 {
+		t.Errorf("Expected no healed parts, got %d", healed)
+	}
+
+	// losing all parts of a chunk can't be repaired
+	chunk := arc.Chunks[0]
+	for part := 0; part < 3; part++ {
+		err = os.Remove(partPath(chunk, part))
+		if err != nil {
+			t.Fatalf("Failed removing chunk part: %s", err)
+		}
+	}
+	_, err = RepairChunk(r, chunk)
+	if _, ok := err.(*DataReconstructionError); !ok {
+		t.Errorf("Expected DataReconstructionError, got %v", err)
+	}
+}
@@ -8,6 +8,7 @@
 package knoxite
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
@@ -16,19 +17,22 @@ import (
 // A Repository is a collection of backup snapshots
 // MUST BE encrypted
 type Repository struct {
-	Version uint      `json:"version"`
-	Volumes []*Volume `json:"volumes"`
-	Paths   []string  `json:"storage"`
-	Key     string    `json:"key"` // key for encrypting data stored with knoxite
+	Version uint          `json:"version"`
+	Volumes []*Volume     `json:"volumes"`
+	Paths   []string      `json:"storage"`
+	Key     string        `json:"key"`     // key for encrypting data stored with knoxite
+	Chunker ChunkerConfig `json:"chunker"` // empty for repositories using DefaultChunkerConfig
 	// Owner   string    `json:"owner"`
 
 	backend  BackendManager
-	password string // password for knoxite repository file
+	password string      // password the repository has been unlocked with
+	keySlots []keySlot   // Key, encrypted with every password that unlocks the repository
+	cache    *chunkCache // decoded chunks, shared by all copies of this repository
 }
 
 // Const declarations
 const (
-	RepositoryVersion = 4
+	RepositoryVersion = 6
 )
 
 // Error declarations
@@ -49,11 +53,19 @@ func NewRepository(path, password string) (Repository, error) {
 		return Repository{}, ErrGenerateRandomKeyFailed
 	}
 
+	slot, err := wrapKey(password, key)
+	if err != nil {
+		return Repository{}, err
+	}
+
 	repository := Repository{
 		Version:  RepositoryVersion,
 		password: password,
 		Key:      key,
+		keySlots: []keySlot{slot},
+		cache:    newChunkCache(DefaultChunkCacheSize),
 	}
+	repository.backend.RetryPolicy = DefaultRetryPolicy
 
 	backend, err := BackendFromURL(path)
 	if err != nil {
@@ -81,7 +93,9 @@ func generateRandomKey(length int) (string, error) {
 func OpenRepository(path, password string) (Repository, error) {
 	repository := Repository{
 		password: password,
+		cache:    newChunkCache(DefaultChunkCacheSize),
 	}
+	repository.backend.RetryPolicy = DefaultRetryPolicy
 
 	backend, err := BackendFromURL(path)
 	if err != nil {
@@ -92,22 +106,21 @@ func OpenRepository(path, password string) (Repository, error) {
 		return repository, err
 	}
 
-	pipe, err := NewDecodingPipeline(CompressionNone, EncryptionAES, password)
-	if err != nil {
-		return repository, err
-	}
-	err = pipe.Decode(b, &repository)
-	if err != nil {
-		return repository, ErrOpenRepositoryFailed
-	}
-	if repository.Version < RepositoryVersion {
-		// migrate to current version
-		err = repository.Migrate()
+	upgraded := false
+	if bytes.HasPrefix(b, repositoryMagic) {
+		upgraded, err = repository.decodeRepositoryFile(b, password)
+	} else {
+		// repositories before version 6 are encrypted with the password
+		var pipe Pipeline
+		pipe, err = NewDecodingPipeline(CompressionNone, EncryptionAES, password)
 		if err != nil {
 			return repository, err
 		}
+		err = pipe.Decode(b, &repository)
+	}
+	if err != nil {
+		return repository, ErrOpenRepositoryFailed
 	}
-
 	for _, url := range repository.Paths {
 		backend, berr := BackendFromURL(url)
 		if berr != nil {
@@ -116,6 +129,20 @@ func OpenRepository(path, password string) (Repository, error) {
 		repository.backend.AddBackend(&backend)
 	}
 
+	if repository.Version < RepositoryVersion {
+		// migrate to current version, which needs the backends to store the
+		// migrated repository
+		err = repository.Migrate()
+		if err != nil {
+			return repository, err
+		}
+	} else if upgraded {
+		err = repository.Save()
+		if err != nil {
+			return repository, err
+		}
+	}
+
 	return repository, err
 }
 
@@ -190,6 +217,53 @@ func (r *Repository) BackendManager() *BackendManager {
 	return &r.backend
 }
 
+// SetChunkCacheSize limits the amount of memory used to cache decoded chunks.
+// A size of 0 disables the chunk cache for this repository
+func (r *Repository) SetChunkCacheSize(size uint64) {
+	if size == 0 {
+		r.cache = nil
+		return
+	}
+	if r.cache == nil {
+		r.cache = newChunkCache(size)
+		return
+	}
+
+	r.cache.SetMaxSize(size)
+}
+
+// SetReadAhead sets how many chunks get prefetched while reading an archive.
+// Prefetching requires the chunk cache to be enabled. A value of 0 disables it
+func (r *Repository) SetReadAhead(n int) {
+	if r.cache != nil {
+		r.cache.SetReadAhead(n)
+	}
+}
+
+// SetChunkerConfig changes how files stored in the repository get split
+// into chunks
+func (r *Repository) SetChunkerConfig(cfg ChunkerConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	r.Chunker = cfg
+	return nil
+}
+
+// chunkerConfig returns the ChunkerConfig used for storing files
+func (r *Repository) chunkerConfig() ChunkerConfig {
+	if r.Chunker == (ChunkerConfig{}) {
+		return DefaultChunkerConfig
+	}
+	return r.Chunker
+}
+
+// SetRetryPolicy sets the RetryPolicy used when loading chunks from backends
+func (r *Repository) SetRetryPolicy(policy RetryPolicy) {
+	r.backend.RetryPolicy = policy
+}
+
 // Init creates a new repository
 func (r *Repository) init() error {
 	err := r.backend.InitRepository()
@@ -204,19 +278,29 @@ func (r *Repository) init() error {
 func (r *Repository) Save() error {
 	r.Paths = r.backend.Locations()
 
-	pipe, err := NewEncodingPipeline(CompressionNone, EncryptionAES, r.password)
-	if err != nil {
-		return err
-	}
-	b, err := pipe.Encode(r)
+	b, err := r.encodeRepositoryFile()
 	if err != nil {
 		return err
 	}
 	return r.backend.SaveRepository(b)
 }
 
-// Changes password of repository
+// ChangePassword replaces the password the repository has been unlocked with.
+// Only the Key's keyslot gets rewritten, the data stays untouched
 func (r *Repository) ChangePassword(newPassword string) error {
+	i, _ := r.findKeySlot(r.password)
+	if i < 0 {
+		return ErrPasswordNotFound
+	}
+	if j, _ := r.findKeySlot(newPassword); j >= 0 {
+		return ErrPasswordExists
+	}
+
+	slot, err := wrapKey(newPassword, r.Key)
+	if err != nil {
+		return err
+	}
+	r.keySlots[i] = slot
 	r.password = newPassword
 
 	return r.Save()
@@ -233,12 +317,23 @@ func (r *Repository) Migrate() error {
 		// - Key is for encryption of the data and will be stored in encrypted repo file
 		// - password is for the encryption of the repository (which holds Key)
 		// to migrate we need to use the existing repository password as key
-		if r.Key == "" {
-			r.Key = r.password
-			r.Version = 4
-
-			return r.Save()
+		if r.Key != "" {
+			return ErrRepositoryIncompatible
 		}
+		r.Key = r.password
+		fallthrough
+	case v == 4:
+		// since version 6 the Key is stored in keyslots, one per password,
+		// which are protected with keys derived by Argon2id. The repository
+		// gets encrypted with the Key
+		slot, err := wrapKey(r.password, r.Key)
+		if err != nil {
+			return err
+		}
+		r.keySlots = []keySlot{slot}
+		r.Version = RepositoryVersion
+
+		return r.Save()
 	}
 	return ErrRepositoryIncompatible
 }
@@ -115,3 +115,34 @@ func TestRepositoryChangePassword(t *testing.T) {
 	}
 
 }
+
+func TestRepositoryChunkCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"repository.go"}, CompressionNone, 0)
+	other, err := OpenRepository(dir, "this_is_a_password")
+	if err != nil {
+		t.Fatalf("Failed opening repository: %s", err)
+	}
+
+	_, _, err = DecodeArchiveData(r, *snapshot.Archives["repository.go"])
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+	if r.cache.Size() == 0 {
+		t.Error("Expected decoded chunks to be cached")
+	}
+	if other.cache.Size() != 0 {
+		t.Error("Expected repositories not to share their chunk cache")
+	}
+
+	r.SetChunkCacheSize(0)
+	_, _, err = DecodeArchiveData(r, *snapshot.Archives["repository.go"])
+	if err != nil {
+		t.Errorf("Failed decoding archive without a chunk cache: %s", err)
+	}
+}
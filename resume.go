@@ -0,0 +1,75 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io"
+	"os"
+)
+
+// openResumable opens a partially or fully restored file at path, so the
+// restore can continue after its last correctly restored chunk. It returns a
+// nil file if there is nothing to resume. Otherwise the file is truncated to
+// and positioned at the returned offset, where chunk number first begins
+func openResumable(path string, arc Archive) (*os.File, uint, int, error) {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil, 0, 0, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	first, offset, err := restoredChunks(f, fi.Size(), arc)
+	if err == nil {
+		err = f.Truncate(int64(offset))
+	}
+	if err == nil {
+		_, err = f.Seek(int64(offset), io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, 0, err
+	}
+
+	return f, first, offset, nil
+}
+
+// restoredChunks compares the leading chunks of an archive with the data
+// found in f. It returns the amount of chunks that match and the offset
+// where their data ends
+func restoredChunks(f *os.File, size int64, arc Archive) (uint, int, error) {
+	offset := 0
+	num := uint(0)
+	for ; num < uint(len(arc.Chunks)); num++ {
+		idx, err := arc.IndexOfChunk(num)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		chunk := arc.Chunks[idx]
+		if int64(offset+chunk.OriginalSize) > size {
+			break
+		}
+
+		b := make([]byte, chunk.OriginalSize)
+		_, err = f.ReadAt(b, int64(offset))
+		if err != nil {
+			return 0, 0, err
+		}
+		if Hash(b, HashHighway256) != chunk.DecryptedHash {
+			break
+		}
+
+		offset += chunk.OriginalSize
+	}
+
+	return num, offset, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeArchiveResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 4*preferredChunkSize)
+
+	repo := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repo, []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+	if len(arc.Chunks) < 2 {
+		t.Fatalf("Expected multiple chunks, got %d", len(arc.Chunks))
+	}
+	idx, err := arc.IndexOfChunk(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstChunkSize := arc.Chunks[idx].OriginalSize
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+	path := filepath.Join(targetdir, "random")
+
+	opts := DefaultRestoreOptions()
+	opts.Resume = true
+	restore := func() {
+		progress := make(chan Progress)
+		go func() {
+			for range progress {
+			}
+		}()
+		err := DecodeArchive(progress, r, arc, path, opts)
+		close(progress)
+		if err != nil {
+			t.Fatalf("Failed restoring archive: %s", err)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed reading restored file: %s", err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Error("Data mismatch after resuming restore")
+		}
+	}
+
+	// nothing to resume
+	restore()
+
+	// interrupted in the middle of the second chunk
+	err = os.Truncate(path, int64(firstChunkSize+100))
+	if err != nil {
+		t.Fatalf("Failed truncating restored file: %s", err)
+	}
+	restore()
+
+	// corrupted data gets restored again
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte("corrupted"), 10)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore()
+
+	// completely restored files don't need to load any chunks
+	err = os.RemoveAll(filepath.Join(repo, "chunks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore()
+}
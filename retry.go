@@ -0,0 +1,60 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// RetryPolicy controls how often failing backend operations get retried
+type RetryPolicy struct {
+	MaxAttempts int           // total amount of attempts, including the first one
+	Delay       time.Duration // delay before the first retry, doubled for every further retry
+	Jitter      float64       // adds up to this fraction of the delay at random, so clients don't retry in lockstep
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by new and opened repositories
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Delay:       100 * time.Millisecond,
+	Jitter:      0.2,
+}
+
+// isPermanentError returns true for errors which won't go away by retrying,
+// like data missing on a backend. Backends report missing data as errors
+// os.IsNotExist recognizes, or errors wrapping os.ErrNotExist
+func isPermanentError(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, os.ErrNotExist)
+}
+
+// Retry calls f until it succeeds, returns a permanent error or the maximum
+// amount of attempts has been reached
+func (p RetryPolicy) Retry(f func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || isPermanentError(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		time.Sleep(p.backoff(attempt))
+	}
+}
+
+// backoff returns the delay before retrying after the given failed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Delay << uint(attempt-1)
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+
+	return delay
+}
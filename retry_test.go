@@ -0,0 +1,89 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// flakyBackend fails the first n calls to LoadChunk with err
+type flakyBackend struct {
+	Backend
+
+	n     int
+	err   error
+	calls int
+}
+
+func (b *flakyBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	b.calls++
+	if b.calls <= b.n {
+		return nil, b.err
+	}
+	return []byte(shasum), nil
+}
+
+func TestRetryLoadChunk(t *testing.T) {
+	tests := []struct {
+		failures    int
+		err         error
+		expectCalls int
+		expectErr   bool
+	}{
+		{0, errors.New("connection reset"), 1, false},
+		{2, errors.New("connection reset"), 3, false},
+		{3, errors.New("connection reset"), 3, true},
+		{2, os.ErrNotExist, 1, true},
+		// missing data as reported by backends
+		{2, &os.PathError{Op: "load", Path: "chunk", Err: os.ErrNotExist}, 1, true},
+		{2, fmt.Errorf("downloading chunk: %w", os.ErrNotExist), 1, true},
+	}
+
+	for _, tt := range tests {
+		fb := &flakyBackend{n: tt.failures, err: tt.err}
+		var be Backend = fb
+
+		bm := BackendManager{
+			Backends:    []*Backend{&be},
+			RetryPolicy: RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond},
+		}
+		b, err := bm.LoadChunk(Chunk{Hash: "chunk"}, 0)
+		if tt.expectErr && err == nil {
+			t.Errorf("Expected error after %d failures (%v)", tt.failures, tt.err)
+		}
+		if !tt.expectErr {
+			if err != nil {
+				t.Errorf("Failed loading chunk after %d failures: %s", tt.failures, err)
+			} else if string(b) != "chunk" {
+				t.Errorf("Loaded chunk data mismatches: %s", b)
+			}
+		}
+		if fb.calls != tt.expectCalls {
+			t.Errorf("Expected %d calls to LoadChunk, got %d", tt.expectCalls, fb.calls)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 4, Delay: 100 * time.Millisecond, Jitter: 0.5}
+
+	for attempt := 1; attempt < p.MaxAttempts; attempt++ {
+		min := p.Delay << uint(attempt-1)
+		max := min + min/2
+		for i := 0; i < 100; i++ {
+			d := p.backoff(attempt)
+			if d < min || d > max {
+				t.Errorf("Expected delay between %s and %s for attempt %d, got %s", min, max, attempt, d)
+			}
+		}
+	}
+}
@@ -15,7 +15,16 @@ import (
 	"strings"
 )
 
-func findFiles(rootPath string, excludes []string) chan ArchiveResult {
+// inode identifies a file on a device
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// findFiles walks rootPath and returns an archive for every item it finds.
+// Files with multiple hardlinks are recorded in links and every further link
+// to the same inode gets its LinkTarget set instead of being stored again
+func findFiles(rootPath string, excludes []string, links map[inode]string) chan ArchiveResult {
 	c := make(chan ArchiveResult)
 	go func() {
 		err := filepath.Walk(rootPath, func(path string, fi os.FileInfo, err error) error {
@@ -23,20 +32,17 @@ func findFiles(rootPath string, excludes []string) chan ArchiveResult {
 				if os.IsNotExist(err) {
 					return nil
 				}
-				// fmt.Fprintf(os.Stderr, "Could not find %s\n", path)
 				return err
 			}
 			if fi == nil {
-				// fmt.Fprintf(os.Stderr, "Could not read %s\n", path)
 				return fmt.Errorf("%s: could not read", path)
 			}
 
 			match := false
 			for _, exclude := range excludes {
-				// fmt.Println("Matching", path, filepath.Base(path), exclude)
 				match, err = filepath.Match(strings.ToLower(exclude), strings.ToLower(path))
 				if err != nil {
-					fmt.Println("Invalid exclude filter:", exclude)
+					logger.Warnf("Invalid exclude filter: %s", exclude)
 					return err
 				}
 				if !match {
@@ -44,7 +50,7 @@ func findFiles(rootPath string, excludes []string) chan ArchiveResult {
 				}
 
 				if match {
-					// fmt.Printf("\n\nSkipping %s as it matches filter: %s\n\n", path, exclude)
+					logger.Debugf("Skipping %s as it matches filter: %s", path, exclude)
 					break
 				}
 			}
@@ -71,7 +77,7 @@ func findFiles(rootPath string, excludes []string) chan ArchiveResult {
 			if isSymLink(fi) {
 				symlink, lerr := os.Readlink(path)
 				if lerr != nil {
-					fmt.Fprintf(os.Stderr, "error resolving symlink for: %v - %v\n", path, lerr)
+					logger.Warnf("error resolving symlink for: %v - %v", path, lerr)
 					return nil
 				}
 
@@ -82,10 +88,27 @@ func findFiles(rootPath string, excludes []string) chan ArchiveResult {
 			} else if isRegularFile(fi) {
 				archive.Type = File
 				archive.Size = uint64(fi.Size())
+
+				if statT.nlink() > 1 {
+					id := inode{statT.dev(), statT.ino()}
+					if target, ok := links[id]; ok {
+						archive.LinkTarget = target
+					} else {
+						links[id] = path
+					}
+				}
 			} else {
 				return nil
 			}
 
+			if archive.Type != SymLink {
+				xattrs, xerr := readXAttrs(path)
+				if xerr != nil {
+					logger.Warnf("error reading extended attributes for: %v - %v", path, xerr)
+				}
+				archive.XAttrs = xattrs
+			}
+
 			c <- ArchiveResult{Archive: &archive, Error: nil}
 			return nil
 		})
@@ -0,0 +1,118 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SearchQuery describes the archives to look for. Criteria left at their
+// zero value match all archives
+type SearchQuery struct {
+	// Name is a glob the archive's path has to match, see
+	// RestoreOptions.Include for the syntax. Patterns without a slash match
+	// the file name at any depth
+	Name string
+	// MinSize and MaxSize limit the archive's size, both inclusive. A zero
+	// MaxSize means no upper limit
+	MinSize uint64
+	MaxSize uint64
+	// ModifiedAfter and ModifiedBefore limit the archive's modification time
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// Types restricts the search to archives of these types, like File or
+	// Directory
+	Types []uint8
+}
+
+// SearchResult is an archive matching a SearchQuery
+type SearchResult struct {
+	VolumeID   string
+	SnapshotID string
+	Archive    *Archive
+}
+
+// matches returns true if arc meets all criteria of the query
+func (query SearchQuery) matches(arc *Archive) (bool, error) {
+	if arc.Size < query.MinSize || (query.MaxSize > 0 && arc.Size > query.MaxSize) {
+		return false, nil
+	}
+
+	modTime := time.Unix(arc.ModTime, 0)
+	if (!query.ModifiedAfter.IsZero() && modTime.Before(query.ModifiedAfter)) ||
+		(!query.ModifiedBefore.IsZero() && modTime.After(query.ModifiedBefore)) {
+		return false, nil
+	}
+
+	if len(query.Types) > 0 {
+		found := false
+		for _, t := range query.Types {
+			if arc.Type == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	if query.Name == "" {
+		return true, nil
+	}
+	return matchGlob(query.Name, arc.Path)
+}
+
+// SearchSnapshot returns the archives of a snapshot matching query, sorted by
+// path. Only the snapshot's metadata gets searched, no chunks are loaded
+func SearchSnapshot(snapshot *Snapshot, query SearchQuery) ([]SearchResult, error) {
+	if !validGlob(query.Name) {
+		return nil, fmt.Errorf("Invalid name filter: %s", query.Name)
+	}
+
+	var results []SearchResult
+	for _, arc := range snapshot.Archives {
+		match, err := query.matches(arc)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			results = append(results, SearchResult{SnapshotID: snapshot.ID, Archive: arc})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Archive.Path < results[j].Archive.Path })
+	return results, nil
+}
+
+// SearchRepository returns the archives of all snapshots in a repository
+// matching query, ordered by volume and snapshot
+func SearchRepository(repository *Repository, query SearchQuery) ([]SearchResult, error) {
+	var results []SearchResult
+	for _, vol := range repository.Volumes {
+		for _, id := range vol.Snapshots {
+			snapshot, err := vol.LoadSnapshot(id, repository)
+			if err != nil {
+				return nil, err
+			}
+
+			r, err := SearchSnapshot(snapshot, query)
+			if err != nil {
+				return nil, err
+			}
+			for i := range r {
+				r[i].VolumeID = vol.ID
+			}
+			results = append(results, r...)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,81 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.Mkdir(src, 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	old := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, size := range map[string]int{"a.pdf": 100, "b.pdf": 5000, "c.txt": 10000} {
+		p := filepath.Join(src, name)
+		writeRandomFile(t, p, size)
+		if name == "a.pdf" {
+			if err := os.Chtimes(p, old, old); err != nil {
+				t.Fatalf("Failed setting modification time: %s", err)
+			}
+		}
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	tests := []struct {
+		query    SearchQuery
+		expected []string
+	}{
+		{SearchQuery{Name: "*.pdf"}, []string{"a.pdf", "b.pdf"}},
+		{SearchQuery{MinSize: 1000, Types: []uint8{File}}, []string{"b.pdf", "c.txt"}},
+		{SearchQuery{MinSize: 1000, MaxSize: 5000}, []string{"b.pdf"}},
+		{SearchQuery{ModifiedBefore: old.Add(time.Hour)}, []string{"a.pdf"}},
+		{SearchQuery{Name: "*.pdf", ModifiedAfter: old.Add(time.Hour)}, []string{"b.pdf"}},
+		{SearchQuery{Types: []uint8{Directory}}, []string{"src"}},
+	}
+	for _, tt := range tests {
+		results, err := SearchSnapshot(snapshot, tt.query)
+		if err != nil {
+			t.Fatalf("Failed searching snapshot: %s", err)
+		}
+		if len(results) != len(tt.expected) {
+			t.Errorf("Expected %d results for %+v, got %d", len(tt.expected), tt.query, len(results))
+			continue
+		}
+		for i, res := range results {
+			if filepath.Base(res.Archive.Path) != tt.expected[i] || res.SnapshotID != snapshot.ID {
+				t.Errorf("Expected %s in snapshot %s, got %s in %s", tt.expected[i], snapshot.ID, res.Archive.Path, res.SnapshotID)
+			}
+		}
+	}
+
+	results, err := SearchRepository(&r, SearchQuery{Name: "c.txt"})
+	if err != nil {
+		t.Fatalf("Failed searching repository: %s", err)
+	}
+	if len(results) != 1 || results[0].SnapshotID != snapshot.ID || results[0].VolumeID != r.Volumes[0].ID {
+		t.Errorf("Unexpected search results: %+v", results)
+	}
+
+	if _, err := SearchSnapshot(snapshot, SearchQuery{Name: "[a-"}); err == nil {
+		t.Error("Expected malformed name filter to fail")
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "sync"
+
+// SerializedBackend wraps a Backend which isn't safe for concurrent use and
+// makes sure only one call at a time reaches it
+type SerializedBackend struct {
+	mut     sync.Mutex
+	backend Backend
+}
+
+// NewSerializedBackend returns a SerializedBackend wrapping backend
+func NewSerializedBackend(backend Backend) *SerializedBackend {
+	return &SerializedBackend{
+		backend: backend,
+	}
+}
+
+// Location returns the type and location of the repository
+func (s *SerializedBackend) Location() string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.Location()
+}
+
+// Protocols returns the Protocol Schemes supported by this backend
+func (s *SerializedBackend) Protocols() []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.Protocols()
+}
+
+// Description returns a user-friendly description for this backend
+func (s *SerializedBackend) Description() string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.Description()
+}
+
+// Close the backend
+func (s *SerializedBackend) Close() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.Close()
+}
+
+// AvailableSpace returns the free space in bytes on this backend
+func (s *SerializedBackend) AvailableSpace() (uint64, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.AvailableSpace()
+}
+
+// LoadChunk loads a single Chunk
+func (s *SerializedBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.LoadChunk(shasum, part, totalParts)
+}
+
+// StoreChunk stores a single Chunk
+func (s *SerializedBackend) StoreChunk(shasum string, part, totalParts uint, data []byte) (uint64, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.StoreChunk(shasum, part, totalParts, data)
+}
+
+// DeleteChunk deletes a single Chunk
+func (s *SerializedBackend) DeleteChunk(shasum string, part, totalParts uint) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.DeleteChunk(shasum, part, totalParts)
+}
+
+// LoadSnapshot loads a snapshot
+func (s *SerializedBackend) LoadSnapshot(id string) ([]byte, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.LoadSnapshot(id)
+}
+
+// SaveSnapshot stores a snapshot
+func (s *SerializedBackend) SaveSnapshot(id string, data []byte) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.SaveSnapshot(id, data)
+}
+
+// LoadChunkIndex loads the chunk-index
+func (s *SerializedBackend) LoadChunkIndex() ([]byte, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.LoadChunkIndex()
+}
+
+// SaveChunkIndex stores the chunk-index
+func (s *SerializedBackend) SaveChunkIndex(data []byte) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.SaveChunkIndex(data)
+}
+
+// InitRepository creates a new repository
+func (s *SerializedBackend) InitRepository() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.InitRepository()
+}
+
+// LoadRepository reads the metadata for a repository
+func (s *SerializedBackend) LoadRepository() ([]byte, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.LoadRepository()
+}
+
+// SaveRepository stores the metadata for a repository
+func (s *SerializedBackend) SaveRepository(data []byte) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.backend.SaveRepository(data)
+}
+
+// ListChunks returns all chunk parts stored on the wrapped backend
+func (s *SerializedBackend) ListChunks() ([]StoredChunk, error) {
+	lister, ok := s.backend.(ChunkLister)
+	if !ok {
+		return nil, ErrListChunksUnsupported
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return lister.ListChunks()
+}
+
+// StoreLock stores a single lock on the wrapped backend
+func (s *SerializedBackend) StoreLock(id string, data []byte) error {
+	locker, ok := s.backend.(Locker)
+	if !ok {
+		return ErrLockingUnsupported
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return locker.StoreLock(id, data)
+}
+
+// ListLocks returns all locks stored on the wrapped backend
+func (s *SerializedBackend) ListLocks() ([][]byte, error) {
+	locker, ok := s.backend.(Locker)
+	if !ok {
+		return nil, ErrLockingUnsupported
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return locker.ListLocks()
+}
+
+// DeleteLock removes a lock from the wrapped backend
+func (s *SerializedBackend) DeleteLock(id string) error {
+	locker, ok := s.backend.(Locker)
+	if !ok {
+		return ErrLockingUnsupported
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return locker.DeleteLock(id)
+}
@@ -0,0 +1,74 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// racyBackend tracks loaded chunks without any synchronization
+type racyBackend struct {
+	Backend
+
+	loaded map[string]int
+}
+
+func (b *racyBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	b.loaded[shasum]++
+	return b.Backend.LoadChunk(shasum, part, totalParts)
+}
+
+func TestSerializedBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 5*preferredChunkSize)
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+
+	racy := &racyBackend{
+		Backend: *r.backend.Backends[0],
+		loaded:  make(map[string]int),
+	}
+	*r.backend.Backends[0] = NewSerializedBackend(racy)
+
+	opts := DefaultRestoreOptions()
+	opts.Concurrency = 4
+	path := filepath.Join(dir, "restored")
+
+	progress := make(chan Progress)
+	go func() {
+		for range progress {
+		}
+	}()
+	err = DecodeArchive(progress, r, arc, path, opts)
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading restored file: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after restoring through a serialized backend")
+	}
+	if len(racy.loaded) != len(arc.Chunks) {
+		t.Errorf("Expected %d chunks to be loaded, got %d", len(arc.Chunks), len(racy.loaded))
+	}
+}
@@ -8,6 +8,9 @@
 package knoxite
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -18,6 +21,11 @@ import (
 	uuid "github.com/nu7hatch/gouuid"
 )
 
+// Error declarations
+var (
+	ErrInvalidSnapshot = errors.New("Snapshot metadata is invalid")
+)
+
 // A Snapshot is a compilation of one or many archives
 // MUST BE encrypted
 type Snapshot struct {
@@ -27,6 +35,7 @@ type Snapshot struct {
 	Date        time.Time           `json:"date"`
 	Description string              `json:"description"`
 	Stats       Stats               `json:"stats"`
+	Tags        []string            `json:"tags,omitempty"`
 	Archives    map[string]*Archive `json:"items"`
 }
 
@@ -49,8 +58,9 @@ func NewSnapshot(description string) (*Snapshot, error) {
 
 func (snapshot *Snapshot) gatherTargetInformation(cwd string, paths []string, excludes []string, out chan ArchiveResult) {
 	var wg sync.WaitGroup
+	links := make(map[inode]string)
 	for _, path := range paths {
-		c := findFiles(path, excludes)
+		c := findFiles(path, excludes, links)
 
 		for result := range c {
 			if result.Error == nil {
@@ -58,6 +68,12 @@ func (snapshot *Snapshot) gatherTargetInformation(cwd string, paths []string, ex
 				if err == nil && !strings.HasPrefix(rel, "../") {
 					result.Archive.Path = rel
 				}
+				if result.Archive.LinkTarget != "" {
+					rel, err = filepath.Rel(cwd, result.Archive.LinkTarget)
+					if err == nil && !strings.HasPrefix(rel, "../") {
+						result.Archive.LinkTarget = rel
+					}
+				}
 				if isSpecialPath(result.Archive.Path) {
 					continue
 				}
@@ -91,6 +107,7 @@ func (snapshot *Snapshot) gatherTargetInformation(cwd string, paths []string, ex
 func (snapshot *Snapshot) Add(cwd string, paths []string, excludes []string, repository Repository, chunkIndex *ChunkIndex, compress, encrypt uint16, dataParts, parityParts uint) chan Progress {
 	progress := make(chan Progress)
 	fwd := make(chan ArchiveResult)
+	meter := newRateMeter(snapshot.Stats.Transferred)
 
 	go snapshot.gatherTargetInformation(cwd, paths, excludes, fwd)
 
@@ -117,9 +134,9 @@ func (snapshot *Snapshot) Add(cwd string, paths []string, excludes []string, rep
 			snapshot.mut.Unlock()
 			progress <- p
 
-			if archive.Type == File {
+			if archive.Type == File && archive.LinkTarget == "" {
 				dataParts = uint(math.Max(1, float64(dataParts)))
-				chunkchan, err := chunkFile(archive.Path, compress, encrypt, repository.Key, int(dataParts), int(parityParts))
+				chunkchan, err := chunkFile(archive.Path, repository.chunkerConfig(), compress, encrypt, repository.Key, int(dataParts), int(parityParts))
 				if err != nil {
 					if os.IsNotExist(err) {
 						// if this file has already been deleted before we could backup it, we can gracefully ignore it and continue
@@ -140,7 +157,7 @@ func (snapshot *Snapshot) Add(cwd string, paths []string, excludes []string, rep
 						return
 					}
 					chunk := cd.Chunk
-					// fmt.Printf("\tSplit %s (#%d, %d bytes), compression: %s, encryption: %s, hash: %s\n", id.Path, cd.Num, cd.Size, CompressionText(cd.Compressed), EncryptionText(cd.Encrypted), cd.Hash)
+					logger.Debugf("Split %s (#%d, %d bytes), hash: %s", archive.Path, chunk.Num, chunk.Size, chunk.Hash)
 
 					// store this chunk
 					n, err := repository.backend.StoreChunk(chunk)
@@ -165,6 +182,7 @@ func (snapshot *Snapshot) Add(cwd string, paths []string, excludes []string, rep
 					snapshot.mut.Lock()
 					p.TotalStatistics = snapshot.Stats
 					snapshot.mut.Unlock()
+					meter.update(&p)
 					progress <- p
 				}
 			}
@@ -225,3 +243,51 @@ func (snapshot *Snapshot) Save(repository *Repository) error {
 func (snapshot *Snapshot) AddArchive(archive *Archive) {
 	snapshot.Archives[archive.Path] = archive
 }
+
+// HasTag returns true if the snapshot is tagged with tag
+func (snapshot *Snapshot) HasTag(tag string) bool {
+	return containsString(snapshot.Tags, tag)
+}
+
+// ChunkRefs returns all chunks the archives of a snapshot refer to, keyed by
+// their hash. Chunks shared between archives are only contained once
+func (snapshot *Snapshot) ChunkRefs() map[string]Chunk {
+	refs := make(map[string]Chunk)
+	for _, archive := range snapshot.Archives {
+		for _, chunk := range archive.Chunks {
+			refs[chunk.Hash] = chunk
+		}
+	}
+	return refs
+}
+
+// ExportSnapshot writes a snapshot's metadata as JSON to w, so it can be
+// processed by other tools. The chunks' data isn't part of it
+func ExportSnapshot(w io.Writer, snapshot *Snapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snapshot)
+}
+
+// ImportSnapshot reads a snapshot's metadata written by ExportSnapshot
+func ImportSnapshot(r io.Reader) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.ID == "" {
+		return nil, ErrInvalidSnapshot
+	}
+
+	// archives are always keyed by their path
+	archives := make(map[string]*Archive, len(snapshot.Archives))
+	for _, arc := range snapshot.Archives {
+		if arc == nil {
+			return nil, ErrInvalidSnapshot
+		}
+		archives[arc.Path] = arc
+	}
+	snapshot.Archives = archives
+
+	return &snapshot, nil
+}
@@ -8,10 +8,13 @@
 package knoxite
 
 import (
+	"bytes"
 	"encoding/hex"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/minio/highwayhash"
@@ -38,16 +41,21 @@ func TestSnapshotCreate(t *testing.T) {
 
 	tests := []struct {
 		compression uint16
+		encryption  uint16
 		parityParts uint
 	}{
-		{CompressionNone, 0},
-		{CompressionFlate, 0},
-		{CompressionGZip, 0},
-		{CompressionLZMA, 0},
-		{CompressionZlib, 0},
-		{CompressionZstd, 0},
-		{CompressionNone, 1},
-		{CompressionGZip, 1},
+		{CompressionNone, EncryptionAES, 0},
+		{CompressionFlate, EncryptionAES, 0},
+		{CompressionGZip, EncryptionAES, 0},
+		{CompressionLZMA, EncryptionAES, 0},
+		{CompressionZlib, EncryptionAES, 0},
+		{CompressionZstd, EncryptionAES, 0},
+		{CompressionNone, EncryptionAES, 1},
+		{CompressionGZip, EncryptionAES, 1},
+		{CompressionNone, EncryptionChaCha20, 0},
+		{CompressionGZip, EncryptionChaCha20, 1},
+		{CompressionNone, EncryptionAESGCM, 0},
+		{CompressionGZip, EncryptionAESGCM, 1},
 	}
 	for _, tt := range tests {
 		dir, err := ioutil.TempDir("", "knoxite")
@@ -90,7 +98,7 @@ func TestSnapshotCreate(t *testing.T) {
 				t.Errorf("Failed getting working dir: %s", err)
 				return
 			}
-			progress := snapshot.Add(wd, []string{"snapshot_test.go", "snapshot.go"}, []string{}, r, &index, tt.compression, EncryptionAES, 1, tt.parityParts)
+			progress := snapshot.Add(wd, []string{"snapshot_test.go", "snapshot.go"}, []string{}, r, &index, tt.compression, tt.encryption, 1, tt.parityParts)
 			for p := range progress {
 				if p.Error != nil {
 					t.Errorf("Failed adding to snapshot: %s", p.Error)
@@ -156,7 +164,7 @@ func TestSnapshotCreate(t *testing.T) {
 			}
 			defer os.RemoveAll(targetdir)
 
-			progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{})
+			progress, err := DecodeSnapshot(r, snapshot, targetdir, []string{}, DefaultRestoreOptions())
 			if err != nil {
 				t.Errorf("Failed restoring snapshot: %s", err)
 				return
@@ -239,3 +247,88 @@ func TestSnapshotFind(t *testing.T) {
 		t.Errorf("Failed finding latest snapshot: %s %s", err, snapshot.ID)
 	}
 }
+
+func TestSnapshotExport(t *testing.T) {
+	snapshot, err := NewSnapshot("test")
+	if err != nil {
+		t.Fatalf("Failed creating snapshot: %s", err)
+	}
+	snapshot.AddArchive(&Archive{
+		Path:    "dir",
+		Type:    Directory,
+		Mode:    os.ModeDir | 0755,
+		ModTime: 1234,
+	})
+	snapshot.AddArchive(&Archive{
+		Path:   "dir/file",
+		Type:   File,
+		Mode:   0640,
+		Size:   42,
+		UID:    1000,
+		GID:    100,
+		XAttrs: map[string][]byte{"user.test": []byte("value")},
+		Chunks: []Chunk{{Hash: "abcd", DecryptedHash: "efgh", DataParts: 1, OriginalSize: 42, Size: 50}},
+	})
+
+	var buf bytes.Buffer
+	if err = ExportSnapshot(&buf, snapshot); err != nil {
+		t.Fatalf("Failed exporting snapshot: %s", err)
+	}
+
+	s, err := ImportSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("Failed importing snapshot: %s", err)
+	}
+	if s.ID != snapshot.ID || s.Description != snapshot.Description || !s.Date.Equal(snapshot.Date) {
+		t.Errorf("Expected snapshot %s (%s), got %s (%s)", snapshot.ID, snapshot.Description, s.ID, s.Description)
+	}
+	if !reflect.DeepEqual(s.Archives, snapshot.Archives) {
+		t.Errorf("Expected archives %v, got %v", snapshot.Archives, s.Archives)
+	}
+
+	_, err = ImportSnapshot(strings.NewReader(`{"items": {}}`))
+	if err != ErrInvalidSnapshot {
+		t.Errorf("Expected ErrInvalidSnapshot, got %v", err)
+	}
+}
+
+func TestSnapshotChunkRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.Mkdir(src, 0755)
+	if err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	data := writeRandomFile(t, filepath.Join(src, "a"), 2*preferredChunkSize+1024)
+	err = ioutil.WriteFile(filepath.Join(src, "b"), data, 0644)
+	if err != nil {
+		t.Fatalf("Failed writing file: %s", err)
+	}
+
+	_, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	total := 0
+	for _, arc := range snapshot.Archives {
+		total += len(arc.Chunks)
+	}
+	refs := snapshot.ChunkRefs()
+	if len(refs) != total/2 {
+		t.Errorf("Expected %d distinct chunks, got %d", total/2, len(refs))
+	}
+
+	var size uint64
+	for hash, chunk := range refs {
+		if hash != chunk.Hash {
+			t.Errorf("Chunk %s referenced as %s", chunk.Hash, hash)
+		}
+		size += uint64(chunk.Size)
+	}
+	if size != snapshot.Stats.StorageSize {
+		t.Errorf("Expected referenced chunks to sum up to %d bytes, got %d", snapshot.Stats.StorageSize, size)
+	}
+}
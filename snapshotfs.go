@@ -0,0 +1,242 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxSymLinks is the maximum amount of symlinks followed when opening a file
+const maxSymLinks = 40
+
+// snapshotFS serves the archives of a snapshot via http.FileSystem
+type snapshotFS struct {
+	repository Repository
+	archives   map[string]*Archive        // by slash-separated, absolute path
+	children   map[string]map[string]bool // names of the items in a directory
+}
+
+// SnapshotFS returns a read-only http.FileSystem serving the content of a
+// snapshot straight from the repository. Parent directories which aren't part
+// of the snapshot get listed nonetheless, so every archive can be reached from
+// the root
+func SnapshotFS(repository Repository, snapshot *Snapshot) http.FileSystem {
+	fs := &snapshotFS{
+		repository: repository,
+		archives:   make(map[string]*Archive),
+		children:   map[string]map[string]bool{"/": {}},
+	}
+
+	for _, arc := range snapshot.Archives {
+		p := cleanArchivePath(arc.Path)
+		fs.archives[p] = arc
+
+		for p != "/" {
+			dir := path.Dir(p)
+			if fs.children[dir] == nil {
+				fs.children[dir] = make(map[string]bool)
+			}
+			fs.children[dir][path.Base(p)] = true
+			p = dir
+		}
+	}
+
+	return fs
+}
+
+// cleanArchivePath converts the path of an archive to a slash-separated,
+// absolute path
+func cleanArchivePath(p string) string {
+	return path.Clean("/" + filepath.ToSlash(p))
+}
+
+// Open opens the file or directory name
+func (fs *snapshotFS) Open(name string) (http.File, error) {
+	p := cleanArchivePath(name)
+	info, err := fs.stat(p)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	info.name = path.Base(p)
+
+	f := &snapshotFile{fs: fs, path: p, info: info}
+	if !info.IsDir() {
+		f.reader, err = NewArchiveReader(fs.repository, *info.arc)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	return f, nil
+}
+
+// stat returns the file info for path p, following symlinks and resolving
+// hardlinks
+func (fs *snapshotFS) stat(p string) (archiveInfo, error) {
+	for i := 0; i < maxSymLinks; i++ {
+		arc, ok := fs.archives[p]
+		if !ok {
+			if _, ok := fs.children[p]; ok {
+				// a parent directory which isn't part of the snapshot
+				return archiveInfo{name: path.Base(p), arc: &Archive{Type: Directory, Mode: os.ModeDir | 0755}}, nil
+			}
+			return archiveInfo{}, os.ErrNotExist
+		}
+
+		switch arc.Type {
+		case SymLink:
+			target := filepath.ToSlash(arc.PointsTo)
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(p), target)
+			}
+			p = cleanArchivePath(target)
+			continue
+		case File:
+			if arc.LinkTarget != "" {
+				// hardlinks share the data of another archive
+				target, ok := fs.archives[cleanArchivePath(arc.LinkTarget)]
+				if !ok {
+					return archiveInfo{}, os.ErrNotExist
+				}
+				arc = target
+			}
+		}
+
+		return archiveInfo{name: path.Base(p), arc: arc}, nil
+	}
+
+	return archiveInfo{}, os.ErrInvalid
+}
+
+// snapshotFile implements http.File for a single archive
+type snapshotFile struct {
+	fs     *snapshotFS
+	path   string
+	info   archiveInfo
+	reader *ArchiveReader // nil for directories
+	dirPos int            // amount of directory entries already read
+}
+
+// Read reads the file's content
+func (f *snapshotFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		return 0, &os.PathError{Op: "read", Path: f.path, Err: ErrNotAFile}
+	}
+	return f.reader.Read(p)
+}
+
+// Seek sets the position for the next Read
+func (f *snapshotFile) Seek(offset int64, whence int) (int64, error) {
+	if f.reader == nil {
+		return 0, &os.PathError{Op: "seek", Path: f.path, Err: ErrNotAFile}
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+// Close closes the file
+func (f *snapshotFile) Close() error {
+	if f.reader == nil {
+		return nil
+	}
+	return f.reader.Close()
+}
+
+// Readdir returns the next count entries of a directory, sorted by name. If
+// count is <= 0, all remaining entries get returned
+func (f *snapshotFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.path, Err: ErrNotAFile}
+	}
+
+	var names []string
+	for name := range f.fs.children[f.path] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = names[f.dirPos:]
+
+	if count > 0 {
+		if len(names) == 0 {
+			return nil, io.EOF
+		}
+		if len(names) > count {
+			names = names[:count]
+		}
+	}
+	f.dirPos += len(names)
+
+	infos := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		p := path.Join(f.path, name)
+		info, err := f.fs.stat(p)
+		if err != nil {
+			// e.g. a dangling symlink
+			info = archiveInfo{arc: f.fs.archives[p]}
+		}
+		info.name = name
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// Stat returns the file info
+func (f *snapshotFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+// archiveInfo implements os.FileInfo for an archive
+type archiveInfo struct {
+	name string
+	arc  *Archive
+}
+
+// Name returns the base name of the file
+func (fi archiveInfo) Name() string {
+	return fi.name
+}
+
+// Size returns the length of the file in bytes
+func (fi archiveInfo) Size() int64 {
+	if fi.arc.Type != File {
+		return 0
+	}
+	return int64(fi.arc.Size)
+}
+
+// Mode returns the file mode bits
+func (fi archiveInfo) Mode() os.FileMode {
+	switch fi.arc.Type {
+	case Directory:
+		return fi.arc.Mode | os.ModeDir
+	case SymLink:
+		return fi.arc.Mode | os.ModeSymlink
+	}
+	return fi.arc.Mode
+}
+
+// ModTime returns the modification time
+func (fi archiveInfo) ModTime() time.Time {
+	return time.Unix(fi.arc.ModTime, 0)
+}
+
+// IsDir returns true for directories
+func (fi archiveInfo) IsDir() bool {
+	return fi.arc.Type == Directory
+}
+
+// Sys returns the underlying archive
+func (fi archiveInfo) Sys() interface{} {
+	return fi.arc
+}
@@ -0,0 +1,90 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err = os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	data := writeRandomFile(t, filepath.Join(src, "random"), 3*preferredChunkSize)
+	nested := writeRandomFile(t, filepath.Join(src, "sub", "nested"), 1024)
+	if err = os.Symlink("random", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("Failed creating symlink: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	server := http.FileServer(SnapshotFS(r, snapshot))
+	base := filepath.ToSlash(src)
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		path string
+		data []byte
+	}{
+		{base + "/random", data},
+		{base + "/sub/nested", nested},
+		{base + "/link", data},
+	}
+	for _, tt := range tests {
+		rec := get(tt.path, nil)
+		if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), tt.data) {
+			t.Errorf("Expected %s to be served, got status %d and %d bytes", tt.path, rec.Code, rec.Body.Len())
+		}
+	}
+
+	// range requests seek within the archive
+	rec := get(base+"/random", http.Header{"Range": {"bytes=2000000-2000099"}})
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), data[2000000:2000100]) {
+		t.Errorf("Expected partial content, got status %d and %d bytes", rec.Code, rec.Body.Len())
+	}
+
+	rec = get(base+"/", nil)
+	for _, name := range []string{"random", "link", "sub/"} {
+		if !strings.Contains(rec.Body.String(), ">"+name+"<") {
+			t.Errorf("Expected directory listing to contain %s, got %s", name, rec.Body.String())
+		}
+	}
+
+	// parent directories which aren't part of the snapshot are browsable
+	parent := filepath.ToSlash(filepath.Dir(src))
+	rec = get(parent+"/", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), ">src/<") {
+		t.Errorf("Expected parent directory listing, got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec = get(base+"/missing", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing file, got %d", http.StatusNotFound, rec.Code)
+	}
+}
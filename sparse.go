@@ -0,0 +1,80 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"io"
+	"os"
+)
+
+// sparseBlockSize is the granularity in which zero runs get detected
+const sparseBlockSize = 4096
+
+// sparseWriter writes to a file, but seeks over blocks containing only zeros
+// instead of writing them, so they end up as holes in the file
+type sparseWriter struct {
+	f      *os.File
+	offset int64
+}
+
+// Write writes b to the file, skipping blocks of zeros
+func (w *sparseWriter) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		// keep blocks aligned to the file offset
+		l := sparseBlockSize - int(w.offset%sparseBlockSize)
+		if l > len(b) {
+			l = len(b)
+		}
+
+		// gather consecutive blocks which either all contain data or are all
+		// zero, so they can be handled in one go
+		zero := isZero(b[:l])
+		for l < len(b) {
+			next := l + sparseBlockSize
+			if next > len(b) {
+				next = len(b)
+			}
+			if isZero(b[l:next]) != zero {
+				break
+			}
+			l = next
+		}
+
+		var err error
+		if zero {
+			_, err = w.f.Seek(int64(l), io.SeekCurrent)
+		} else {
+			_, err = w.f.Write(b[:l])
+		}
+		if err != nil {
+			return n, err
+		}
+
+		n += l
+		w.offset += int64(l)
+		b = b[l:]
+	}
+
+	return n, nil
+}
+
+// Truncate sets the file's size to the amount of bytes written. This is
+// required when the file ends with a hole
+func (w *sparseWriter) Truncate() error {
+	return w.f.Truncate(w.offset)
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+// +build linux
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"os"
+	"syscall"
+)
+
+// magic numbers of filesystems which can't store holes and would write out
+// the zeros instead
+var denseFilesystems = map[int64]bool{
+	0x4d44:     true, // msdos, vfat
+	0x2011bab0: true, // exfat
+	0x5346544e: true, // ntfs via ntfs-3g, which doesn't create holes by seeking
+	0x9660:     true, // isofs
+}
+
+// supportsSparse returns true if holes can be created in f by seeking past
+// blocks of zeros
+func supportsSparse(f *os.File) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Fstatfs(int(f.Fd()), &st); err != nil {
+		return false
+	}
+	return !denseFilesystems[int64(st.Type)]
+}
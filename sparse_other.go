@@ -0,0 +1,19 @@
+// +build !linux,!windows
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import "os"
+
+// supportsSparse returns true if holes can be created in f by seeking past
+// blocks of zeros. We can't tell on this platform, but seeking still results
+// in an identical file where holes aren't supported
+func supportsSparse(f *os.File) bool {
+	return true
+}
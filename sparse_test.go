@@ -0,0 +1,124 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sparseTestData returns data with runs of zeros between random blocks
+func sparseTestData() []byte {
+	var b []byte
+	for _, size := range []int{100, 3 * sparseBlockSize, 5000, 10 * sparseBlockSize, 1, sparseBlockSize + 7} {
+		b = append(b, make([]byte, size)...)
+		r := make([]byte, 123)
+		_, _ = rand.Read(r)
+		b = append(b, r...)
+	}
+
+	// end with a hole
+	return append(b, make([]byte, 4*sparseBlockSize)...)
+}
+
+func TestSparseWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := sparseTestData()
+	path := filepath.Join(dir, "sparse")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed creating file: %s", err)
+	}
+
+	w := &sparseWriter{f: f}
+	// write in uneven pieces, so blocks span multiple writes
+	for b := data; len(b) > 0; {
+		l := 3000
+		if l > len(b) {
+			l = len(b)
+		}
+		n, err := w.Write(b[:l])
+		if err != nil || n != l {
+			t.Fatalf("Failed writing sparse data: %d bytes, %v", n, err)
+		}
+		b = b[l:]
+	}
+	err = w.Truncate()
+	if err != nil {
+		t.Fatalf("Failed truncating sparse file: %s", err)
+	}
+	f.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading sparse file: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("Data mismatch after sparse write: got %d bytes, expected %d", len(b), len(data))
+	}
+}
+
+func TestDecodeArchiveSparse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// mostly zeros, like a disk image
+	data := make([]byte, 8*preferredChunkSize)
+	_, _ = rand.Read(data[preferredChunkSize : preferredChunkSize+1000])
+	src := filepath.Join(dir, "image")
+	err = ioutil.WriteFile(src, data, 0644)
+	if err != nil {
+		t.Fatalf("Failed writing test file: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	opts := DefaultRestoreOptions()
+	opts.Sparse = true
+	path := filepath.Join(targetdir, "image")
+
+	progress := make(chan Progress)
+	go func() {
+		for range progress {
+		}
+	}()
+	err = DecodeArchive(progress, r, *snapshot.Archives[src], path, opts)
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading restored file: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after sparse restore")
+	}
+	if usage := diskUsage(t, path); usage >= int64(len(data))/2 {
+		t.Errorf("Expected sparse file, but %d bytes are allocated for %d bytes of data", usage, len(data))
+	}
+}
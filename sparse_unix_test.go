@@ -0,0 +1,26 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"syscall"
+	"testing"
+)
+
+// diskUsage returns the amount of bytes allocated for a file
+func diskUsage(t *testing.T, path string) int64 {
+	var st syscall.Stat_t
+	err := syscall.Stat(path, &st)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %s", path, err)
+	}
+
+	return int64(st.Blocks) * 512
+}
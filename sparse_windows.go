@@ -0,0 +1,26 @@
+// +build windows
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"os"
+	"syscall"
+)
+
+const fsctlSetSparse = 0x000900c4
+
+// supportsSparse marks f as a sparse file, which is required on Windows for
+// holes to be created by seeking. It returns false if the filesystem doesn't
+// support sparse files
+func supportsSparse(f *os.File) bool {
+	var n uint32
+	err := syscall.DeviceIoControl(syscall.Handle(f.Fd()), fsctlSetSparse, nil, 0, nil, 0, &n, nil)
+	return err == nil
+}
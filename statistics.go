@@ -19,7 +19,15 @@ type Stats struct {
 	Size        uint64 `json:"size"`
 	StorageSize uint64 `json:"stored_size"`
 	Transferred uint64 `json:"transferred"`
+	Chunks      uint64 `json:"chunks"`
 	Errors      uint64 `json:"errors"`
+
+	Reconstructed uint64 `json:"reconstructed"` // chunks restored from incomplete parts
+	CachedChunks  uint64 `json:"cached_chunks"` // chunks served from the chunk cache
+	CachedSize    uint64 `json:"cached_size"`   // stored bytes that didn't have to be loaded again
+	DedupChunks   uint64 `json:"dedup_chunks"`  // chunks occurring again after their first occurrence
+	DedupSize     uint64 `json:"dedup_size"`    // bytes of data deduplication saved storing
+	Skipped       uint64 `json:"skipped"`       // items left out by filters
 }
 
 // Add accumulates other into s
@@ -30,7 +38,14 @@ func (s *Stats) Add(other Stats) {
 	s.Size += other.Size
 	s.StorageSize += other.StorageSize
 	s.Transferred += other.Transferred
+	s.Chunks += other.Chunks
 	s.Errors += other.Errors
+	s.Reconstructed += other.Reconstructed
+	s.CachedChunks += other.CachedChunks
+	s.CachedSize += other.CachedSize
+	s.DedupChunks += other.DedupChunks
+	s.DedupSize += other.DedupSize
+	s.Skipped += other.Skipped
 }
 
 // SizeToString prettifies sizes
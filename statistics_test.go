@@ -20,7 +20,11 @@ func TestStatisticsAdd(t *testing.T) {
 			Size:        i,
 			StorageSize: i,
 			Transferred: i,
+			Chunks:      i,
 			Errors:      i,
+			DedupChunks: i,
+			DedupSize:   i,
+			Skipped:     i,
 		}
 
 		s = append(s, v)
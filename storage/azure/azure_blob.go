@@ -0,0 +1,255 @@
+/*
+ * knoxite
+ *     Copyright (c) 2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package azure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/knoxite/knoxite"
+)
+
+const (
+	// AccountKeyEnv is the environment variable which can contain the
+	// storage account's access key
+	AccountKeyEnv = "AZURE_STORAGE_KEY"
+	// SASTokenEnv is the environment variable which can contain a shared
+	// access signature granting access to the container
+	SASTokenEnv = "AZURE_STORAGE_SAS_TOKEN"
+)
+
+// AzureBlobStorage stores data as block blobs in an Azure Blob Storage
+// container
+type AzureBlobStorage struct {
+	knoxite.StorageFilesystem
+	url       url.URL
+	container azblob.ContainerURL
+}
+
+func init() {
+	knoxite.RegisterStorageBackend(&AzureBlobStorage{})
+}
+
+// NewBackend returns an AzureBlobStorage backend for URLs like
+// azure://[:accountkey@]account/container/prefix. Without an account key,
+// either in the URL or the environment variable AZURE_STORAGE_KEY, a SAS token
+// is required. It can be passed as the URL's query or via the environment
+// variable AZURE_STORAGE_SAS_TOKEN
+func (*AzureBlobStorage) NewBackend(u url.URL) (knoxite.Backend, error) {
+	account := u.Hostname()
+	pp := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if account == "" || pp[0] == "" {
+		return &AzureBlobStorage{}, knoxite.ErrInvalidRepositoryURL
+	}
+	container := pp[0]
+	var prefix string
+	if len(pp) > 1 {
+		prefix = strings.Trim(pp[1], "/")
+	}
+
+	endpoint, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s", account, container))
+	if err != nil {
+		return &AzureBlobStorage{}, knoxite.ErrInvalidRepositoryURL
+	}
+
+	var key string
+	if u.User != nil {
+		key, _ = u.User.Password()
+	}
+	if key == "" {
+		key = os.Getenv(AccountKeyEnv)
+	}
+
+	var credential azblob.Credential
+	if key != "" {
+		credential, err = azblob.NewSharedKeyCredential(account, key)
+		if err != nil {
+			return &AzureBlobStorage{}, err
+		}
+	} else {
+		sas := u.RawQuery
+		if sas == "" {
+			sas = strings.TrimPrefix(os.Getenv(SASTokenEnv), "?")
+		}
+		if sas == "" {
+			return &AzureBlobStorage{}, knoxite.ErrInvalidPassword
+		}
+		endpoint.RawQuery = sas
+		credential = azblob.NewAnonymousCredential()
+	}
+
+	// Azure throttles requests by responding with 503 (Server Busy), which
+	// the pipeline retries with an exponential backoff
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{
+		Retry: azblob.RetryOptions{
+			Policy:        azblob.RetryPolicyExponential,
+			MaxTries:      8,
+			RetryDelay:    500 * time.Millisecond,
+			MaxRetryDelay: 30 * time.Second,
+		},
+	})
+
+	backend := AzureBlobStorage{
+		url:       u,
+		container: azblob.NewContainerURL(*endpoint, pipeline),
+	}
+
+	// make sure the container exists and we can access it
+	_, err = backend.container.GetProperties(context.Background(), azblob.LeaseAccessConditions{})
+	if err != nil {
+		return &AzureBlobStorage{}, err
+	}
+
+	fs, err := knoxite.NewStorageFilesystem(prefix, &backend)
+	if err != nil {
+		return &AzureBlobStorage{}, err
+	}
+	backend.StorageFilesystem = fs
+
+	return &backend, nil
+}
+
+// pathError converts missing blobs to errors os.IsNotExist recognizes, so
+// missing chunk parts don't get retried
+func pathError(op, p string, err error) error {
+	if serr, ok := err.(azblob.StorageError); ok {
+		if serr.ServiceCode() == azblob.ServiceCodeBlobNotFound ||
+			(serr.Response() != nil && serr.Response().StatusCode == http.StatusNotFound) {
+			return &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+		}
+	}
+	return err
+}
+
+// Location returns the type and location of the repository
+func (backend *AzureBlobStorage) Location() string {
+	return backend.url.String()
+}
+
+// Close the backend
+func (backend *AzureBlobStorage) Close() error {
+	return nil
+}
+
+// Protocols returns the Protocol Schemes supported by this backend
+func (backend *AzureBlobStorage) Protocols() []string {
+	return []string{"azure"}
+}
+
+// Description returns a user-friendly description for this backend
+func (backend *AzureBlobStorage) Description() string {
+	return "Azure blob storage"
+}
+
+// AvailableSpace returns the free space on this backend
+func (backend *AzureBlobStorage) AvailableSpace() (uint64, error) {
+	// blob containers don't have a quota, so we return 0
+	return 0, nil
+}
+
+// ListChunks returns all chunk parts stored in the container
+func (backend *AzureBlobStorage) ListChunks() ([]knoxite.StoredChunk, error) {
+	var chunks []knoxite.StoredChunk
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := backend.container.ListBlobsFlatSegment(context.Background(), marker, azblob.ListBlobsSegmentOptions{
+			Prefix: backend.ChunkPath() + "/",
+		})
+		if err != nil {
+			return nil, err
+		}
+		marker = resp.NextMarker
+
+		for _, blob := range resp.Segment.BlobItems {
+			shasum, part, totalParts, ok := knoxite.ParseChunkFilename(path.Base(blob.Name))
+			if !ok {
+				// e.g. the chunk-index
+				continue
+			}
+
+			var size uint64
+			if blob.Properties.ContentLength != nil {
+				size = uint64(*blob.Properties.ContentLength)
+			}
+			chunks = append(chunks, knoxite.StoredChunk{
+				Hash:       shasum,
+				Part:       part,
+				TotalParts: totalParts,
+				Size:       size,
+				ModTime:    blob.Properties.LastModified,
+			})
+		}
+	}
+
+	return chunks, nil
+}
+
+// CreatePath is not needed for blobs, since they don't live in directories
+func (backend *AzureBlobStorage) CreatePath(p string) error {
+	return nil
+}
+
+// Stat returns the size of a file
+func (backend *AzureBlobStorage) Stat(p string) (uint64, error) {
+	props, err := backend.container.NewBlobURL(p).GetProperties(context.Background(), azblob.BlobAccessConditions{})
+	if err != nil {
+		return 0, pathError("stat", p, err)
+	}
+
+	return uint64(props.ContentLength()), nil
+}
+
+// ReadFile reads a file from Azure blob storage
+func (backend *AzureBlobStorage) ReadFile(p string) ([]byte, error) {
+	blob := backend.container.NewBlobURL(p)
+	resp, err := blob.Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return nil, pathError("read", p, err)
+	}
+
+	body := resp.Body(azblob.RetryReaderOptions{MaxRetryRequests: 3})
+	defer body.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFile writes a file on Azure blob storage. Data exceeding the limit of
+// a single upload gets staged in blocks, which are committed afterwards
+func (backend *AzureBlobStorage) WriteFile(p string, data []byte) (size uint64, err error) {
+	blob := backend.container.NewBlockBlobURL(p)
+	_, err = azblob.UploadBufferToBlockBlob(context.Background(), data, blob, azblob.UploadToBlockBlobOptions{
+		BlockSize:   azblob.BlockBlobMaxStageBlockBytes,
+		Parallelism: 4,
+		Metadata: azblob.Metadata{
+			"createdby": "knoxite",
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(len(data)), nil
+}
+
+// DeleteFile deletes a file from Azure blob storage
+func (backend *AzureBlobStorage) DeleteFile(p string) error {
+	_, err := backend.container.NewBlobURL(p).Delete(context.Background(), azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	return pathError("delete", p, err)
+}
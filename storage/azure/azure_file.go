@@ -10,7 +10,9 @@ package azure
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"strings"
 
@@ -136,6 +138,18 @@ func (backend *AzureFileStorage) CreatePath(p string) error {
 	return nil
 }
 
+// fileError converts missing files to errors os.IsNotExist recognizes, so
+// missing chunk parts don't get retried
+func fileError(op, p string, err error) error {
+	if serr, ok := err.(azfile.StorageError); ok {
+		if serr.ServiceCode() == azfile.ServiceCodeResourceNotFound ||
+			(serr.Response() != nil && serr.Response().StatusCode == http.StatusNotFound) {
+			return &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+		}
+	}
+	return err
+}
+
 // Stat returns the size of a file
 func (backend *AzureFileStorage) Stat(p string) (uint64, error) {
 	u := backend.endpoint
@@ -145,7 +159,7 @@ func (backend *AzureFileStorage) Stat(p string) (uint64, error) {
 	fileUrl := azfile.NewFileURL(u, azfile.NewPipeline(&backend.credential, azfile.PipelineOptions{}))
 	props, err := fileUrl.GetProperties(context.Background())
 	if err != nil {
-		return 0, err
+		return 0, fileError("stat", p, err)
 	}
 
 	return uint64(props.ContentLength()), nil
@@ -10,8 +10,12 @@ package backblaze
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"io/ioutil"
+	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 
@@ -55,7 +59,11 @@ func (*BackblazeStorage) NewBackend(URL url.URL) (knoxite.Backend, error) {
 
 	// Creating the Bucket prefixes
 	bucketPrefix := strings.Split(URL.Path, "/")
-	if len(bucketPrefix) != 2 {
+	if URL.Scheme == "b2" && len(URL.Path) == 0 {
+		// b2://keyID:appKey@bucket
+		bucketPrefix = []string{"", URL.Host}
+	}
+	if len(bucketPrefix) != 2 || len(bucketPrefix[1]) == 0 {
 		return &BackblazeStorage{}, knoxite.ErrInvalidRepositoryURL
 	}
 
@@ -92,7 +100,7 @@ func (backend *BackblazeStorage) Close() error {
 
 // Protocols returns the Protocol Schemes supported by this backend
 func (backend *BackblazeStorage) Protocols() []string {
-	return []string{"backblaze"}
+	return []string{"backblaze", "b2"}
 }
 
 // Description returns a user-friendly description for this backend
@@ -110,6 +118,10 @@ func (backend *BackblazeStorage) AvailableSpace() (uint64, error) {
 func (backend *BackblazeStorage) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
 	fileName := shasum + "." + strconv.FormatUint(uint64(part), 10) + "_" + strconv.FormatUint(uint64(totalParts), 10)
 	_, obj, err := backend.Bucket.DownloadFileByName(fileName)
+	if b2err, ok := err.(*backblaze.B2Error); ok && b2err.Status == http.StatusNotFound {
+		// missing chunk parts won't be retried
+		return nil, &os.PathError{Op: "load", Path: fileName, Err: os.ErrNotExist}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -129,9 +141,7 @@ func (backend *BackblazeStorage) StoreChunk(shasum string, part, totalParts uint
 		}
 	}
 
-	buf := bytes.NewBuffer(data)
-	metadata := make(map[string]string)
-	file, err := backend.Bucket.UploadFile(fileName, metadata, buf)
+	file, err := backend.uploadFile(fileName, data)
 	if err != nil {
 		return 0, err
 	}
@@ -167,9 +177,7 @@ func (backend *BackblazeStorage) LoadSnapshot(id string) ([]byte, error) {
 
 // SaveSnapshot stores a snapshot
 func (backend *BackblazeStorage) SaveSnapshot(id string, data []byte) error {
-	buf := bytes.NewBuffer(data)
-	metadata := make(map[string]string)
-	_, err := backend.Bucket.UploadFile("snapshot-"+id, metadata, buf)
+	_, err := backend.uploadFile("snapshot-"+id, data)
 	return err
 }
 
@@ -186,21 +194,14 @@ func (backend *BackblazeStorage) LoadChunkIndex() ([]byte, error) {
 
 // SaveChunkIndex stores the chunk-index
 func (backend *BackblazeStorage) SaveChunkIndex(data []byte) error {
-	buf := bytes.NewBuffer(data)
-	metadata := make(map[string]string)
-	_, err := backend.Bucket.UploadFile(backend.chunkIndexFile, metadata, buf)
+	_, err := backend.uploadFile(backend.chunkIndexFile, data)
 	return err
 }
 
 // InitRepository creates a new repository
 func (backend *BackblazeStorage) InitRepository() error {
-	var placeholder []byte
-	buf := bytes.NewBuffer(placeholder)
-
 	// Creating the files on backblaze
-	metadata := make(map[string]string)
-
-	if _, err := backend.Bucket.UploadFile(backend.repositoryFile, metadata, buf); err != nil {
+	if _, err := backend.uploadFile(backend.repositoryFile, []byte{}); err != nil {
 		return err
 	}
 	return nil
@@ -227,12 +228,26 @@ func (backend *BackblazeStorage) LoadRepository() ([]byte, error) {
 
 // SaveRepository stores the metadata for a repository
 func (backend *BackblazeStorage) SaveRepository(data []byte) error {
-	buf := bytes.NewBuffer(data)
-	metadata := make(map[string]string)
-	_, err := backend.Bucket.UploadFile(backend.repositoryFile, metadata, buf)
+	_, err := backend.uploadFile(backend.repositoryFile, data)
 	return err
 }
 
+// uploadFile uploads data to the bucket. Upload URLs and their tokens expire,
+// so recoverable errors get retried once, which requests a fresh upload URL
+func (backend *BackblazeStorage) uploadFile(fileName string, data []byte) (*backblaze.File, error) {
+	hash := sha1.Sum(data)
+	sha1Hash := hex.EncodeToString(hash[:])
+	metadata := make(map[string]string)
+
+	file, err := backend.Bucket.UploadHashedFile(fileName, metadata, bytes.NewReader(data), sha1Hash, int64(len(data)))
+	if b2err, ok := err.(*backblaze.B2Error); ok && !b2err.IsFatal() {
+		// the reader has been consumed by the failed attempt, start over
+		file, err = backend.Bucket.UploadHashedFile(fileName, metadata, bytes.NewReader(data), sha1Hash, int64(len(data)))
+	}
+
+	return file, err
+}
+
 func (backend *BackblazeStorage) findLatestFileVersion(fileName string) ([]backblaze.FileStatus, error) {
 	var files []backblaze.FileStatus
 
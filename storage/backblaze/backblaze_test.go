@@ -31,7 +31,7 @@ func TestMain(m *testing.M) {
 
 	backendTest = &storage.BackendTest{
 		URL:         backblazeurl + rnd,
-		Protocols:   []string{"backblaze"},
+		Protocols:   []string{"backblaze", "b2"},
 		Description: "Backblaze Storage",
 		TearDown: func(tb *storage.BackendTest) {
 			db := tb.Backend.(*BackblazeStorage)
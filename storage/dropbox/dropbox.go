@@ -12,6 +12,8 @@ import (
 	"bytes"
 	"io/ioutil"
 	"net/url"
+	"os"
+	"strings"
 
 	"github.com/tj/go-dropbox"
 	"github.com/tj/go-dropy"
@@ -86,11 +88,20 @@ func (backend *DropboxStorage) CreatePath(path string) error {
 	return backend.dropy.Mkdir(path)
 }
 
+// pathError converts Dropbox's errors for missing files to errors
+// os.IsNotExist recognizes
+func pathError(op, path string, err error) error {
+	if derr, ok := err.(*dropbox.Error); ok && strings.HasPrefix(derr.Summary, "path/not_found/") {
+		return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	}
+	return err
+}
+
 // Stat returns the size of a file
 func (backend *DropboxStorage) Stat(path string) (uint64, error) {
 	fileinfo, err := backend.dropy.Stat(path)
 	if err != nil {
-		return 0, err
+		return 0, pathError("stat", path, err)
 	}
 	return uint64(fileinfo.Size()), nil
 }
@@ -99,7 +110,7 @@ func (backend *DropboxStorage) Stat(path string) (uint64, error) {
 func (backend *DropboxStorage) ReadFile(path string) ([]byte, error) {
 	file, err := backend.dropy.Download(path)
 	if err != nil {
-		return nil, err
+		return nil, pathError("read", path, err)
 	}
 	defer file.Close()
 	return ioutil.ReadAll(file)
@@ -11,10 +11,11 @@ package ftp
 import (
 	"bytes"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net"
+	"net/textproto"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -126,17 +127,42 @@ func (backend *FTPStorage) CreatePath(path string) error {
 	return nil
 }
 
+// pathError converts the FTP replies for unavailable files to errors
+// os.IsNotExist recognizes
+func pathError(op, path string, err error) error {
+	if terr, ok := err.(*textproto.Error); ok && terr.Code == ftp.StatusFileUnavailable {
+		return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	}
+	return err
+}
+
 // Stat returns the size of a file on ftp
 func (backend *FTPStorage) Stat(path string) (uint64, error) {
 	size, err := backend.ftp.FileSize(path)
-	return uint64(size), err
+	return uint64(size), pathError("stat", path, err)
+}
+
+// ListFiles returns the names of all files stored in a directory on ftp
+func (backend *FTPStorage) ListFiles(path string) ([]string, error) {
+	list, err := backend.ftp.List(path)
+	if err != nil {
+		return nil, pathError("list", path, err)
+	}
+
+	var names []string
+	for _, l := range list {
+		if l.Type == ftp.EntryTypeFile {
+			names = append(names, l.Name)
+		}
+	}
+	return names, nil
 }
 
 // ReadFile reads a file from ftp
 func (backend *FTPStorage) ReadFile(path string) ([]byte, error) {
 	file, err := backend.ftp.Retr(path)
 	if err != nil {
-		return nil, err
+		return nil, pathError("read", path, err)
 	}
 	defer file.Close()
 
@@ -156,7 +182,7 @@ func (backend *FTPStorage) DeleteFile(path string) error {
 
 // DeletePath deletes a directory including all its content from ftp
 func (backend *FTPStorage) DeletePath(path string) error {
-	fmt.Println("Deleting path", path)
+	knoxite.Log().Debugf("Deleting path %s", path)
 	list, err := backend.ftp.List("")
 	if err != nil {
 		return err
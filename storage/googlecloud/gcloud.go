@@ -10,18 +10,34 @@ package googlecloud
 
 import (
 	"context"
-	"errors"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
 	"github.com/knoxite/knoxite"
 )
 
+const (
+	// CredentialsJSONEnv is the environment variable which can contain the
+	// service account credentials as inline JSON
+	CredentialsJSONEnv = "KNOXITE_GCS_CREDENTIALS_JSON"
+
+	// maxAttempts is how often rate limited requests get attempted
+	maxAttempts = 8
+	// initialBackoff is the delay before retrying a rate limited request,
+	// doubled for every further retry
+	initialBackoff = 250 * time.Millisecond
+)
+
 // GoogleCloudStorage stores data in a Google Cloud Storage bucket
 type GoogleCloudStorage struct {
 	knoxite.StorageFilesystem
@@ -34,56 +50,57 @@ func init() {
 	knoxite.RegisterStorageBackend(&GoogleCloudStorage{})
 }
 
-// NewBackend returns a GoogleCloudStorage backend
-// to create a storage client we need either the path to a credential JSON file set via the environment variable GOOGLE_APPLICATION_CREDENTIALS="[PATH]"
-// or the path to the JSON file passed via the user parameter of the URL scheme
+// NewBackend returns a GoogleCloudStorage backend for URLs like
+// gs://[credentials@]bucket/prefix or
+// googlecloudstorage://[credentials@]/bucket/folder.
+// The credentials are the path to a service account's JSON file. If the URL
+// doesn't contain any, the JSON found in the environment variable
+// KNOXITE_GCS_CREDENTIALS_JSON gets used. Otherwise the application default
+// credentials apply, i.e. the file GOOGLE_APPLICATION_CREDENTIALS points to
+// or the workload identity when running on Google Cloud
 func (*GoogleCloudStorage) NewBackend(URL url.URL) (knoxite.Backend, error) {
-	var credentialsPath string
-
-	// check if path to the credentials file was passed via URL scheme
-	if URL.User == nil || URL.User.Username() == "" {
-		// if not, we check if the path to the credentials file is provided via environment variable
-		var credentialsSet bool
-		credentialsPath, credentialsSet = os.LookupEnv("GOOGLE_APPLICATION_CREDENTIALS")
-		if !credentialsSet {
-			return &GoogleCloudStorage{}, errors.New("No valid JSON credentials file provided.")
-		}
-	} else {
-		credentialsPath = URL.User.Username()
-	}
-
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx, option.WithCredentialsFile(credentialsPath))
+	bucketName, folderPath, err := parseURL(URL)
 	if err != nil {
 		return &GoogleCloudStorage{}, err
 	}
 
-	slicedPath := strings.Split(URL.Path, "/")
-	var folderPath string
-	if len(slicedPath) > 2 {
-		folderPath = strings.Join(slicedPath[2:], "/")
-	} else {
-		return &GoogleCloudStorage{}, knoxite.ErrInvalidRepositoryURL
+	var opts []option.ClientOption
+	if URL.User != nil && URL.User.Username() != "" {
+		opts = append(opts, option.WithCredentialsFile(URL.User.Username()))
+	} else if credentials, ok := os.LookupEnv(CredentialsJSONEnv); ok {
+		opts = append(opts, option.WithCredentialsJSON([]byte(credentials)))
 	}
 
-	// we can have a bucket handle even if the bucket doesn't exist yet, so we check if we can access bucket attributes
-	bucket := client.Bucket(slicedPath[1])
-	_, err = bucket.Attrs(ctx)
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, opts...)
 	if err != nil {
 		return &GoogleCloudStorage{}, err
 	}
 
-	// we can have an object handle even if the object doesn't exist yet, so we check if we can access object attributes
-	folder := bucket.Object(folderPath)
-	_, err = folder.Attrs(ctx)
+	backend := GoogleCloudStorage{
+		url:    URL,
+		client: *client,
+		bucket: *client.Bucket(bucketName),
+	}
+
+	// we can have a bucket handle even if the bucket doesn't exist yet, so we check if we can access bucket attributes
+	err = backend.retry(func() error {
+		_, err := backend.bucket.Attrs(ctx)
+		return err
+	})
 	if err != nil {
 		return &GoogleCloudStorage{}, err
 	}
 
-	backend := GoogleCloudStorage{
-		url:    URL,
-		client: *client,
-		bucket: *bucket,
+	if URL.Scheme != "gs" {
+		// we can have an object handle even if the object doesn't exist yet, so we check if we can access object attributes
+		err = backend.retry(func() error {
+			_, err := backend.bucket.Object(folderPath).Attrs(ctx)
+			return err
+		})
+		if err != nil {
+			return &GoogleCloudStorage{}, err
+		}
 	}
 
 	fs, err := knoxite.NewStorageFilesystem(folderPath, &backend)
@@ -95,6 +112,51 @@ func (*GoogleCloudStorage) NewBackend(URL url.URL) (knoxite.Backend, error) {
 	return &backend, nil
 }
 
+// parseURL returns the bucket and the folder the repository is stored in
+func parseURL(URL url.URL) (bucket string, folder string, err error) {
+	if URL.Scheme == "gs" {
+		if URL.Host == "" {
+			return "", "", knoxite.ErrInvalidRepositoryURL
+		}
+		return URL.Host, strings.Trim(URL.Path, "/"), nil
+	}
+
+	slicedPath := strings.Split(URL.Path, "/")
+	if len(slicedPath) <= 2 {
+		return "", "", knoxite.ErrInvalidRepositoryURL
+	}
+	return slicedPath[1], strings.Join(slicedPath[2:], "/"), nil
+}
+
+// isRateLimited returns true if Google Cloud Storage asked us to slow down
+func isRateLimited(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	return ok && (gerr.Code == http.StatusTooManyRequests || gerr.Code == http.StatusServiceUnavailable)
+}
+
+// retry calls f until it succeeds or fails for another reason than rate
+// limiting, backing off exponentially
+func (backend *GoogleCloudStorage) retry(f func() error) error {
+	delay := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if !isRateLimited(err) || attempt >= maxAttempts {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// pathError converts missing objects to errors os.IsNotExist recognizes
+func pathError(op, path string, err error) error {
+	if err == storage.ErrObjectNotExist {
+		return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	}
+	return err
+}
+
 // Location returns the type and location of the repository
 func (backend *GoogleCloudStorage) Location() string {
 	return backend.url.String()
@@ -107,7 +169,7 @@ func (backend *GoogleCloudStorage) Close() error {
 
 // Protocols returns the Protocol Schemes supported by this backend
 func (backend *GoogleCloudStorage) Protocols() []string {
-	return []string{"googlecloudstorage"}
+	return []string{"gs", "googlecloudstorage"}
 }
 
 // Description returns a user-friendly description for this backend
@@ -121,6 +183,41 @@ func (backend *GoogleCloudStorage) AvailableSpace() (uint64, error) {
 	return 0, nil
 }
 
+// ListChunks returns all chunk parts stored in the bucket
+func (backend *GoogleCloudStorage) ListChunks() ([]knoxite.StoredChunk, error) {
+	var chunks []knoxite.StoredChunk
+	err := backend.retry(func() error {
+		chunks = nil
+		it := backend.bucket.Objects(context.Background(), &storage.Query{
+			Prefix: backend.ChunkPath() + "/",
+		})
+		for {
+			attrs, err := it.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			shasum, part, totalParts, ok := knoxite.ParseChunkFilename(path.Base(attrs.Name))
+			if !ok {
+				// e.g. the chunk-index
+				continue
+			}
+			chunks = append(chunks, knoxite.StoredChunk{
+				Hash:       shasum,
+				Part:       part,
+				TotalParts: totalParts,
+				Size:       uint64(attrs.Size),
+				ModTime:    attrs.Updated,
+			})
+		}
+	})
+
+	return chunks, err
+}
+
 // CreatePath is not needed in Google Cloud Storage backend bacause paths are automatically created when writing a file
 func (backend *GoogleCloudStorage) CreatePath(path string) error {
 	return nil
@@ -128,10 +225,14 @@ func (backend *GoogleCloudStorage) CreatePath(path string) error {
 
 // Stat returns the size of a file
 func (backend *GoogleCloudStorage) Stat(path string) (uint64, error) {
-	folder := backend.bucket.Object(path)
-	attrs, err := folder.Attrs(context.Background())
+	var attrs *storage.ObjectAttrs
+	err := backend.retry(func() error {
+		var err error
+		attrs, err = backend.bucket.Object(path).Attrs(context.Background())
+		return err
+	})
 	if err != nil {
-		return 0, err
+		return 0, pathError("stat", path, err)
 	}
 
 	return uint64(attrs.Size), nil
@@ -139,18 +240,22 @@ func (backend *GoogleCloudStorage) Stat(path string) (uint64, error) {
 
 // ReadFile reads a file from Google Cloud Storage
 func (backend *GoogleCloudStorage) ReadFile(path string) ([]byte, error) {
-	reader, err := backend.bucket.Object(path).NewReader(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	data, err := ioutil.ReadAll(reader)
-	if err != nil {
-		return nil, err
-	}
-	// read may return nil in some error situation so we need to check the error from close
-	err = reader.Close()
+	var data []byte
+	err := backend.retry(func() error {
+		reader, err := backend.bucket.Object(path).NewReader(context.Background())
+		if err != nil {
+			return err
+		}
+		data, err = ioutil.ReadAll(reader)
+		if err != nil {
+			reader.Close()
+			return err
+		}
+		// read may return nil in some error situation so we need to check the error from close
+		return reader.Close()
+	})
 	if err != nil {
-		return nil, err
+		return nil, pathError("read", path, err)
 	}
 
 	return data, nil
@@ -158,15 +263,20 @@ func (backend *GoogleCloudStorage) ReadFile(path string) ([]byte, error) {
 
 // WriteFile writes a file on Google Cloud Storage
 func (backend *GoogleCloudStorage) WriteFile(path string, data []byte) (size uint64, err error) {
-	writer := backend.bucket.Object(path).NewWriter(context.Background())
-	// we set the ChunkSize to 0 to upload the data in a single request
-	writer.ChunkSize = 0
-	written, err := writer.Write(data)
-	if err != nil {
-		return 0, err
-	}
-	// write may return nil in some error situation so we need to check the error from close
-	err = writer.Close()
+	var written int
+	err = backend.retry(func() error {
+		writer := backend.bucket.Object(path).NewWriter(context.Background())
+		// we set the ChunkSize to 0 to upload the data in a single request
+		writer.ChunkSize = 0
+		var err error
+		written, err = writer.Write(data)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+		// write may return nil in some error situation so we need to check the error from close
+		return writer.Close()
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -176,9 +286,8 @@ func (backend *GoogleCloudStorage) WriteFile(path string, data []byte) (size uin
 
 // DeleteFile deletes a file from Google Cloud Storage
 func (backend *GoogleCloudStorage) DeleteFile(path string) error {
-	err := backend.bucket.Object(path).Delete(context.Background())
-	if err != nil {
-		return err
-	}
-	return nil
+	err := backend.retry(func() error {
+		return backend.bucket.Object(path).Delete(context.Background())
+	})
+	return pathError("delete", path, err)
 }
@@ -9,12 +9,11 @@ package http
 
 import (
 	"bytes"
-	"fmt"
 	"io/ioutil"
-	"log"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 
 	"github.com/knoxite/knoxite"
@@ -63,13 +62,17 @@ func (backend *HTTPStorage) AvailableSpace() (uint64, error) {
 
 // LoadChunk loads a Chunk from network
 func (backend *HTTPStorage) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
-	//	fmt.Printf("Fetching from: %s.\n", backend.URL+"/download/"+chunk.ShaSum)
-	res, err := http.Get(backend.URL.String() + "/download/" + shasum + "." + strconv.FormatUint(uint64(part), 10) + "_" + strconv.FormatUint(uint64(totalParts), 10))
+	fileName := shasum + "." + strconv.FormatUint(uint64(part), 10) + "_" + strconv.FormatUint(uint64(totalParts), 10)
+	res, err := http.Get(backend.URL.String() + "/download/" + fileName)
 	if err != nil {
 		return []byte{}, err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusNotFound {
+		// missing chunk parts won't be retried
+		return []byte{}, &os.PathError{Op: "load", Path: fileName, Err: os.ErrNotExist}
+	}
 	if res.StatusCode != http.StatusOK {
 		return []byte{}, knoxite.ErrLoadChunkFailed
 	}
@@ -85,7 +88,6 @@ func (backend *HTTPStorage) StoreChunk(shasum string, part, totalParts uint, dat
 	// this step is very important
 	fileWriter, werr := bodyWriter.CreateFormFile("uploadfile", shasum+"."+strconv.FormatUint(uint64(part), 10)+"_"+strconv.FormatUint(uint64(totalParts), 10))
 	if werr != nil {
-		fmt.Println("error writing to buffer")
 		return 0, werr
 	}
 
@@ -111,7 +113,7 @@ func (backend *HTTPStorage) StoreChunk(shasum string, part, totalParts uint, dat
 		return 0, err
 	}
 
-	//	fmt.Printf("\tUploaded chunk: %d bytes\n", len(*data))
+	knoxite.Log().Debugf("Uploaded chunk: %d bytes", len(data))
 	return uint64(len(data)), err
 }
 
@@ -123,10 +125,10 @@ func (backend *HTTPStorage) DeleteChunk(shasum string, parts, totalParts uint) e
 
 // LoadSnapshot loads a snapshot
 func (backend *HTTPStorage) LoadSnapshot(id string) ([]byte, error) {
-	//	fmt.Printf("Fetching snapshot from: %s.\n", backend.URL+"/snapshot/"+id)
+	knoxite.Log().Debugf("Fetching snapshot from: %s", backend.URL.String()+"/snapshot/"+id)
 	res, err := http.Get(backend.URL.String() + "/snapshot/" + id)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer res.Body.Close()
 
@@ -141,7 +143,6 @@ func (backend *HTTPStorage) SaveSnapshot(id string, data []byte) error {
 	// this step is very important
 	fileWriter, err := bodyWriter.CreateFormFile("uploadfile", id)
 	if err != nil {
-		fmt.Println("error writing to buffer")
 		return err
 	}
 
@@ -165,16 +166,16 @@ func (backend *HTTPStorage) SaveSnapshot(id string, data []byte) error {
 	if resp.StatusCode != http.StatusOK {
 		return knoxite.ErrStoreSnapshotFailed
 	}
-	//	fmt.Printf("Uploaded snapshot: %d bytes\n", len(data))
+	knoxite.Log().Debugf("Uploaded snapshot: %d bytes", len(data))
 	return err
 }
 
 // LoadChunkIndex reads the chunk-index
 func (backend *HTTPStorage) LoadChunkIndex() ([]byte, error) {
-	//	fmt.Printf("Fetching chunk-index from: %s.\n", backend.URL+"/chunkindex")
+	knoxite.Log().Debugf("Fetching chunk-index from: %s", backend.URL.String()+"/chunkindex")
 	res, err := http.Get(backend.URL.String() + "/chunkindex")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer res.Body.Close()
 
@@ -189,7 +190,6 @@ func (backend *HTTPStorage) SaveChunkIndex(data []byte) error {
 	// this step is very important
 	fileWriter, err := bodyWriter.CreateFormFile("uploadfile", "chunkindex")
 	if err != nil {
-		fmt.Println("error writing to buffer")
 		return err
 	}
 
@@ -213,7 +213,7 @@ func (backend *HTTPStorage) SaveChunkIndex(data []byte) error {
 	if resp.StatusCode != http.StatusOK {
 		return knoxite.ErrStoreChunkIndexFailed
 	}
-	//	fmt.Printf("Uploaded chunk-index: %d bytes\n", len(data))
+	knoxite.Log().Debugf("Uploaded chunk-index: %d bytes", len(data))
 	return err
 }
 
@@ -224,10 +224,10 @@ func (backend *HTTPStorage) InitRepository() error {
 
 // LoadRepository reads the metadata for a repository
 func (backend *HTTPStorage) LoadRepository() ([]byte, error) {
-	//	fmt.Printf("Fetching repository from: %s.\n", backend.URL+"/repository")
+	knoxite.Log().Debugf("Fetching repository from: %s", backend.URL.String()+"/repository")
 	res, err := http.Get(backend.URL.String() + "/repository")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer res.Body.Close()
 
@@ -242,7 +242,6 @@ func (backend *HTTPStorage) SaveRepository(data []byte) error {
 	// this step is very important
 	fileWriter, err := bodyWriter.CreateFormFile("uploadfile", "repository.knoxite")
 	if err != nil {
-		fmt.Println("error writing to buffer")
 		return err
 	}
 
@@ -266,6 +265,6 @@ func (backend *HTTPStorage) SaveRepository(data []byte) error {
 	if resp.StatusCode != http.StatusOK {
 		return knoxite.ErrStoreRepositoryFailed
 	}
-	//	fmt.Printf("Uploaded repository: %d bytes\n", len(data))
+	knoxite.Log().Debugf("Uploaded repository: %d bytes", len(data))
 	return err
 }
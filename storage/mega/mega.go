@@ -12,6 +12,7 @@ package mega
 import (
 	"errors"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -228,7 +229,7 @@ func (backend *MegaStorage) getNodeFromPath(path string) (mega.Node, error) {
 			}
 		}
 		if !found {
-			return mega.Node{}, errors.New("file or directory not found on mega: " + pathSlice)
+			return mega.Node{}, &os.PathError{Op: "lookup", Path: path, Err: os.ErrNotExist}
 		}
 		// last element of slicedPath is the actual file/directory node
 		if i == len(slicedPath)-1 {
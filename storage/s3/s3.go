@@ -113,13 +113,7 @@ func (backend *S3Storage) AvailableSpace() (uint64, error) {
 // LoadChunk loads a Chunk from network
 func (backend *S3Storage) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
 	fileName := shasum + "." + strconv.FormatUint(uint64(part), 10) + "_" + strconv.FormatUint(uint64(totalParts), 10)
-	obj, err := backend.client.GetObject(backend.chunkBucket, fileName, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, err
-	}
-	defer obj.Close()
-
-	return ioutil.ReadAll(obj)
+	return backend.loadObject(backend.chunkBucket, fileName)
 }
 
 // StoreChunk stores a single Chunk on network
@@ -150,13 +144,7 @@ func (backend *S3Storage) DeleteChunk(shasum string, part, totalParts uint) erro
 
 // LoadSnapshot loads a snapshot
 func (backend *S3Storage) LoadSnapshot(id string) ([]byte, error) {
-	obj, err := backend.client.GetObject(backend.snapshotBucket, id, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, err
-	}
-	defer obj.Close()
-
-	return ioutil.ReadAll(obj)
+	return backend.loadObject(backend.snapshotBucket, id)
 }
 
 // SaveSnapshot stores a snapshot
@@ -168,13 +156,7 @@ func (backend *S3Storage) SaveSnapshot(id string, data []byte) error {
 
 // LoadChunkIndex reads the chunk-index
 func (backend *S3Storage) LoadChunkIndex() ([]byte, error) {
-	obj, err := backend.client.GetObject(backend.chunkBucket, knoxite.ChunkIndexFilename, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, err
-	}
-	defer obj.Close()
-
-	return ioutil.ReadAll(obj)
+	return backend.loadObject(backend.chunkBucket, knoxite.ChunkIndexFilename)
 }
 
 // SaveChunkIndex stores the chunk-index
@@ -230,13 +212,24 @@ func (backend *S3Storage) InitRepository() error {
 
 // LoadRepository reads the metadata for a repository
 func (backend *S3Storage) LoadRepository() ([]byte, error) {
-	obj, err := backend.client.GetObject(backend.repositoryBucket, knoxite.RepoFilename, minio.GetObjectOptions{})
+	return backend.loadObject(backend.repositoryBucket, knoxite.RepoFilename)
+}
+
+// loadObject reads an object from a bucket. Transient server errors already
+// get retried with an exponential backoff by the minio client, while missing
+// objects are reported as os.ErrNotExist, so they won't be retried at all
+func (backend *S3Storage) loadObject(bucket, name string) ([]byte, error) {
+	obj, err := backend.client.GetObject(bucket, name, minio.GetObjectOptions{})
 	if err != nil {
 		return nil, err
 	}
 	defer obj.Close()
 
-	return ioutil.ReadAll(obj)
+	b, err := ioutil.ReadAll(obj)
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, &os.PathError{Op: "load", Path: bucket + "/" + name, Err: os.ErrNotExist}
+	}
+	return b, err
 }
 
 // SaveRepository stores the metadata for a repository
@@ -9,13 +9,13 @@
 package sftp
 
 import (
-	"fmt"
 	"io/ioutil"
 	"net"
 	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
 
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
@@ -25,10 +25,14 @@ import (
 	"github.com/knoxite/knoxite"
 )
 
+// DefaultConnections is the default amount of concurrent SFTP sessions
+const DefaultConnections = 4
+
 type SFTPStorage struct {
-	url  url.URL
-	ssh  *ssh.Client
-	sftp *sftp.Client
+	url     url.URL
+	ssh     *ssh.Client
+	clients []*sftp.Client
+	pool    chan *sftp.Client
 	knoxite.StorageFilesystem
 }
 
@@ -42,24 +46,37 @@ func (*SFTPStorage) NewBackend(u url.URL) (knoxite.Backend, error) {
 		port = "22"
 		u.Host = net.JoinHostPort(u.Host, port)
 	}
+	connections := DefaultConnections
+	if v := u.Query().Get("connections"); len(v) > 0 {
+		connections, err = strconv.Atoi(v)
+		if err != nil || connections < 1 {
+			return &SFTPStorage{}, knoxite.ErrInvalidRepositoryURL
+		}
+	}
+
 	username := u.User.Username()
 	password, isSet := u.User.Password()
 
+	usr, _ := user.Current()
+
 	auth := []ssh.AuthMethod{}
 	if isSet {
 		auth = append(auth, ssh.Password(password))
 	} else {
 		socket := os.Getenv("SSH_AUTH_SOCK")
 		agent_conn, err := net.Dial("unix", socket)
-		if err != nil {
-			return &SFTPStorage{}, knoxite.ErrInvalidPassword
-		} else {
+		if err == nil {
 			agentClient := agent.NewClient(agent_conn)
 			auth = append(auth, ssh.PublicKeysCallback(agentClient.Signers))
 		}
-	}
 
-	usr, _ := user.Current()
+		if signers := privateKeySigners(usr.HomeDir); len(signers) > 0 {
+			auth = append(auth, ssh.PublicKeys(signers...))
+		}
+		if len(auth) == 0 {
+			return &SFTPStorage{}, knoxite.ErrInvalidPassword
+		}
+	}
 
 	hostKeyCallback, err := kh.New(filepath.Join(usr.HomeDir, ".ssh/known_hosts"))
 	if err != nil {
@@ -78,19 +95,28 @@ func (*SFTPStorage) NewBackend(u url.URL) (knoxite.Backend, error) {
 		return &SFTPStorage{}, err
 	}
 
-	client, err := sftp.NewClient(conn)
-	if err != nil {
-		return &SFTPStorage{}, err
-	}
-
 	backend := SFTPStorage{
 		url:  u,
-		sftp: client,
 		ssh:  conn,
+		pool: make(chan *sftp.Client, connections),
+	}
+
+	// all sessions share the same SSH connection, which saves us from doing
+	// a handshake for every single chunk that gets requested
+	for i := 0; i < connections; i++ {
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			backend.Close()
+			return &SFTPStorage{}, err
+		}
+
+		backend.clients = append(backend.clients, client)
+		backend.pool <- client
 	}
 
 	fs, err := knoxite.NewStorageFilesystem(u.Path, &backend)
 	if err != nil {
+		backend.Close()
 		return &SFTPStorage{}, err
 	}
 	backend.StorageFilesystem = fs
@@ -98,12 +124,45 @@ func (*SFTPStorage) NewBackend(u url.URL) (knoxite.Backend, error) {
 	return &backend, nil
 }
 
+// privateKeySigners returns signers for the user's default, unencrypted
+// private keys. Keys which can't be read or parsed are skipped
+func privateKeySigners(home string) []ssh.Signer {
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := ioutil.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+
+	return signers
+}
+
+// acquire waits for an idle session and takes it from the pool. This limits
+// the amount of concurrent requests sent to the server
+func (backend *SFTPStorage) acquire() *sftp.Client {
+	return <-backend.pool
+}
+
+// release returns a session to the pool
+func (backend *SFTPStorage) release(client *sftp.Client) {
+	backend.pool <- client
+}
+
 func (backend *SFTPStorage) Protocols() []string {
 	return []string{"sftp"}
 }
 
 func (backend *SFTPStorage) AvailableSpace() (uint64, error) {
-	stat, err := backend.sftp.StatVFS(backend.url.Path)
+	client := backend.acquire()
+	defer backend.release(client)
+
+	stat, err := client.StatVFS(backend.url.Path)
 	if err != nil || stat == nil {
 		return 0, knoxite.ErrAvailableSpaceUnknown
 	}
@@ -112,7 +171,17 @@ func (backend *SFTPStorage) AvailableSpace() (uint64, error) {
 }
 
 func (backend *SFTPStorage) Close() error {
-	return backend.sftp.Close()
+	var err error
+	for _, client := range backend.clients {
+		if cerr := client.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if cerr := backend.ssh.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+
+	return err
 }
 
 func (backend *SFTPStorage) Description() string {
@@ -124,27 +193,35 @@ func (backend *SFTPStorage) Location() string {
 }
 
 func (backend *SFTPStorage) CreatePath(path string) error {
-	return backend.sftp.MkdirAll(path)
+	client := backend.acquire()
+	defer backend.release(client)
+
+	return client.MkdirAll(path)
 }
 
 func (backend *SFTPStorage) DeleteFile(path string) error {
-	return backend.sftp.Remove(path)
+	client := backend.acquire()
+	defer backend.release(client)
+
+	return client.Remove(path)
 }
 
 func (backend *SFTPStorage) DeletePath(path string) error {
-	fmt.Println("Deleting path", path)
-	files, err := backend.sftp.ReadDir(path)
+	knoxite.Log().Debugf("Deleting path %s", path)
+	client := backend.acquire()
+	files, err := client.ReadDir(path)
+	backend.release(client)
 	if err != nil {
 		return err
 	}
 	for _, file := range files {
-		fpath := backend.sftp.Join(path, file.Name())
+		fpath := client.Join(path, file.Name())
 		if file.IsDir() {
 			err = backend.DeletePath(fpath)
 			if err != nil {
 				return err
 			}
-			err = backend.sftp.Remove(fpath)
+			err = backend.DeleteFile(fpath)
 		} else {
 			err = backend.DeleteFile(fpath)
 		}
@@ -156,8 +233,29 @@ func (backend *SFTPStorage) DeletePath(path string) error {
 	return nil
 }
 
+func (backend *SFTPStorage) ListFiles(path string) ([]string, error) {
+	client := backend.acquire()
+	defer backend.release(client)
+
+	files, err := client.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.Mode().IsRegular() {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
 func (backend *SFTPStorage) ReadFile(path string) ([]byte, error) {
-	file, err := backend.sftp.Open(path)
+	client := backend.acquire()
+	defer backend.release(client)
+
+	file, err := client.Open(path)
 	if err != nil {
 		return nil, err
 	}
@@ -167,16 +265,25 @@ func (backend *SFTPStorage) ReadFile(path string) ([]byte, error) {
 }
 
 func (backend *SFTPStorage) WriteFile(path string, data []byte) (size uint64, err error) {
-	file, err := backend.sftp.Create(path)
+	client := backend.acquire()
+	defer backend.release(client)
+
+	file, err := client.Create(path)
 	if err != nil {
 		return 0, err
 	}
 	length, err := file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
 	return uint64(length), err
 }
 
 func (backend *SFTPStorage) Stat(path string) (uint64, error) {
-	stat, err := backend.sftp.Stat(path)
+	client := backend.acquire()
+	defer backend.release(client)
+
+	stat, err := client.Stat(path)
 	if err != nil {
 		return 0, err
 	}
@@ -10,7 +10,10 @@ package webdav
 
 import (
 	"errors"
+	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 
 	"github.com/studio-b12/gowebdav"
 
@@ -47,6 +50,10 @@ func (*WebDAVStorage) NewBackend(u url.URL) (knoxite.Backend, error) {
 	passwd, _ := userinfo.Password()
 
 	webdavClient := gowebdav.NewClient(u0.String(), username, passwd)
+	webdavClient.SetTransport(&sameHostTransport{
+		host:      u0.Host,
+		transport: http.DefaultTransport,
+	})
 	backend := WebDAVStorage{
 		URL:    u,
 		Client: webdavClient,
@@ -62,6 +69,23 @@ func (*WebDAVStorage) NewBackend(u url.URL) (knoxite.Backend, error) {
 
 }
 
+// sameHostTransport only sends credentials to the host the repository lives
+// on, so they don't leak when a server redirects us to a different host
+type sameHostTransport struct {
+	host      string
+	transport http.RoundTripper
+}
+
+// RoundTrip strips the credentials from requests to foreign hosts
+func (t *sameHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host && req.Header.Get("Authorization") != "" {
+		req = req.Clone(req.Context())
+		req.Header.Del("Authorization")
+	}
+
+	return t.transport.RoundTrip(req)
+}
+
 // Location returns the type and location of the repository
 func (backend *WebDAVStorage) Location() string {
 	return backend.URL.String()
@@ -106,9 +130,35 @@ func (backend *WebDAVStorage) DeletePath(path string) error {
 	return backend.Client.Remove(path)
 }
 
+// pathError converts the errors gowebdav returns for missing files to errors
+// os.IsNotExist recognizes
+func pathError(err error) error {
+	if perr, ok := err.(*os.PathError); ok && perr.Err != nil && perr.Err.Error() == strconv.Itoa(http.StatusNotFound) {
+		return &os.PathError{Op: perr.Op, Path: perr.Path, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+// ListFiles returns the names of all files stored in a directory
+func (backend *WebDAVStorage) ListFiles(path string) ([]string, error) {
+	files, err := backend.Client.ReadDir(path)
+	if err != nil {
+		return nil, pathError(err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
 // ReadFile reads the file
 func (backend *WebDAVStorage) ReadFile(path string) ([]byte, error) {
-	return backend.Client.Read(path)
+	data, err := backend.Client.Read(path)
+	return data, pathError(err)
 }
 
 // WriteFile writes a file
@@ -121,7 +171,7 @@ func (backend *WebDAVStorage) WriteFile(path string, data []byte) (size uint64,
 func (backend *WebDAVStorage) Stat(path string) (uint64, error) {
 	stat, err := backend.Client.Stat(path)
 	if err != nil {
-		return 0, err
+		return 0, pathError(err)
 	}
 	return uint64(stat.Size()), nil
 
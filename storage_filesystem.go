@@ -8,9 +8,10 @@
 package knoxite
 
 import (
-	"fmt"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -20,6 +21,7 @@ const (
 	ChunkIndexFilename = "index"
 	chunksDirname      = "chunks"
 	snapshotsDirname   = "snapshots"
+	locksDirname       = "locks"
 )
 
 // BackendFilesystem is used to store and access data on a filesytem based backend
@@ -36,6 +38,13 @@ type BackendFilesystem interface {
 	DeleteFile(path string) error
 }
 
+// FileLister is implemented by filesystem based backends which can list the
+// files stored in a directory. It's required for locking a repository
+type FileLister interface {
+	// ListFiles returns the names of all files stored in a directory
+	ListFiles(path string) ([]string, error)
+}
+
 // StorageFilesystem is bridging a BackendFilesystem to a Backend interface
 type StorageFilesystem struct {
 	Path           string
@@ -43,6 +52,7 @@ type StorageFilesystem struct {
 	snapshotPath   string
 	chunkIndexPath string
 	repositoryPath string
+	locksPath      string
 
 	storage *BackendFilesystem
 }
@@ -55,11 +65,17 @@ func NewStorageFilesystem(path string, storage BackendFilesystem) (StorageFilesy
 		snapshotPath:   filepath.Join(path, snapshotsDirname),
 		chunkIndexPath: filepath.Join(path, chunksDirname, ChunkIndexFilename),
 		repositoryPath: filepath.Join(path, RepoFilename),
+		locksPath:      filepath.Join(path, locksDirname),
 		storage:        &storage,
 	}
 	return s, nil
 }
 
+// ChunkPath returns the path all chunks are stored in
+func (backend StorageFilesystem) ChunkPath() string {
+	return backend.chunkPath
+}
+
 // LoadChunk loads a Chunk from disk
 func (backend StorageFilesystem) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
 	path := filepath.Join(backend.chunkPath, SubDirForChunk(shasum))
@@ -96,12 +112,7 @@ func (backend StorageFilesystem) DeleteChunk(shasum string, part, totalParts uin
 
 // LoadSnapshot loads a snapshot
 func (backend StorageFilesystem) LoadSnapshot(id string) ([]byte, error) {
-	b, err := (*backend.storage).ReadFile(filepath.Join(backend.snapshotPath, id))
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	return b, err
+	return (*backend.storage).ReadFile(filepath.Join(backend.snapshotPath, id))
 }
 
 // SaveSnapshot stores a snapshot
@@ -166,7 +177,76 @@ func (backend StorageFilesystem) SaveRepository(b []byte) error {
 	return err
 }
 
+// StoreLock stores a single lock
+func (backend StorageFilesystem) StoreLock(id string, data []byte) error {
+	if _, ok := (*backend.storage).(FileLister); !ok {
+		return ErrLockingUnsupported
+	}
+
+	if err := (*backend.storage).CreatePath(backend.locksPath); err != nil {
+		return err
+	}
+	_, err := (*backend.storage).WriteFile(filepath.Join(backend.locksPath, id), data)
+	return err
+}
+
+// ListLocks returns all locks stored in the repository
+func (backend StorageFilesystem) ListLocks() ([][]byte, error) {
+	lister, ok := (*backend.storage).(FileLister)
+	if !ok {
+		return nil, ErrLockingUnsupported
+	}
+
+	names, err := lister.ListFiles(backend.locksPath)
+	if os.IsNotExist(err) {
+		// no locks have been stored yet
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var locks [][]byte
+	for _, name := range names {
+		b, err := (*backend.storage).ReadFile(filepath.Join(backend.locksPath, name))
+		if os.IsNotExist(err) {
+			// the lock got released in the meantime
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		locks = append(locks, b)
+	}
+	return locks, nil
+}
+
+// DeleteLock removes a lock from the repository
+func (backend StorageFilesystem) DeleteLock(id string) error {
+	return (*backend.storage).DeleteFile(filepath.Join(backend.locksPath, id))
+}
+
 // SubDirForChunk files a chunk into a subdir, based on the chunks name
 func SubDirForChunk(id string) string {
 	return filepath.Join(id[0:2], id[2:4])
 }
+
+// ParseChunkFilename splits the filename of a stored chunk part into the
+// chunk's hash, the part number and the amount of data parts. Backends use it
+// to implement ChunkLister
+func ParseChunkFilename(name string) (shasum string, part, totalParts uint, ok bool) {
+	dot := strings.LastIndex(name, ".")
+	sep := strings.LastIndex(name, "_")
+	if dot <= 0 || sep < dot {
+		return "", 0, 0, false
+	}
+
+	p, err := strconv.ParseUint(name[dot+1:sep], 10, 32)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	t, err := strconv.ParseUint(name[sep+1:], 10, 32)
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	return name[:dot], uint(p), uint(t), true
+}
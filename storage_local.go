@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"path/filepath"
 )
 
 // StorageLocal stores data on the local disk
@@ -78,6 +79,51 @@ func (backend StorageLocal) WriteFile(path string, data []byte) (size uint64, er
 
 // DeleteFile deletes a file from disk
 func (backend StorageLocal) DeleteFile(path string) error {
-	// fmt.Println("Deleting:", path)
+	logger.Debugf("Deleting: %s", path)
 	return os.Remove(path)
 }
+
+// ListFiles returns the names of all files stored in a directory
+func (backend StorageLocal) ListFiles(path string) ([]string, error) {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+// ListChunks returns all chunk parts stored on the local disk
+func (backend *StorageLocal) ListChunks() ([]StoredChunk, error) {
+	var chunks []StoredChunk
+	err := filepath.Walk(backend.chunkPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		shasum, part, totalParts, ok := ParseChunkFilename(info.Name())
+		if !ok {
+			// e.g. the chunk-index
+			return nil
+		}
+		chunks = append(chunks, StoredChunk{
+			Hash:       shasum,
+			Part:       part,
+			TotalParts: totalParts,
+			Size:       uint64(info.Size()),
+			ModTime:    info.ModTime(),
+		})
+		return nil
+	})
+
+	return chunks, err
+}
@@ -9,18 +9,7 @@
 
 package knoxite
 
-import "syscall"
-
 // AvailableSpace returns the free space on this backend
 func (backend *StorageLocal) AvailableSpace() (uint64, error) {
-	//FIXME: make this cross-platform compatible
-	var stat syscall.Statfs_t
-	err := syscall.Statfs(backend.Path, &stat)
-	if err != nil {
-		return 0, err
-	}
-
-	// Available blocks * size per block = available space in bytes
-	// we convert both types to a uint64 as their type varies on different OS
-	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+	return freeSpace(backend.Path)
 }
@@ -0,0 +1,322 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// backends opened via memory:// URLs, by name
+	memoryBackends   = make(map[string]*MemoryBackend)
+	memoryBackendsMu sync.Mutex
+)
+
+// MemoryBackend keeps all data in memory. It's meant for testing and can
+// simulate failing backends: parts of chunks can be made to fail loading or
+// to return corrupted data, and all chunk loads can be delayed
+type MemoryBackend struct {
+	name string
+
+	mut        sync.Mutex
+	chunks     map[string]memoryChunk
+	snapshots  map[string][]byte
+	chunkIndex []byte
+	repository []byte
+	locks      map[string][]byte
+
+	failures map[string]error
+	corrupt  map[string]bool
+	latency  time.Duration
+}
+
+type memoryChunk struct {
+	data    []byte
+	modTime time.Time
+}
+
+func init() {
+	RegisterStorageBackend(&MemoryBackend{})
+}
+
+// NewMemoryBackend returns an empty MemoryBackend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		chunks:    make(map[string]memoryChunk),
+		snapshots: make(map[string][]byte),
+		locks:     make(map[string][]byte),
+		failures:  make(map[string]error),
+		corrupt:   make(map[string]bool),
+	}
+}
+
+// NewBackend returns the MemoryBackend for a URL like memory://name. Opening
+// the same URL again returns the same backend, so repositories can be
+// re-opened
+func (*MemoryBackend) NewBackend(u url.URL) (Backend, error) {
+	memoryBackendsMu.Lock()
+	defer memoryBackendsMu.Unlock()
+
+	backend, ok := memoryBackends[u.Host]
+	if !ok {
+		backend = NewMemoryBackend()
+		backend.name = u.Host
+		memoryBackends[u.Host] = backend
+	}
+	return backend, nil
+}
+
+// memoryChunkName returns the key a chunk part is stored with
+func memoryChunkName(shasum string, part, totalParts uint) string {
+	return shasum + "." + strconv.FormatUint(uint64(part), 10) + "_" + strconv.FormatUint(uint64(totalParts), 10)
+}
+
+// memoryPartKey identifies a part of a chunk for the failure knobs
+func memoryPartKey(shasum string, part uint) string {
+	return shasum + "." + strconv.FormatUint(uint64(part), 10)
+}
+
+// notExist returns an error os.IsNotExist recognizes
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+// FailPart makes loading a part of a chunk fail with err. A nil error makes
+// the part loadable again
+func (backend *MemoryBackend) FailPart(shasum string, part uint, err error) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	if err == nil {
+		delete(backend.failures, memoryPartKey(shasum, part))
+		return
+	}
+	backend.failures[memoryPartKey(shasum, part)] = err
+}
+
+// CorruptPart makes loading a part of a chunk return data with a flipped bit
+func (backend *MemoryBackend) CorruptPart(shasum string, part uint) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	backend.corrupt[memoryPartKey(shasum, part)] = true
+}
+
+// SetLatency delays every chunk load by d
+func (backend *MemoryBackend) SetLatency(d time.Duration) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	backend.latency = d
+}
+
+// Location returns the type and location of the repository
+func (backend *MemoryBackend) Location() string {
+	return "memory://" + backend.name
+}
+
+// Close the backend
+func (backend *MemoryBackend) Close() error {
+	return nil
+}
+
+// Protocols returns the Protocol Schemes supported by this backend
+func (backend *MemoryBackend) Protocols() []string {
+	return []string{"memory"}
+}
+
+// Description returns a user-friendly description for this backend
+func (backend *MemoryBackend) Description() string {
+	return "Memory Storage"
+}
+
+// AvailableSpace returns the free space on this backend
+func (backend *MemoryBackend) AvailableSpace() (uint64, error) {
+	return 0, ErrAvailableSpaceUnknown
+}
+
+// LoadChunk loads a single Chunk
+func (backend *MemoryBackend) LoadChunk(shasum string, part, totalParts uint) ([]byte, error) {
+	backend.mut.Lock()
+	latency := backend.latency
+	backend.mut.Unlock()
+	time.Sleep(latency)
+
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	key := memoryPartKey(shasum, part)
+	if err := backend.failures[key]; err != nil {
+		return nil, err
+	}
+	name := memoryChunkName(shasum, part, totalParts)
+	c, ok := backend.chunks[name]
+	if !ok {
+		return nil, notExist("load", name)
+	}
+
+	b := append([]byte{}, c.data...)
+	if backend.corrupt[key] && len(b) > 0 {
+		b[0] ^= 0xff
+	}
+	return b, nil
+}
+
+// StoreChunk stores a single Chunk
+func (backend *MemoryBackend) StoreChunk(shasum string, part, totalParts uint, data []byte) (uint64, error) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	name := memoryChunkName(shasum, part, totalParts)
+	if c, ok := backend.chunks[name]; ok && len(c.data) == len(data) {
+		return 0, nil
+	}
+	backend.chunks[name] = memoryChunk{append([]byte{}, data...), time.Now()}
+	return uint64(len(data)), nil
+}
+
+// DeleteChunk deletes a single Chunk
+func (backend *MemoryBackend) DeleteChunk(shasum string, part, totalParts uint) error {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	name := memoryChunkName(shasum, part, totalParts)
+	if _, ok := backend.chunks[name]; !ok {
+		return notExist("delete", name)
+	}
+	delete(backend.chunks, name)
+	return nil
+}
+
+// ListChunks returns all chunk parts stored in memory
+func (backend *MemoryBackend) ListChunks() ([]StoredChunk, error) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	chunks := make([]StoredChunk, 0, len(backend.chunks))
+	for name, c := range backend.chunks {
+		shasum, part, totalParts, _ := ParseChunkFilename(name)
+		chunks = append(chunks, StoredChunk{
+			Hash:       shasum,
+			Part:       part,
+			TotalParts: totalParts,
+			Size:       uint64(len(c.data)),
+			ModTime:    c.modTime,
+		})
+	}
+	return chunks, nil
+}
+
+// LoadSnapshot loads a snapshot
+func (backend *MemoryBackend) LoadSnapshot(id string) ([]byte, error) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	b, ok := backend.snapshots[id]
+	if !ok {
+		return nil, notExist("load", id)
+	}
+	return b, nil
+}
+
+// SaveSnapshot stores a snapshot
+func (backend *MemoryBackend) SaveSnapshot(id string, data []byte) error {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	backend.snapshots[id] = append([]byte{}, data...)
+	return nil
+}
+
+// LoadChunkIndex loads the chunk-index
+func (backend *MemoryBackend) LoadChunkIndex() ([]byte, error) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	if backend.chunkIndex == nil {
+		return []byte{}, notExist("load", ChunkIndexFilename)
+	}
+	return backend.chunkIndex, nil
+}
+
+// SaveChunkIndex stores the chunk-index
+func (backend *MemoryBackend) SaveChunkIndex(data []byte) error {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	backend.chunkIndex = append([]byte{}, data...)
+	return nil
+}
+
+// InitRepository creates a new repository
+func (backend *MemoryBackend) InitRepository() error {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	if backend.repository != nil {
+		return ErrRepositoryExists
+	}
+	return nil
+}
+
+// LoadRepository reads the metadata for a repository
+func (backend *MemoryBackend) LoadRepository() ([]byte, error) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	if backend.repository == nil {
+		return []byte{}, notExist("load", RepoFilename)
+	}
+	return backend.repository, nil
+}
+
+// SaveRepository stores the metadata for a repository
+func (backend *MemoryBackend) SaveRepository(data []byte) error {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	backend.repository = append([]byte{}, data...)
+	return nil
+}
+
+// StoreLock stores a single lock
+func (backend *MemoryBackend) StoreLock(id string, data []byte) error {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	backend.locks[id] = append([]byte{}, data...)
+	return nil
+}
+
+// ListLocks returns all locks stored in the repository
+func (backend *MemoryBackend) ListLocks() ([][]byte, error) {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	var locks [][]byte
+	for _, data := range backend.locks {
+		locks = append(locks, append([]byte{}, data...))
+	}
+	return locks, nil
+}
+
+// DeleteLock removes a lock from the repository
+func (backend *MemoryBackend) DeleteLock(id string) error {
+	backend.mut.Lock()
+	defer backend.mut.Unlock()
+
+	if _, ok := backend.locks[id]; !ok {
+		return notExist("delete", id)
+	}
+	delete(backend.locks, id)
+	return nil
+}
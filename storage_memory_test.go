@@ -0,0 +1,80 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 8192)
+
+	// the repository gets re-opened from the same memory backend
+	r, snapshot := setupDecodeTest(t, "memory://TestMemoryBackend", []string{src}, CompressionNone, 1)
+	be, ok := (*r.BackendManager().Backends[0]).(*MemoryBackend)
+	if !ok {
+		t.Fatalf("Expected a MemoryBackend, got %T", *r.BackendManager().Backends[0])
+	}
+	r.SetChunkCacheSize(0)
+	arc := *snapshot.Archives[src]
+	chunk := arc.Chunks[0]
+
+	b, _, err := DecodeArchiveData(r, arc)
+	if err != nil {
+		t.Fatalf("Failed decoding archive: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after decoding archive")
+	}
+
+	// a failing data part gets reconstructed from the parity part
+	be.FailPart(chunk.Hash, 0, errors.New("simulated failure"))
+	b, err = loadChunk(r, arc, chunk)
+	if err != nil {
+		t.Fatalf("Failed loading chunk with a failing part: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Data mismatch after reconstructing chunk")
+	}
+
+	// too many failing parts
+	be.FailPart(chunk.Hash, 1, errors.New("simulated failure"))
+	if _, err = loadChunk(r, arc, chunk); err == nil {
+		t.Error("Expected loading chunk to fail")
+	}
+
+	// corrupted parts get detected
+	be.FailPart(chunk.Hash, 0, nil)
+	be.FailPart(chunk.Hash, 1, nil)
+	be.CorruptPart(chunk.Hash, 0)
+	be.CorruptPart(chunk.Hash, 1)
+	_, err = loadChunk(r, arc, chunk)
+	if _, ok := err.(*CheckSumError); !ok {
+		t.Errorf("Expected CheckSumError, got %v", err)
+	}
+
+	chunks, err := be.ListChunks()
+	if err != nil {
+		t.Fatalf("Failed listing chunks: %s", err)
+	}
+	if len(chunks) != 2 {
+		t.Errorf("Expected 2 stored chunk parts, got %d", len(chunks))
+	}
+}
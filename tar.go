@@ -0,0 +1,121 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportTar writes the content of a snapshot as a tar archive to w. The
+// files get streamed chunk by chunk, so they're never held in memory entirely.
+// Hardlinks follow all other items, so their targets are in place when
+// extracting the archive
+func ExportTar(repository Repository, snapshot *Snapshot, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, arc := range exportOrder(snapshot) {
+		if err := writeTarEntry(tw, repository, *arc); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// exportOrder returns the archives of a snapshot sorted by path, followed by
+// the hardlinks
+func exportOrder(snapshot *Snapshot) []*Archive {
+	archives := make([]*Archive, 0, len(snapshot.Archives))
+	var links []*Archive
+	for _, arc := range snapshot.Archives {
+		if arc.LinkTarget != "" {
+			links = append(links, arc)
+		} else {
+			archives = append(archives, arc)
+		}
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Path < archives[j].Path })
+	sort.Slice(links, func(i, j int) bool { return links[i].Path < links[j].Path })
+
+	return append(archives, links...)
+}
+
+// exportName converts the path of an archive to the relative, slash-separated
+// name used in tar and zip archives
+func exportName(p string) string {
+	return strings.TrimPrefix(cleanArchivePath(p), "/")
+}
+
+// writeTarEntry writes the header and, for files, the content of an archive
+func writeTarEntry(tw *tar.Writer, repository Repository, arc Archive) error {
+	hdr := &tar.Header{
+		Name:    exportName(arc.Path),
+		Mode:    tarMode(arc.Mode),
+		Uid:     int(arc.UID),
+		Gid:     int(arc.GID),
+		ModTime: time.Unix(arc.ModTime, 0),
+	}
+	if len(arc.XAttrs) > 0 {
+		hdr.Format = tar.FormatPAX
+		hdr.PAXRecords = make(map[string]string, len(arc.XAttrs))
+		for name, value := range arc.XAttrs {
+			hdr.PAXRecords["SCHILY.xattr."+name] = string(value)
+		}
+	}
+
+	switch {
+	case arc.Type == Directory:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case arc.Type == SymLink:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = arc.PointsTo
+	case arc.LinkTarget != "":
+		hdr.Typeflag = tar.TypeLink
+		hdr.Linkname = exportName(arc.LinkTarget)
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(arc.Size)
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	r, err := NewArchiveReader(repository, arc)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+// tarMode returns the permission and special mode bits as stored in tar
+// headers
+func tarMode(mode os.FileMode) int64 {
+	m := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
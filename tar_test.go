@@ -0,0 +1,115 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err = os.MkdirAll(filepath.Join(src, "sub"), 0750); err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	data := writeRandomFile(t, filepath.Join(src, "random"), 3*preferredChunkSize)
+	if err = os.Chmod(filepath.Join(src, "random"), 0640); err != nil {
+		t.Fatalf("Failed changing file mode: %s", err)
+	}
+	nested := writeRandomFile(t, filepath.Join(src, "sub", "nested"), 1024)
+	if err = os.Symlink("random", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("Failed creating symlink: %s", err)
+	}
+	if err = os.Link(filepath.Join(src, "sub", "nested"), filepath.Join(src, "hardlink")); err != nil {
+		t.Fatalf("Failed creating hardlink: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	var buf bytes.Buffer
+	if err = ExportTar(r, snapshot, &buf); err != nil {
+		t.Fatalf("Failed exporting snapshot: %s", err)
+	}
+
+	base := strings.TrimPrefix(filepath.ToSlash(src), "/")
+
+	// whichever of the hardlinked files got stored first holds the data
+	dataName, linkName := base+"/sub/nested", base+"/hardlink"
+	if snapshot.Archives[filepath.Join(src, "sub", "nested")].LinkTarget != "" {
+		dataName, linkName = linkName, dataName
+	}
+
+	headers := make(map[string]*tar.Header)
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed reading tar archive: %s", err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Failed reading %s from tar archive: %s", hdr.Name, err)
+		}
+		headers[hdr.Name] = hdr
+		contents[hdr.Name] = b
+	}
+
+	tests := []struct {
+		name     string
+		typeflag byte
+		mode     int64
+		linkname string
+		data     []byte
+	}{
+		{base + "/", tar.TypeDir, 0750, "", nil},
+		{base + "/sub/", tar.TypeDir, 0750, "", nil},
+		{base + "/random", tar.TypeReg, 0640, "", data},
+		{dataName, tar.TypeReg, 0644, "", nested},
+		{base + "/link", tar.TypeSymlink, -1, "random", nil},
+		{linkName, tar.TypeLink, -1, dataName, nil},
+	}
+	for _, tt := range tests {
+		hdr, ok := headers[tt.name]
+		if !ok {
+			t.Errorf("Expected %s to be part of the tar archive", tt.name)
+			continue
+		}
+		if hdr.Typeflag != tt.typeflag {
+			t.Errorf("Expected type %c for %s, got %c", tt.typeflag, tt.name, hdr.Typeflag)
+		}
+		if tt.mode >= 0 && hdr.Mode != tt.mode {
+			t.Errorf("Expected mode %o for %s, got %o", tt.mode, tt.name, hdr.Mode)
+		}
+		if hdr.Linkname != tt.linkname {
+			t.Errorf("Expected link to %s for %s, got %s", tt.linkname, tt.name, hdr.Linkname)
+		}
+		if !bytes.Equal(contents[tt.name], tt.data) {
+			t.Errorf("Data mismatch for %s", tt.name)
+		}
+		arc := snapshot.Archives[filepath.FromSlash("/"+strings.TrimSuffix(tt.name, "/"))]
+		if arc != nil && (hdr.ModTime.Unix() != arc.ModTime || hdr.Uid != int(arc.UID) || hdr.Gid != int(arc.GID)) {
+			t.Errorf("Expected mtime and ownership of %s to be preserved", tt.name)
+		}
+	}
+}
@@ -53,19 +53,11 @@ func VerifyRepo(repository Repository, percentage int) (prog chan Progress, err
 			selectedArchives[archives[idx]] = true
 		}
 
+		var total Stats
+		verified := make(map[string]bool)
 		for archiveKey := range selectedArchives {
 			snapshot := archiveToSnapshot[archiveKey]
-			p := newProgress(snapshot.Archives[archiveKey])
-			prog <- p
-
-			err := VerifyArchive(repository, *snapshot.Archives[archiveKey])
-			if err != nil {
-				prog <- newProgressError(err)
-			}
-
-			p.CurrentItemStats.Transferred += uint64((*snapshot.Archives[archiveKey]).Size)
-			prog <- p
-
+			verifyArchive(prog, repository, snapshot.Archives[archiveKey], &total, verified)
 		}
 		close(prog)
 	}()
@@ -117,18 +109,11 @@ func VerifyVolume(repository Repository, volumeId string, percentage int) (prog
 			selectedArchives[archives[idx]] = true
 		}
 
+		var total Stats
+		verified := make(map[string]bool)
 		for archiveKey := range selectedArchives {
 			snapshot := archiveToSnapshot[archiveKey]
-			p := newProgress(snapshot.Archives[archiveKey])
-			prog <- p
-
-			err := VerifyArchive(repository, *snapshot.Archives[archiveKey])
-			if err != nil {
-				prog <- newProgressError(err)
-			}
-
-			p.CurrentItemStats.Transferred += uint64((*snapshot.Archives[archiveKey]).Size)
-			prog <- p
+			verifyArchive(prog, repository, snapshot.Archives[archiveKey], &total, verified)
 		}
 		close(prog)
 	}()
@@ -167,27 +152,83 @@ func VerifySnapshot(repository Repository, snapshotId string, percentage int) (p
 			selectedArchives[archives[idx]] = true
 		}
 
+		var total Stats
+		verified := make(map[string]bool)
 		for archiveKey := range selectedArchives {
-			p := newProgress(snapshot.Archives[archiveKey])
-			prog <- p
+			verifyArchive(prog, repository, snapshot.Archives[archiveKey], &total, verified)
+		}
+		close(prog)
+	}()
 
-			err := VerifyArchive(repository, *snapshot.Archives[archiveKey])
-			if err != nil {
-				prog <- newProgressError(err)
+	return prog, nil
+}
+
+// verifyArchive loads and decodes all chunks of an archive. Corrupted chunks
+// get reported as errors and chunks which needed reconstruction as warnings,
+// without aborting the verification. total keeps count of the verified,
+// reconstructed and corrupted chunks. Chunks whose hash is in verified don't
+// get loaded again, but count as deduplicated
+func verifyArchive(prog chan Progress, repository Repository, arc *Archive, total *Stats, verified map[string]bool) {
+	p := newProgress(arc)
+	p.TotalStatistics = *total
+	prog <- p
+
+	if arc.Type != File {
+		return
+	}
+	offset := 0
+	for i := range arc.Chunks {
+		var missing []uint
+		idx, err := arc.IndexOfChunk(uint(i))
+		if err == nil {
+			chunk := arc.Chunks[idx]
+			p.CurrentItemStats.Transferred += uint64(chunk.OriginalSize)
+			if verified[chunk.Hash] {
+				offset += chunk.OriginalSize
+				total.Chunks++
+				total.DedupChunks++
+				total.DedupSize += uint64(chunk.OriginalSize)
+				p.TotalStatistics = *total
+				prog <- p
+				continue
 			}
 
-			p.CurrentItemStats.Transferred += uint64((*snapshot.Archives[archiveKey]).Size)
-			prog <- p
+			missing, err = verifyChunk(repository, *arc, chunk)
+			if err == nil {
+				verified[chunk.Hash] = true
+			}
+			if err == nil && len(missing) > 0 {
+				total.Reconstructed++
+				pw := newProgressWarning(arc, &ReconstructionWarning{arc.Path, offset, chunk, missing})
+				pw.TotalStatistics = *total
+				prog <- pw
+			}
+			offset += chunk.OriginalSize
+		}
 
+		if err != nil {
+			total.Errors++
+			pe := newProgressError(err)
+			pe.Path = arc.Path
+			pe.TotalStatistics = *total
+			prog <- pe
+		} else {
+			total.Chunks++
 		}
-		close(prog)
-	}()
 
-	return prog, nil
+		p.TotalStatistics = *total
+		prog <- p
+	}
 }
 
+// VerifyArchive loads and decodes all chunks of an archive. Chunks are
+// deliberately not added to the chunk cache and their decoded data is
+// discarded while being verified, so verifying an entire repository uses a
+// bounded amount of memory. Chunks occurring several times only get verified
+// once
 func VerifyArchive(repository Repository, arc Archive) error {
 	if arc.Type == File {
+		verified := make(map[string]bool)
 		parts := uint(len(arc.Chunks))
 		for i := uint(0); i < parts; i++ {
 			idx, erri := arc.IndexOfChunk(i)
@@ -196,10 +237,14 @@ func VerifyArchive(repository Repository, arc Archive) error {
 			}
 
 			chunk := arc.Chunks[idx]
-			_, errc := loadChunk(repository, arc, chunk)
+			if verified[chunk.Hash] {
+				continue
+			}
+			_, errc := verifyChunk(repository, arc, chunk)
 			if errc != nil {
 				return errc
 			}
+			verified[chunk.Hash] = true
 		}
 		return nil
 	}
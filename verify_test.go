@@ -2,6 +2,7 @@ package knoxite
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -366,3 +367,166 @@ func TestVerifySnapshot(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifyArchiveBypassesCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"verify.go", "verify_test.go"}, CompressionGZip, 0)
+
+	size := r.cache.Size()
+	for _, arc := range snapshot.Archives {
+		err := VerifyArchive(r, *arc)
+		if err != nil {
+			t.Errorf("Failed verifying archive %s: %s", arc.Path, err)
+		}
+	}
+	if r.cache.Size() != size {
+		t.Errorf("Expected chunk cache size %d after verify, got %d", size, r.cache.Size())
+	}
+}
+
+func TestVerifySnapshotCorruptChunk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	writeRandomFile(t, src, 4*preferredChunkSize)
+
+	repo := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repo, []string{src}, CompressionNone, 0)
+	arc := snapshot.Archives[src]
+	if len(arc.Chunks) < 2 {
+		t.Fatalf("Expected multiple chunks, got %d", len(arc.Chunks))
+	}
+
+	corruptChunk(t, repo, arc.Chunks[0])
+
+	progress, err := VerifySnapshot(r, snapshot.ID, 100)
+	if err != nil {
+		t.Fatalf("Failed to verify snapshot: %s", err)
+	}
+	var stats Stats
+	for p := range progress {
+		if p.Error != nil {
+			if _, ok := p.Error.(*CheckSumError); !ok {
+				t.Errorf("Expected CheckSumError, got %v", p.Error)
+			}
+			if p.Path != src {
+				t.Errorf("Expected error for %s, got %s", src, p.Path)
+			}
+		}
+		stats = p.TotalStatistics
+	}
+
+	if stats.Errors != 1 {
+		t.Errorf("Expected 1 corrupted chunk, got %d", stats.Errors)
+	}
+	if stats.Chunks != uint64(len(arc.Chunks)-1) {
+		t.Errorf("Expected %d verified chunks, got %d", len(arc.Chunks)-1, stats.Chunks)
+	}
+}
+
+func TestVerifySnapshotReconstructedChunk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	writeRandomFile(t, src, 2*preferredChunkSize)
+
+	repo := filepath.Join(dir, "repo")
+	r, snapshot := setupDecodeTest(t, repo, []string{src}, CompressionNone, 2)
+	arc := snapshot.Archives[src]
+	chunk := arc.Chunks[0]
+
+	// delay loading the remaining parts, so the missing one is always noticed
+	*r.backend.Backends[0] = &slowBackend{*r.backend.Backends[0]}
+	err = os.Remove(filepath.Join(repo, chunksDirname, SubDirForChunk(chunk.Hash), chunk.Hash+".0_1"))
+	if err != nil {
+		t.Fatalf("Failed removing chunk part: %s", err)
+	}
+
+	progress, err := VerifySnapshot(r, snapshot.ID, 100)
+	if err != nil {
+		t.Fatalf("Failed to verify snapshot: %s", err)
+	}
+	var stats Stats
+	var warnings int
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Unexpected error verifying snapshot: %s", p.Error)
+		}
+		if p.Warning != nil {
+			w, ok := p.Warning.(*ReconstructionWarning)
+			if !ok {
+				t.Fatalf("Expected ReconstructionWarning, got %v", p.Warning)
+			}
+			if w.Chunk.Hash != chunk.Hash || fmt.Sprint(w.MissingParts) != "[0]" {
+				t.Errorf("Expected part 0 of chunk %s to be missing, got %v of %s", chunk.Hash, w.MissingParts, w.Chunk.Hash)
+			}
+			warnings++
+		}
+		stats = p.TotalStatistics
+	}
+
+	if warnings != 1 || stats.Reconstructed != 1 {
+		t.Errorf("Expected 1 reconstructed chunk, got %d warnings and %d reconstructed", warnings, stats.Reconstructed)
+	}
+	if stats.Chunks != uint64(len(arc.Chunks)) || stats.Errors != 0 {
+		t.Errorf("Expected %d verified chunks and no errors, got %d and %d", len(arc.Chunks), stats.Chunks, stats.Errors)
+	}
+}
+
+func TestVerifySnapshotDedup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "random")
+	data := writeRandomFile(t, src, 2*preferredChunkSize)
+	cp := filepath.Join(dir, "copy")
+	if err = ioutil.WriteFile(cp, data, 0644); err != nil {
+		t.Fatalf("Failed writing file: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src, cp}, CompressionNone, 0)
+	arc := snapshot.Archives[src]
+
+	be := &recordingBackend{Backend: *r.backend.Backends[0]}
+	var b Backend = be
+	r.backend.Backends = []*Backend{&b}
+
+	progress, err := VerifySnapshot(r, snapshot.ID, 100)
+	if err != nil {
+		t.Fatalf("Failed to verify snapshot: %s", err)
+	}
+	var stats Stats
+	for p := range progress {
+		if p.Error != nil {
+			t.Errorf("Unexpected error verifying snapshot: %s", p.Error)
+		}
+		stats = p.TotalStatistics
+	}
+
+	if stats.Chunks != uint64(2*len(arc.Chunks)) {
+		t.Errorf("Expected %d verified chunks, got %d", 2*len(arc.Chunks), stats.Chunks)
+	}
+	if stats.DedupChunks != uint64(len(arc.Chunks)) || stats.DedupSize != arc.Size {
+		t.Errorf("Expected %d deduplicated chunks with %d bytes, got %d with %d bytes",
+			len(arc.Chunks), arc.Size, stats.DedupChunks, stats.DedupSize)
+	}
+	if len(be.loaded) != len(arc.Chunks) {
+		t.Errorf("Expected every chunk to be loaded once, got %v", be.loaded)
+	}
+}
@@ -7,7 +7,11 @@
 
 package knoxite
 
-import uuid "github.com/nu7hatch/gouuid"
+import (
+	"sort"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
 
 // A Volume contains various snapshots
 // MUST BE encrypted
@@ -16,6 +20,10 @@ type Volume struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Snapshots   []string `json:"snapshots"`
+
+	// Tags of the snapshots, by snapshot ID. They're kept here instead of in
+	// the snapshots, so changing them only requires saving the repository
+	Tags map[string][]string `json:"tags,omitempty"`
 }
 
 // NewVolume creates a new volume
@@ -58,17 +66,115 @@ func (v *Volume) RemoveSnapshot(id string) error {
 	}
 
 	v.Snapshots = snapshots
+	delete(v.Tags, id)
+	return nil
+}
+
+// hasSnapshot returns true if the volume contains the snapshot
+func (v *Volume) hasSnapshot(id string) bool {
+	for _, snapshot := range v.Snapshots {
+		if snapshot == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SnapshotTags returns the tags of a snapshot, sorted alphabetically
+func (v *Volume) SnapshotTags(id string) []string {
+	return append([]string{}, v.Tags[id]...)
+}
+
+// AddTags adds tags to a snapshot. Save the repository to persist them
+func (v *Volume) AddTags(id string, tags ...string) error {
+	if !v.hasSnapshot(id) {
+		return ErrSnapshotNotFound
+	}
+
+	set := make(map[string]bool)
+	for _, tag := range append(v.Tags[id], tags...) {
+		if tag != "" {
+			set[tag] = true
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	sorted := make([]string, 0, len(set))
+	for tag := range set {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+
+	if v.Tags == nil {
+		v.Tags = make(map[string][]string)
+	}
+	v.Tags[id] = sorted
 	return nil
 }
 
+// RemoveTags removes tags from a snapshot. Save the repository to persist
+// the change
+func (v *Volume) RemoveTags(id string, tags ...string) error {
+	if !v.hasSnapshot(id) {
+		return ErrSnapshotNotFound
+	}
+
+	remaining := []string{}
+	for _, tag := range v.Tags[id] {
+		if !containsString(tags, tag) {
+			remaining = append(remaining, tag)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(v.Tags, id)
+	} else {
+		v.Tags[id] = remaining
+	}
+	return nil
+}
+
+// SnapshotsWithTags returns the IDs of all snapshots carrying every one of
+// the tags, in the order they were added to the volume
+func (v *Volume) SnapshotsWithTags(tags ...string) []string {
+	ids := []string{}
+	for _, id := range v.Snapshots {
+		match := true
+		for _, tag := range tags {
+			if !containsString(v.Tags[id], tag) {
+				match = false
+				break
+			}
+		}
+		if match {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // LoadSnapshot loads a snapshot within a volume from a repository
 func (v *Volume) LoadSnapshot(id string, repository *Repository) (*Snapshot, error) {
 	for _, snapshot := range v.Snapshots {
 		if snapshot == id {
 			snapshot, err := openSnapshot(id, repository)
+			if err == nil {
+				snapshot.Tags = v.SnapshotTags(id)
+			}
 			return snapshot, err
 		}
 	}
 
 	return &Snapshot{}, ErrSnapshotNotFound
 }
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -8,8 +8,11 @@
 package knoxite
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -130,3 +133,68 @@ func TestSnapshotRemove(t *testing.T) {
 		t.Errorf("Expected no error, got: %s", err)
 	}
 }
+
+func TestVolumeTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, snapshot := setupDecodeTest(t, dir, []string{"volume.go"}, CompressionNone, 0)
+	snapshotFile := filepath.Join(dir, "snapshots", snapshot.ID)
+	data, err := ioutil.ReadFile(snapshotFile)
+	if err != nil {
+		t.Fatalf("Failed reading snapshot: %s", err)
+	}
+
+	vol := r.Volumes[0]
+	if err = vol.AddTags(snapshot.ID, "monthly", "pre-upgrade", "monthly"); err != nil {
+		t.Fatalf("Failed tagging snapshot: %s", err)
+	}
+	if err = vol.AddTags("unknown", "monthly"); err != ErrSnapshotNotFound {
+		t.Errorf("Expected %v, got %v", ErrSnapshotNotFound, err)
+	}
+	if err = r.Save(); err != nil {
+		t.Fatalf("Failed saving repository: %s", err)
+	}
+
+	r, err = OpenRepository(dir, "this_is_a_password")
+	if err != nil {
+		t.Fatalf("Failed opening repository: %s", err)
+	}
+	_, s, err := r.FindSnapshot(snapshot.ID)
+	if err != nil {
+		t.Fatalf("Failed finding snapshot: %s", err)
+	}
+	if !reflect.DeepEqual(s.Tags, []string{"monthly", "pre-upgrade"}) {
+		t.Errorf("Expected tags [monthly pre-upgrade], got %v", s.Tags)
+	}
+	if !s.HasTag("monthly") || s.HasTag("weekly") {
+		t.Errorf("Unexpected tags %v", s.Tags)
+	}
+
+	vol = r.Volumes[0]
+	if ids := vol.SnapshotsWithTags("monthly", "pre-upgrade"); len(ids) != 1 || ids[0] != snapshot.ID {
+		t.Errorf("Expected snapshot %s to be found by its tags, got %v", snapshot.ID, ids)
+	}
+	if ids := vol.SnapshotsWithTags("weekly"); len(ids) != 0 {
+		t.Errorf("Expected no snapshots tagged weekly, got %v", ids)
+	}
+
+	if err = vol.RemoveTags(snapshot.ID, "monthly"); err != nil {
+		t.Fatalf("Failed removing tag: %s", err)
+	}
+	if tags := vol.SnapshotTags(snapshot.ID); !reflect.DeepEqual(tags, []string{"pre-upgrade"}) {
+		t.Errorf("Expected tags [pre-upgrade], got %v", tags)
+	}
+
+	// tags don't touch the snapshot itself
+	b, err := ioutil.ReadFile(snapshotFile)
+	if err != nil {
+		t.Fatalf("Failed reading snapshot: %s", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("Expected snapshot to be unchanged by tagging it")
+	}
+}
@@ -0,0 +1,75 @@
+// +build linux
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+// readXAttrs returns the extended attributes of a file or directory. This
+// includes POSIX ACLs, which Linux exposes as the system.posix_acl_access and
+// system.posix_acl_default attributes
+func readXAttrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			return nil, nil
+		}
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+
+		vsize, err := syscall.Getxattr(path, name, nil)
+		if err == syscall.ENODATA {
+			// attribute got removed in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+
+		value := make([]byte, vsize)
+		vsize, err = syscall.Getxattr(path, name, value)
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		xattrs[name] = value[:vsize]
+	}
+
+	return xattrs, nil
+}
+
+// restoreXAttrs sets the extended attributes of a file or directory
+func restoreXAttrs(path string, xattrs map[string][]byte) error {
+	for name, value := range xattrs {
+		err := syscall.Setxattr(path, name, value, 0)
+		if err != nil {
+			return &os.PathError{Op: "setxattr " + name, Path: path, Err: err}
+		}
+	}
+
+	return nil
+}
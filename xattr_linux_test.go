@@ -0,0 +1,138 @@
+// +build linux
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// posixACL encodes ACL entries (tag, permissions, id) the way Linux stores
+// them in the system.posix_acl_access attribute
+func posixACL(entries ...[3]uint32) []byte {
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(2))
+	for _, e := range entries {
+		_ = binary.Write(&buf, binary.LittleEndian, uint16(e[0]))
+		_ = binary.Write(&buf, binary.LittleEndian, uint16(e[1]))
+		_ = binary.Write(&buf, binary.LittleEndian, e[2])
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecodeArchiveXAttrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "file")
+	writeRandomFile(t, src, 1024)
+	err = syscall.Setxattr(src, "user.comment", []byte("knoxite"), 0)
+	if err != nil {
+		t.Skipf("Extended attributes not supported: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+	if string(arc.XAttrs["user.comment"]) != "knoxite" {
+		t.Fatalf("Extended attribute missing in archive: %v", arc.XAttrs)
+	}
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	path := filepath.Join(targetdir, "file")
+	progress := make(chan Progress)
+	go func() {
+		for p := range progress {
+			if p.Warning != nil {
+				t.Errorf("Unexpected warning: %s", p.Warning)
+			}
+		}
+	}()
+	err = DecodeArchive(progress, r, arc, path, DefaultRestoreOptions())
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+
+	xattrs, err := readXAttrs(path)
+	if err != nil {
+		t.Fatalf("Failed reading extended attributes: %s", err)
+	}
+	if string(xattrs["user.comment"]) != "knoxite" {
+		t.Errorf("Expected extended attribute user.comment to be restored, got %v", xattrs)
+	}
+}
+
+func TestDecodeArchiveACL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// grant read access to a second user
+	const undefinedID = 0xffffffff
+	acl := posixACL(
+		[3]uint32{0x01, 6, undefinedID}, // owner
+		[3]uint32{0x02, 4, 1234},        // named user
+		[3]uint32{0x04, 4, undefinedID}, // owning group
+		[3]uint32{0x10, 4, undefinedID}, // mask
+		[3]uint32{0x20, 0, undefinedID}, // others
+	)
+
+	src := filepath.Join(dir, "file")
+	writeRandomFile(t, src, 1024)
+	err = syscall.Setxattr(src, "system.posix_acl_access", acl, 0)
+	if err != nil {
+		t.Skipf("POSIX ACLs not supported: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+	arc := *snapshot.Archives[src]
+
+	targetdir, err := ioutil.TempDir("", "knoxite.target")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for restore: %s", err)
+	}
+	defer os.RemoveAll(targetdir)
+
+	path := filepath.Join(targetdir, "file")
+	progress := make(chan Progress)
+	go func() {
+		for range progress {
+		}
+	}()
+	err = DecodeArchive(progress, r, arc, path, DefaultRestoreOptions())
+	close(progress)
+	if err != nil {
+		t.Fatalf("Failed restoring archive: %s", err)
+	}
+
+	xattrs, err := readXAttrs(path)
+	if err != nil {
+		t.Fatalf("Failed reading extended attributes: %s", err)
+	}
+	if !bytes.Equal(xattrs["system.posix_acl_access"], acl) {
+		t.Errorf("ACL mismatch after restore: %v", xattrs["system.posix_acl_access"])
+	}
+}
@@ -0,0 +1,20 @@
+// +build !linux
+
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+// readXAttrs is a no-op on platforms without extended attribute support
+func readXAttrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// restoreXAttrs is a no-op on platforms without extended attribute support
+func restoreXAttrs(path string, xattrs map[string][]byte) error {
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"time"
+)
+
+// ExportZip writes the content of a snapshot as a zip archive to w. The files
+// get streamed chunk by chunk, so they're never held in memory entirely.
+// Symlinks are stored the way Unix zip tools do, as entries containing the
+// link's target. Zip doesn't know hardlinks, so they're stored as copies of
+// the file they link to
+func ExportZip(repository Repository, snapshot *Snapshot, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, arc := range exportOrder(snapshot) {
+		if err := writeZipEntry(zw, repository, snapshot, *arc); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeZipEntry writes the header and content of an archive
+func writeZipEntry(zw *zip.Writer, repository Repository, snapshot *Snapshot, arc Archive) error {
+	hdr := &zip.FileHeader{
+		Name:     exportName(arc.Path),
+		Method:   zip.Store,
+		Modified: time.Unix(arc.ModTime, 0),
+	}
+
+	data := arc
+	switch {
+	case arc.Type == Directory:
+		hdr.Name += "/"
+		hdr.SetMode(arc.Mode | os.ModeDir)
+	case arc.Type == SymLink:
+		hdr.SetMode(arc.Mode | os.ModeSymlink)
+	default:
+		hdr.Method = zip.Deflate
+		hdr.SetMode(arc.Mode)
+		if arc.LinkTarget != "" {
+			target, ok := snapshot.Archives[arc.LinkTarget]
+			if !ok {
+				return &os.PathError{Op: "export", Path: arc.LinkTarget, Err: os.ErrNotExist}
+			}
+			data = *target
+		}
+	}
+
+	fw, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	switch arc.Type {
+	case SymLink:
+		_, err = io.WriteString(fw, arc.PointsTo)
+		return err
+	case File:
+		r, err := NewArchiveReader(repository, data)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		_, err = io.Copy(fw, r)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+ * knoxite
+ *     Copyright (c) 2016-2020, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE
+ */
+
+package knoxite
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportZip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knoxite")
+	if err != nil {
+		t.Fatalf("Failed creating temporary dir for repository: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err = os.MkdirAll(filepath.Join(src, "sub"), 0750); err != nil {
+		t.Fatalf("Failed creating source dir: %s", err)
+	}
+	data := writeRandomFile(t, filepath.Join(src, "random"), 3*preferredChunkSize)
+	nested := writeRandomFile(t, filepath.Join(src, "sub", "nested"), 1024)
+	if err = os.Symlink("random", filepath.Join(src, "link")); err != nil {
+		t.Fatalf("Failed creating symlink: %s", err)
+	}
+	if err = os.Link(filepath.Join(src, "sub", "nested"), filepath.Join(src, "hardlink")); err != nil {
+		t.Fatalf("Failed creating hardlink: %s", err)
+	}
+
+	r, snapshot := setupDecodeTest(t, filepath.Join(dir, "repo"), []string{src}, CompressionNone, 0)
+
+	var buf bytes.Buffer
+	if err = ExportZip(r, snapshot, &buf); err != nil {
+		t.Fatalf("Failed exporting snapshot: %s", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed reading zip archive: %s", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	base := strings.TrimPrefix(filepath.ToSlash(src), "/")
+	tests := []struct {
+		name string
+		mode os.FileMode
+		data []byte
+	}{
+		{base + "/", os.ModeDir, nil},
+		{base + "/sub/", os.ModeDir, nil},
+		{base + "/random", 0, data},
+		{base + "/sub/nested", 0, nested},
+		{base + "/hardlink", 0, nested},
+		{base + "/link", os.ModeSymlink, []byte("random")},
+	}
+	for _, tt := range tests {
+		f, ok := files[tt.name]
+		if !ok {
+			t.Errorf("Expected %s to be part of the zip archive", tt.name)
+			continue
+		}
+		if f.Mode()&os.ModeType != tt.mode {
+			t.Errorf("Expected type %v for %s, got %v", tt.mode, tt.name, f.Mode()&os.ModeType)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed opening %s: %s", tt.name, err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed reading %s: %s", tt.name, err)
+		}
+		if !bytes.Equal(b, tt.data) {
+			t.Errorf("Data mismatch for %s", tt.name)
+		}
+	}
+}